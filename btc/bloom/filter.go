@@ -0,0 +1,79 @@
+package bloom
+
+import (
+	"bytes"
+	"math"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Spaces the seeds of the hash functions, from BIP37.
+const hashSeedStep = 0xfba4c795
+
+// Filter is a BIP37 bloom filter. Load it on a connection with the
+// filterload message from MsgFilterLoad.
+type Filter struct {
+	data      []byte
+	hashFuncs uint32
+	tweak     uint32
+	flags     encoding.BloomUpdate
+}
+
+// NewFilter sizes a filter for the expected number of elements and false
+// positive rate the same way Bitcoin Core does, capped at the BIP37 limits.
+// The tweak should be random so peers can't link filters of the same wallet.
+func NewFilter(elements int, fpRate float64, tweak uint32, flags encoding.BloomUpdate) *Filter {
+	elements = max(elements, 1)
+	bitsNeeded := -1 / (math.Ln2 * math.Ln2) * float64(elements) * math.Log(fpRate)
+	size := uint32(min(bitsNeeded, encoding.MaxBloomFilterSize*8)) / 8
+	size = max(size, 1)
+	hashFuncs := float64(size*8/uint32(elements)) * math.Ln2
+	return &Filter{
+		data:      make([]byte, size),
+		hashFuncs: uint32(min(hashFuncs, encoding.MaxBloomHashFuncs)),
+		tweak:     tweak,
+		flags:     flags,
+	}
+}
+
+func (f *Filter) hash(n uint32, data []byte) uint32 {
+	return MurmurHash3(n*hashSeedStep+f.tweak, data) % uint32(len(f.data)*8)
+}
+
+// Add inserts the data, e.g. a public key hash, a script or an outpoint.
+func (f *Filter) Add(data []byte) {
+	for n := range f.hashFuncs {
+		index := f.hash(n, data)
+		f.data[index>>3] |= 1 << (index & 7)
+	}
+}
+
+// AddOutPoint inserts an outpoint so the peer matches transactions spending
+// it.
+func (f *Filter) AddOutPoint(outPoint encoding.OutPoint) {
+	buf := bytes.NewBuffer(make([]byte, 0, 36))
+	// Writing to a bytes.Buffer can't fail.
+	_ = outPoint.Encode(buf)
+	f.Add(buf.Bytes())
+}
+
+// Contains reports whether the data may have been added.
+func (f *Filter) Contains(data []byte) bool {
+	for n := range f.hashFuncs {
+		index := f.hash(n, data)
+		if f.data[index>>3]&(1<<(index&7)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MsgFilterLoad returns the filterload message for the filter.
+func (f *Filter) MsgFilterLoad() *encoding.MsgFilterLoad {
+	return &encoding.MsgFilterLoad{
+		Filter:    bytes.Clone(f.data),
+		HashFuncs: encoding.UInt32(f.hashFuncs),
+		Tweak:     encoding.UInt32(f.tweak),
+		Flags:     f.flags,
+	}
+}
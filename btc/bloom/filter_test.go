@@ -0,0 +1,58 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// Vectors from Bitcoin Core's bloom_tests.
+func Test_Filter_Serialize(t *testing.T) {
+	tests := []struct {
+		name  string
+		tweak uint32
+		want  string
+	}{
+		{name: "no tweak", tweak: 0, want: "03614e9b050000000000000001"},
+		{name: "tweak", tweak: 2147483649, want: "03ce4299050000000100008001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewFilter(3, 0.01, tt.tweak, encoding.BloomUpdateAll)
+			filter.Add(mustHex(t, "99108ad8ed9bb6274d3980bab5a85c048f0950c8"))
+			assert.True(t, filter.Contains(mustHex(t, "99108ad8ed9bb6274d3980bab5a85c048f0950c8")))
+			assert.False(t, filter.Contains(mustHex(t, "19108ad8ed9bb6274d3980bab5a85c048f0950c8")))
+			filter.Add(mustHex(t, "b5a2c786d9ef4658287ced5914b37a1b4aa32eee"))
+			filter.Add(mustHex(t, "b9300670b4c5366e95b2699e8b18bc75e5f729c5"))
+
+			buf := bytes.NewBuffer(nil)
+			require.NoError(t, filter.MsgFilterLoad().Encode(buf))
+			assert.Equal(t, tt.want, hex.EncodeToString(buf.Bytes()))
+		})
+	}
+}
+
+func Test_Filter_Limits(t *testing.T) {
+	filter := NewFilter(1_000_000, 0.0001, 0, encoding.BloomUpdateNone)
+	load := filter.MsgFilterLoad()
+	assert.Len(t, load.Filter, encoding.MaxBloomFilterSize)
+	assert.LessOrEqual(t, load.HashFuncs, encoding.UInt32(encoding.MaxBloomHashFuncs))
+
+	outPoint := encoding.OutPoint{Hash: encoding.Hash{1}, Index: 2}
+	filter.AddOutPoint(outPoint)
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, outPoint.Encode(buf))
+	assert.True(t, filter.Contains(buf.Bytes()))
+}
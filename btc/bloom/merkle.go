@@ -0,0 +1,102 @@
+package bloom
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+var ErrInvalidMerkleBlock = errors.New("invalid merkle block")
+
+// Bitcoin Core's bound on the transactions of a block.
+const maxMerkleBlockTxs = encoding.MaxBlockWeight / 240
+
+// ExtractMatches verifies the partial merkle tree of a merkleblock against
+// the merkle root of its header and returns the txids proven to be in the
+// block.
+func ExtractMatches(merkleBlock *encoding.MsgMerkleBlock) ([]encoding.Hash, error) {
+	total := uint32(merkleBlock.TotalTransactions)
+	if total == 0 || total > maxMerkleBlockTxs {
+		return nil, fmt.Errorf("%w: %d transactions", ErrInvalidMerkleBlock, total)
+	}
+	if len(merkleBlock.Hashes) > int(total) {
+		return nil, fmt.Errorf("%w: %d hashes for %d transactions", ErrInvalidMerkleBlock, len(merkleBlock.Hashes), total)
+	}
+	if len(merkleBlock.Flags)*8 < len(merkleBlock.Hashes) {
+		return nil, fmt.Errorf("%w: %d flag bits for %d hashes", ErrInvalidMerkleBlock, len(merkleBlock.Flags)*8, len(merkleBlock.Hashes))
+	}
+
+	height := 0
+	for treeWidth(total, height) > 1 {
+		height++
+	}
+	tree := &partialTree{merkleBlock: merkleBlock, total: total}
+	root, err := tree.traverse(height, 0)
+	if err != nil {
+		return nil, err
+	}
+	// Everything has to be used, up to the padding of the last flag byte.
+	if (tree.bitsUsed+7)/8 != len(merkleBlock.Flags) || tree.hashesUsed != len(merkleBlock.Hashes) {
+		return nil, fmt.Errorf("%w: used %d of %d flag bits and %d of %d hashes", ErrInvalidMerkleBlock,
+			tree.bitsUsed, len(merkleBlock.Flags)*8, tree.hashesUsed, len(merkleBlock.Hashes))
+	}
+	if root != merkleBlock.Header.MerkleRoot {
+		return nil, fmt.Errorf("%w: merkle root %s, header has %s", ErrInvalidMerkleBlock, root, merkleBlock.Header.MerkleRoot)
+	}
+	return tree.matches, nil
+}
+
+// The number of nodes at a height of the tree, leaves are at height 0.
+func treeWidth(total uint32, height int) uint32 {
+	return (total + (1 << height) - 1) >> height
+}
+
+type partialTree struct {
+	merkleBlock *encoding.MsgMerkleBlock
+	total       uint32
+	bitsUsed    int
+	hashesUsed  int
+	matches     []encoding.Hash
+}
+
+// Walks the tree depth first like Bitcoin Core's CPartialMerkleTree. A set
+// flag means the node is an ancestor of a match (or a match itself for
+// leaves), so we descend. Otherwise the next hash is the node's hash.
+func (t *partialTree) traverse(height int, pos uint32) (encoding.Hash, error) {
+	if t.bitsUsed >= len(t.merkleBlock.Flags)*8 {
+		return encoding.Hash{}, fmt.Errorf("%w: ran out of flag bits", ErrInvalidMerkleBlock)
+	}
+	flag := t.merkleBlock.Flags[t.bitsUsed/8]>>(t.bitsUsed%8)&1 == 1
+	t.bitsUsed++
+
+	if height == 0 || !flag {
+		if t.hashesUsed >= len(t.merkleBlock.Hashes) {
+			return encoding.Hash{}, fmt.Errorf("%w: ran out of hashes", ErrInvalidMerkleBlock)
+		}
+		hash := t.merkleBlock.Hashes[t.hashesUsed]
+		t.hashesUsed++
+		if height == 0 && flag {
+			t.matches = append(t.matches, hash)
+		}
+		return hash, nil
+	}
+
+	left, err := t.traverse(height-1, pos*2)
+	if err != nil {
+		return encoding.Hash{}, err
+	}
+	right := left
+	if pos*2+1 < treeWidth(t.total, height-1) {
+		right, err = t.traverse(height-1, pos*2+1)
+		if err != nil {
+			return encoding.Hash{}, err
+		}
+		// Identical siblings allow faking matches (CVE-2012-2459).
+		if right == left {
+			return encoding.Hash{}, fmt.Errorf("%w: duplicate hashes at height %d", ErrInvalidMerkleBlock, height)
+		}
+	}
+	return encoding.DoubleSHA256(append(left[:], right[:]...)), nil
+}
@@ -0,0 +1,141 @@
+package bloom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+func testTxids(count int) []encoding.Hash {
+	txids := make([]encoding.Hash, count)
+	for i := range txids {
+		txids[i] = encoding.Hash{byte(i + 1), byte((i + 1) >> 8)}
+	}
+	return txids
+}
+
+func merkleNode(txids []encoding.Hash, height int, pos uint32) encoding.Hash {
+	if height == 0 {
+		return txids[pos]
+	}
+	left := merkleNode(txids, height-1, pos*2)
+	right := left
+	if pos*2+1 < treeWidth(uint32(len(txids)), height-1) {
+		right = merkleNode(txids, height-1, pos*2+1)
+	}
+	return encoding.DoubleSHA256(append(left[:], right[:]...))
+}
+
+// Builds the merkleblock proving the matched txids the way Bitcoin Core's
+// CPartialMerkleTree does.
+func buildMerkleBlock(txids []encoding.Hash, matched map[int]bool) *encoding.MsgMerkleBlock {
+	total := uint32(len(txids))
+	height := 0
+	for treeWidth(total, height) > 1 {
+		height++
+	}
+	var flags []bool
+	var hashes []encoding.Hash
+	var build func(height int, pos uint32)
+	build = func(height int, pos uint32) {
+		parentOfMatch := false
+		for p := pos << height; p < (pos+1)<<height && p < total; p++ {
+			parentOfMatch = parentOfMatch || matched[int(p)]
+		}
+		flags = append(flags, parentOfMatch)
+		if height == 0 || !parentOfMatch {
+			hashes = append(hashes, merkleNode(txids, height, pos))
+			return
+		}
+		build(height-1, pos*2)
+		if pos*2+1 < treeWidth(total, height-1) {
+			build(height-1, pos*2+1)
+		}
+	}
+	build(height, 0)
+
+	flagBytes := make([]byte, (len(flags)+7)/8)
+	for i, flag := range flags {
+		if flag {
+			flagBytes[i/8] |= 1 << (i % 8)
+		}
+	}
+	return &encoding.MsgMerkleBlock{
+		Header:            encoding.BlockHeader{MerkleRoot: merkleNode(txids, height, 0)},
+		TotalTransactions: encoding.UInt32(total),
+		Hashes:            hashes,
+		Flags:             flagBytes,
+	}
+}
+
+func Test_ExtractMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		count   int
+		matched []int
+	}{
+		{name: "single tx", count: 1, matched: []int{0}},
+		{name: "no matches", count: 7, matched: nil},
+		{name: "odd count", count: 7, matched: []int{2, 6}},
+		{name: "all", count: 4, matched: []int{0, 1, 2, 3}},
+		{name: "large", count: 1000, matched: []int{0, 499, 999}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txids := testTxids(tt.count)
+			matched := map[int]bool{}
+			var want []encoding.Hash
+			for _, i := range tt.matched {
+				matched[i] = true
+				want = append(want, txids[i])
+			}
+
+			got, err := ExtractMatches(buildMerkleBlock(txids, matched))
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func Test_ExtractMatches_Invalid(t *testing.T) {
+	txids := testTxids(5)
+	valid := func() *encoding.MsgMerkleBlock {
+		return buildMerkleBlock(txids, map[int]bool{1: true})
+	}
+
+	tests := []struct {
+		name   string
+		modify func(merkleBlock *encoding.MsgMerkleBlock)
+	}{
+		{name: "wrong root", modify: func(mb *encoding.MsgMerkleBlock) { mb.Header.MerkleRoot[0]++ }},
+		{name: "wrong hash", modify: func(mb *encoding.MsgMerkleBlock) { mb.Hashes[0][0]++ }},
+		{name: "no transactions", modify: func(mb *encoding.MsgMerkleBlock) { mb.TotalTransactions = 0 }},
+		{name: "extra hash", modify: func(mb *encoding.MsgMerkleBlock) { mb.Hashes = append(mb.Hashes, encoding.Hash{}) }},
+		{name: "missing hash", modify: func(mb *encoding.MsgMerkleBlock) { mb.Hashes = mb.Hashes[:len(mb.Hashes)-1] }},
+		{name: "extra flag byte", modify: func(mb *encoding.MsgMerkleBlock) { mb.Flags = append(mb.Flags, 0) }},
+		{name: "no flags", modify: func(mb *encoding.MsgMerkleBlock) { mb.Flags = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merkleBlock := valid()
+			tt.modify(merkleBlock)
+			_, err := ExtractMatches(merkleBlock)
+			assert.ErrorIs(t, err, ErrInvalidMerkleBlock)
+		})
+	}
+}
+
+// Duplicating the last transaction gives the same merkle root, the proof
+// must not accept it.
+func Test_ExtractMatches_DuplicateTx(t *testing.T) {
+	txids := testTxids(5)
+	duplicated := append(testTxids(5), txids[4])
+	merkleBlock := buildMerkleBlock(duplicated, map[int]bool{5: true})
+	require.Equal(t, buildMerkleBlock(txids, nil).Header.MerkleRoot, merkleBlock.Header.MerkleRoot)
+
+	_, err := ExtractMatches(merkleBlock)
+	assert.ErrorIs(t, err, ErrInvalidMerkleBlock)
+}
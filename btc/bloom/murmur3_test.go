@@ -0,0 +1,40 @@
+package bloom
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Vectors from Bitcoin Core's hash_tests.
+func Test_MurmurHash3(t *testing.T) {
+	tests := []struct {
+		seed uint32
+		data string
+		want uint32
+	}{
+		{seed: 0x00000000, data: "", want: 0x00000000},
+		{seed: 0xFBA4C795, data: "", want: 0x6a396f08},
+		{seed: 0xffffffff, data: "", want: 0x81f16f39},
+		{seed: 0x00000000, data: "00", want: 0x514E28B7},
+		{seed: 0xFBA4C795, data: "00", want: 0xEA3F0B17},
+		{seed: 0x00000000, data: "ff", want: 0xFD6CF10D},
+		{seed: 0x00000000, data: "0011", want: 0x16C6B7AB},
+		{seed: 0x00000000, data: "001122", want: 0x8EB51C3D},
+		{seed: 0x00000000, data: "00112233", want: 0xB4471BF8},
+		{seed: 0x00000000, data: "0011223344", want: 0xE2301FA8},
+		{seed: 0x00000000, data: "001122334455", want: 0xFC2E4A15},
+		{seed: 0x00000000, data: "00112233445566", want: 0xB074502C},
+		{seed: 0x00000000, data: "0011223344556677", want: 0x8034D2A0},
+		{seed: 0x00000000, data: "001122334455667788", want: 0xB4698DEF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, MurmurHash3(tt.seed, data))
+		})
+	}
+}
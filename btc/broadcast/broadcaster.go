@@ -0,0 +1,373 @@
+package broadcast
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/client"
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+var (
+	ErrInvalidTransaction = errors.New("invalid transaction")
+	ErrAlreadyBroadcast   = errors.New("transaction is already being broadcast")
+)
+
+type Status int
+
+const (
+	// The transaction was announced to a peer with inv.
+	StatusAnnounced Status = iota
+	// A peer asked for the transaction with getdata and we sent it.
+	StatusRequested
+	// A peer rejected the transaction, we stop broadcasting it. Only peers
+	// that still send BIP61 reject messages report this, Bitcoin Core
+	// removed them.
+	StatusRejected
+	// The transaction is in a block, we stop broadcasting it.
+	StatusConfirmed
+	// Neither confirmed nor rejected within the broadcast timeout, we stop
+	// broadcasting it.
+	StatusExpired
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusAnnounced:
+		return "announced"
+	case StatusRequested:
+		return "requested"
+	case StatusRejected:
+		return "rejected"
+	case StatusConfirmed:
+		return "confirmed"
+	case StatusExpired:
+		return "expired"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// Update reports a step in the life of a broadcast transaction.
+type Update struct {
+	TxID   encoding.Hash
+	Status Status
+	// The peer involved, empty for confirmations.
+	Peer string
+	// Set for StatusRejected.
+	Reason string
+	// Set for StatusConfirmed.
+	BlockHash encoding.Hash
+}
+
+// Callback receives the updates of a transaction. It is called without locks
+// held, so it can call back into the Broadcaster.
+type Callback func(update Update)
+
+// Peer is a connected peer we can announce to, see client.BTCClient.
+type Peer interface {
+	Send(ctx context.Context, msg encoding.Message) error
+	Address() string
+	Peer() *client.Peer
+}
+
+type transaction struct {
+	tx          *encoding.MsgTx
+	txid        encoding.Hash
+	wtxid       encoding.Hash
+	callback    Callback
+	requestedBy map[string]bool
+	// Ends the broadcast after the timeout, nil without one.
+	expiry *time.Timer
+}
+
+type outgoing struct {
+	peer Peer
+	msg  encoding.Message
+	// Notifications to make once the message is sent.
+	updates []func()
+}
+
+// Broadcaster sends our transactions to the network. It announces them to
+// all connected peers with inv, answers their getdata with the transaction
+// and announces again every interval to the peers that didn't ask for it yet,
+// until the transaction is confirmed, rejected or times out. It is fed the
+// messages received from the peers and the blocks we receive.
+type Broadcaster struct {
+	log      *slog.Logger
+	peers    func() []Peer
+	interval time.Duration
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	byTxid  map[encoding.Hash]*transaction
+	byWtxid map[encoding.Hash]*transaction
+}
+
+// New creates a Broadcaster that gives up on transactions after the timeout,
+// a zero timeout keeps them until they are confirmed or rejected.
+func New(log *slog.Logger, peers func() []Peer, interval, timeout time.Duration) *Broadcaster {
+	return &Broadcaster{
+		log:      log,
+		peers:    peers,
+		interval: interval,
+		timeout:  timeout,
+		byTxid:   map[encoding.Hash]*transaction{},
+		byWtxid:  map[encoding.Hash]*transaction{},
+	}
+}
+
+// Broadcast parses a raw serialized transaction, legacy or segwit, and
+// announces it to the connected peers. The callback may be nil.
+func (b *Broadcaster) Broadcast(ctx context.Context, raw []byte, callback Callback) (encoding.Hash, error) {
+	tx := &encoding.MsgTx{}
+	reader := bytes.NewReader(raw)
+	err := tx.Decode(reader)
+	if err != nil {
+		return encoding.Hash{}, fmt.Errorf("%w: %w", ErrInvalidTransaction, err)
+	}
+	if reader.Len() > 0 {
+		return encoding.Hash{}, fmt.Errorf("%w: %d trailing bytes", ErrInvalidTransaction, reader.Len())
+	}
+	if tx.IsCoinbase() {
+		return encoding.Hash{}, fmt.Errorf("%w: coinbase can't be broadcast", ErrInvalidTransaction)
+	}
+
+	t := &transaction{
+		tx:          tx,
+		txid:        tx.TxHash(),
+		wtxid:       tx.WitnessHash(),
+		callback:    callback,
+		requestedBy: map[string]bool{},
+	}
+	b.mu.Lock()
+	if _, ok := b.byTxid[t.txid]; ok {
+		b.mu.Unlock()
+		return t.txid, fmt.Errorf("%w: %s", ErrAlreadyBroadcast, t.txid)
+	}
+	b.byTxid[t.txid] = t
+	b.byWtxid[t.wtxid] = t
+	b.mu.Unlock()
+
+	b.announce(ctx, []*transaction{t})
+
+	// The timeout starts after the first announcement, so it is always
+	// reported after it.
+	b.mu.Lock()
+	if b.timeout > 0 && b.byTxid[t.txid] == t {
+		t.expiry = time.AfterFunc(b.timeout, func() {
+			b.stop(t, Update{Status: StatusExpired})
+		})
+	}
+	b.mu.Unlock()
+	return t.txid, nil
+}
+
+// RequestedBy returns the addresses of the peers that asked for the
+// transaction so far.
+func (b *Broadcaster) RequestedBy(txid encoding.Hash) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.byTxid[txid]
+	if !ok {
+		return nil
+	}
+	peers := make([]string, 0, len(t.requestedBy))
+	for peer := range t.requestedBy {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// Pending returns the txids still being broadcast.
+func (b *Broadcaster) Pending() []encoding.Hash {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	txids := make([]encoding.Hash, 0, len(b.byTxid))
+	for txid := range b.byTxid {
+		txids = append(txids, txid)
+	}
+	return txids
+}
+
+// Run announces the pending transactions again every interval until ctx
+// ends. A zero interval disables the re-announcements.
+func (b *Broadcaster) Run(ctx context.Context) {
+	if b.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			pending := make([]*transaction, 0, len(b.byTxid))
+			for _, t := range b.byTxid {
+				pending = append(pending, t)
+			}
+			b.mu.Unlock()
+			b.announce(ctx, pending)
+		}
+	}
+}
+
+// HandleMessage answers getdata for our transactions and stops broadcasting
+// the ones a peer rejects or a block confirms.
+func (b *Broadcaster) HandleMessage(ctx context.Context, peer Peer, msg encoding.Message) {
+	switch msg := msg.(type) {
+	case *encoding.MsgGetData:
+		b.handleGetData(ctx, peer, msg)
+	case *encoding.MsgReject:
+		if msg.Message != encoding.VarStr(encoding.TxCommand) || msg.Hash == nil {
+			return
+		}
+		b.finish(*msg.Hash, Update{Status: StatusRejected, Peer: peer.Address(),
+			Reason: fmt.Sprintf("code 0x%02x: %s", uint8(msg.Code), msg.Reason)})
+	case *encoding.MsgBlock:
+		b.HandleBlock(msg)
+	}
+}
+
+// HandleBlock stops broadcasting the transactions confirmed by the block,
+// e.g. one reconstructed from a compact block.
+func (b *Broadcaster) HandleBlock(block *encoding.MsgBlock) {
+	hash := block.BlockHash()
+	for i := range block.Transactions {
+		b.finish(block.Transactions[i].TxHash(), Update{Status: StatusConfirmed, BlockHash: hash})
+	}
+}
+
+func (b *Broadcaster) handleGetData(ctx context.Context, peer Peer, getData *encoding.MsgGetData) {
+	var updates []func()
+	var txs []*encoding.MsgTx
+	b.mu.Lock()
+	for _, vect := range getData.Inventory {
+		var t *transaction
+		switch vect.Type &^ encoding.InvWitnessFlag {
+		case encoding.InvTypeTx:
+			t = b.byTxid[vect.Hash]
+		case encoding.InvTypeWTx:
+			t = b.byWtxid[vect.Hash]
+		}
+		if t == nil {
+			continue
+		}
+		t.requestedBy[peer.Address()] = true
+		// Only MSG_WITNESS_TX and MSG_WTX ask for the witness data.
+		tx := t.tx
+		if vect.Type == encoding.InvTypeTx {
+			tx = tx.StripWitness()
+		}
+		txs = append(txs, tx)
+		updates = append(updates, t.notify(Update{Status: StatusRequested, Peer: peer.Address()}))
+	}
+	b.mu.Unlock()
+
+	for i, tx := range txs {
+		err := peer.Send(ctx, tx)
+		if err != nil {
+			b.log.Warn("failed sending broadcast transaction", "txid", tx.TxHash().String(), "peer", peer.Address(), "error", err)
+			continue
+		}
+		updates[i]()
+	}
+}
+
+// Announces the transactions to every peer that hasn't asked for them yet.
+// Peers that negotiated wtxidrelay ignore announcements by txid (BIP339).
+// Transactions we stopped broadcasting in the meantime are left out, we
+// wouldn't answer the getdata for them.
+func (b *Broadcaster) announce(ctx context.Context, txs []*transaction) {
+	peers := b.peers()
+	var sends []outgoing
+	b.mu.Lock()
+	for _, peer := range peers {
+		wtxidRelay := peer.Peer().Features().WTxIDRelay
+		var inventory []encoding.InvVect
+		var updates []func()
+		for _, t := range txs {
+			if b.byTxid[t.txid] != t || t.requestedBy[peer.Address()] {
+				continue
+			}
+			inventory = append(inventory, t.inventory(wtxidRelay))
+			updates = append(updates, t.notify(Update{Status: StatusAnnounced, Peer: peer.Address()}))
+		}
+		for start := 0; start < len(inventory); start += encoding.MaxInvEntries {
+			end := min(start+encoding.MaxInvEntries, len(inventory))
+			sends = append(sends, outgoing{
+				peer:    peer,
+				msg:     &encoding.MsgInv{Inventory: inventory[start:end]},
+				updates: updates[start:end],
+			})
+		}
+	}
+	b.mu.Unlock()
+
+	for _, send := range sends {
+		err := send.peer.Send(ctx, send.msg)
+		if err != nil {
+			b.log.Warn("failed announcing transactions", "peer", send.peer.Address(), "error", err)
+			continue
+		}
+		for _, update := range send.updates {
+			update()
+		}
+	}
+}
+
+// Stops broadcasting the transaction if it is ours.
+func (b *Broadcaster) finish(txid encoding.Hash, update Update) {
+	b.mu.Lock()
+	t, ok := b.byTxid[txid]
+	b.mu.Unlock()
+	if ok {
+		b.stop(t, update)
+	}
+}
+
+// Stops broadcasting the transaction unless that already happened. The same
+// transaction can be broadcast again afterwards, so a late expiry must not
+// end the new broadcast.
+func (b *Broadcaster) stop(t *transaction, update Update) {
+	b.mu.Lock()
+	current := b.byTxid[t.txid] == t
+	if current {
+		delete(b.byTxid, t.txid)
+		delete(b.byWtxid, t.wtxid)
+		if t.expiry != nil {
+			t.expiry.Stop()
+		}
+	}
+	b.mu.Unlock()
+	if current {
+		b.log.Info("stopped broadcasting transaction", "txid", t.txid.String(), "status", update.Status.String())
+		t.notify(update)()
+	}
+}
+
+func (t *transaction) inventory(wtxidRelay bool) encoding.InvVect {
+	if wtxidRelay {
+		return encoding.InvVect{Type: encoding.InvTypeWTx, Hash: t.wtxid}
+	}
+	return encoding.InvVect{Type: encoding.InvTypeTx, Hash: t.txid}
+}
+
+// Returns the call of the callback with the update, to be made once the lock
+// is released.
+func (t *transaction) notify(update Update) func() {
+	update.TxID = t.txid
+	return func() {
+		if t.callback != nil {
+			t.callback(update)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package broadcast
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/client"
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Records the messages sent to it.
+type fakePeer struct {
+	address string
+	mu      sync.Mutex
+	sent    []encoding.Message
+}
+
+func (p *fakePeer) Send(_ context.Context, msg encoding.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, msg)
+	return nil
+}
+
+func (p *fakePeer) Address() string {
+	return p.address
+}
+
+func (p *fakePeer) Peer() *client.Peer {
+	return &client.Peer{}
+}
+
+func (p *fakePeer) messages() []encoding.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]encoding.Message(nil), p.sent...)
+}
+
+func testTx() *encoding.MsgTx {
+	return &encoding.MsgTx{
+		Version: 2,
+		TxIn: []encoding.TxIn{{
+			PreviousOutPoint: encoding.OutPoint{Hash: encoding.Hash{1}},
+			Sequence:         0xffffffff,
+			Witness:          encoding.TxWitness{{1, 2}},
+		}},
+		TxOut: []encoding.TxOut{{Value: 1000, PkScript: encoding.VarBytes{0x51}}},
+	}
+}
+
+func rawTx(t *testing.T, tx *encoding.MsgTx) []byte {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, tx.Encode(buf))
+	return buf.Bytes()
+}
+
+type updates struct {
+	mu   sync.Mutex
+	list []Update
+}
+
+func (u *updates) add(update Update) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.list = append(u.list, update)
+}
+
+func (u *updates) statuses() []Status {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var statuses []Status
+	for _, update := range u.list {
+		statuses = append(statuses, update.Status)
+	}
+	return statuses
+}
+
+func Test_Broadcaster_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	first, second := &fakePeer{address: "first"}, &fakePeer{address: "second"}
+	b := New(slog.Default(), func() []Peer { return []Peer{first, second} }, time.Minute, 0)
+	tx := testTx()
+	got := &updates{}
+
+	txid, err := b.Broadcast(ctx, rawTx(t, tx), got.add)
+	require.NoError(t, err)
+	assert.Equal(t, tx.TxHash(), txid)
+	inv := &encoding.MsgInv{Inventory: []encoding.InvVect{{Type: encoding.InvTypeTx, Hash: txid}}}
+	assert.Equal(t, []encoding.Message{inv}, first.messages())
+	assert.Equal(t, []encoding.Message{inv}, second.messages())
+
+	getData, err := encoding.NewGetDataMsg([]encoding.InvVect{{Type: encoding.InvTypeWitnessTx, Hash: txid}})
+	require.NoError(t, err)
+	b.HandleMessage(ctx, first, getData)
+	require.Len(t, first.messages(), 2)
+	assert.Equal(t, txid, first.messages()[1].(*encoding.MsgTx).TxHash())
+	assert.Equal(t, []string{"first"}, b.RequestedBy(txid))
+
+	// Re-announcements skip the peers that have the transaction.
+	pending := b.byTxid[txid]
+	b.announce(ctx, []*transaction{pending})
+	assert.Len(t, first.messages(), 2)
+	assert.Len(t, second.messages(), 2)
+
+	b.HandleMessage(ctx, second, &encoding.MsgBlock{Transactions: []encoding.MsgTx{*tx}})
+	assert.Empty(t, b.Pending())
+	// A re-announcement that races with the confirmation leaves it out.
+	b.announce(ctx, []*transaction{pending})
+	assert.Len(t, second.messages(), 2)
+	assert.Equal(t, []Status{StatusAnnounced, StatusAnnounced, StatusRequested, StatusAnnounced, StatusConfirmed}, got.statuses())
+}
+
+func Test_Broadcaster_WTxIDRelay(t *testing.T) {
+	tx := &transaction{txid: testTx().TxHash(), wtxid: testTx().WitnessHash()}
+	assert.Equal(t, encoding.InvVect{Type: encoding.InvTypeTx, Hash: tx.txid}, tx.inventory(false))
+	assert.Equal(t, encoding.InvVect{Type: encoding.InvTypeWTx, Hash: tx.wtxid}, tx.inventory(true))
+
+	peer := &fakePeer{address: "peer"}
+	b := New(slog.Default(), func() []Peer { return nil }, time.Minute, 0)
+	txid, err := b.Broadcast(context.Background(), rawTx(t, testTx()), nil)
+	require.NoError(t, err)
+	getData, err := encoding.NewGetDataMsg([]encoding.InvVect{{Type: encoding.InvTypeWTx, Hash: tx.wtxid}})
+	require.NoError(t, err)
+	b.HandleMessage(context.Background(), peer, getData)
+	require.Len(t, peer.messages(), 1)
+	assert.Equal(t, txid, peer.messages()[0].(*encoding.MsgTx).TxHash())
+}
+
+func Test_Broadcaster_GetDataSerialization(t *testing.T) {
+	tx := testTx()
+	tests := []struct {
+		name    string
+		vect    encoding.InvVect
+		witness bool
+	}{
+		{name: "MSG_TX", vect: encoding.InvVect{Type: encoding.InvTypeTx, Hash: tx.TxHash()}, witness: false},
+		{name: "MSG_WITNESS_TX", vect: encoding.InvVect{Type: encoding.InvTypeWitnessTx, Hash: tx.TxHash()}, witness: true},
+		{name: "MSG_WTX", vect: encoding.InvVect{Type: encoding.InvTypeWTx, Hash: tx.WitnessHash()}, witness: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer := &fakePeer{address: "peer"}
+			b := New(slog.Default(), func() []Peer { return nil }, time.Minute, 0)
+			_, err := b.Broadcast(context.Background(), rawTx(t, tx), nil)
+			require.NoError(t, err)
+			getData, err := encoding.NewGetDataMsg([]encoding.InvVect{tt.vect})
+			require.NoError(t, err)
+
+			b.HandleMessage(context.Background(), peer, getData)
+
+			require.Len(t, peer.messages(), 1)
+			sent := peer.messages()[0].(*encoding.MsgTx)
+			assert.Equal(t, tt.witness, sent.HasWitness())
+			assert.Equal(t, tx.TxHash(), sent.TxHash())
+		})
+	}
+}
+
+func Test_Broadcaster_Rejected(t *testing.T) {
+	peer := &fakePeer{address: "peer"}
+	b := New(slog.Default(), func() []Peer { return []Peer{peer} }, time.Minute, 0)
+	got := &updates{}
+	txid, err := b.Broadcast(context.Background(), rawTx(t, testTx()), got.add)
+	require.NoError(t, err)
+
+	b.HandleMessage(context.Background(), peer, &encoding.MsgReject{
+		Message: encoding.VarStr(encoding.TxCommand),
+		Code:    encoding.RejectInsufficientFee,
+		Reason:  "min relay fee not met",
+		Hash:    &txid,
+	})
+	assert.Empty(t, b.Pending())
+	require.Len(t, got.list, 2)
+	assert.Equal(t, StatusRejected, got.list[1].Status)
+	assert.Equal(t, "peer", got.list[1].Peer)
+	assert.Contains(t, got.list[1].Reason, "min relay fee not met")
+}
+
+func Test_Broadcaster_Expired(t *testing.T) {
+	peer := &fakePeer{address: "peer"}
+	b := New(slog.Default(), func() []Peer { return []Peer{peer} }, time.Minute, 10*time.Millisecond)
+	got := &updates{}
+	_, err := b.Broadcast(context.Background(), rawTx(t, testTx()), got.add)
+	require.NoError(t, err)
+
+	want := []Status{StatusAnnounced, StatusExpired}
+	assert.Eventually(t, func() bool { return slices.Equal(want, got.statuses()) }, time.Second, 5*time.Millisecond,
+		"got %v", got.statuses())
+	assert.Empty(t, b.Pending())
+
+	// A confirmed transaction doesn't expire afterwards.
+	got = &updates{}
+	_, err = b.Broadcast(context.Background(), rawTx(t, testTx()), got.add)
+	require.NoError(t, err)
+	b.HandleBlock(&encoding.MsgBlock{Transactions: []encoding.MsgTx{*testTx()}})
+	assert.Never(t, func() bool { return len(got.statuses()) > 2 }, 50*time.Millisecond, 5*time.Millisecond)
+	assert.Equal(t, []Status{StatusAnnounced, StatusConfirmed}, got.statuses())
+}
+
+func Test_Broadcaster_Run(t *testing.T) {
+	peer := &fakePeer{address: "peer"}
+	b := New(slog.Default(), func() []Peer { return []Peer{peer} }, 10*time.Millisecond, 0)
+	_, err := b.Broadcast(context.Background(), rawTx(t, testTx()), nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+	assert.Eventually(t, func() bool { return len(peer.messages()) >= 3 }, time.Second, 5*time.Millisecond)
+}
+
+func Test_Broadcaster_Invalid(t *testing.T) {
+	b := New(slog.Default(), func() []Peer { return nil }, time.Minute, 0)
+	ctx := context.Background()
+
+	_, err := b.Broadcast(ctx, []byte{1, 2, 3}, nil)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+	_, err = b.Broadcast(ctx, append(rawTx(t, testTx()), 0), nil)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+	coinbase := testTx()
+	coinbase.TxIn[0].PreviousOutPoint = encoding.OutPoint{Index: 0xffffffff}
+	_, err = b.Broadcast(ctx, rawTx(t, coinbase), nil)
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+
+	_, err = b.Broadcast(ctx, rawTx(t, testTx()), nil)
+	require.NoError(t, err)
+	_, err = b.Broadcast(ctx, rawTx(t, testTx()), nil)
+	assert.ErrorIs(t, err, ErrAlreadyBroadcast)
+}
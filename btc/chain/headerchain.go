@@ -0,0 +1,214 @@
+package chain
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+var (
+	ErrUnconnectedHeader = errors.New("header does not connect to a known header")
+	ErrBadProofOfWork    = errors.New("header hash does not meet its target")
+	ErrBadDifficulty     = errors.New("header has unexpected difficulty bits")
+	ErrTimeTooOld        = errors.New("header timestamp is not after the median time past")
+	ErrTimeTooNew        = errors.New("header timestamp is too far in the future")
+)
+
+// Number of previous blocks used to calculate the median time past.
+const medianTimeBlocks = 11
+
+// BIP94 allows the first block of a period to go at most this many seconds
+// back from the previous block.
+const maxTimewarp = 600
+
+// Like Bitcoin Core, we don't accept headers more than two hours ahead of our
+// clock.
+const maxFutureBlockTime = 2 * time.Hour
+
+type headerNode struct {
+	header encoding.BlockHeader
+	hash   encoding.Hash
+	height int32
+	work   *big.Int
+	parent *headerNode
+}
+
+func (n *headerNode) ancestor(height int32) *headerNode {
+	node := n
+	for node != nil && node.height > height {
+		node = node.parent
+	}
+	return node
+}
+
+// HeaderChain is an in-memory block header index. It validates headers
+// before adding them and tracks the tip with the most work.
+type HeaderChain struct {
+	mu     sync.RWMutex
+	params *Params
+	index  map[encoding.Hash]*headerNode
+	best   *headerNode
+	now    func() time.Time
+}
+
+func NewHeaderChain(params *Params) *HeaderChain {
+	genesis := &headerNode{
+		header: params.Genesis,
+		hash:   params.Genesis.Hash(),
+		height: 0,
+		work:   Work(uint32(params.Genesis.Bits)),
+	}
+	return &HeaderChain{
+		params: params,
+		index:  map[encoding.Hash]*headerNode{genesis.hash: genesis},
+		best:   genesis,
+		now:    time.Now,
+	}
+}
+
+// Best returns the tip header of the chain with the most work and its height.
+func (c *HeaderChain) Best() (encoding.BlockHeader, int32) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.best.header, c.best.height
+}
+
+func (c *HeaderChain) Contains(hash encoding.Hash) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.index[hash]
+	return ok
+}
+
+// Locator builds a block locator from the best tip: the last 10 hashes one by
+// one, then exponentially further apart, always ending with genesis.
+func (c *HeaderChain) Locator() []encoding.Hash {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var locator []encoding.Hash
+	step := int32(1)
+	node := c.best
+	for node != nil {
+		locator = append(locator, node.hash)
+		if node.height == 0 {
+			break
+		}
+		height := max(node.height-step, 0)
+		node = node.ancestor(height)
+		if len(locator) > 10 {
+			step *= 2
+		}
+	}
+	return locator
+}
+
+// AddHeaders validates and connects a batch of consecutive headers. Headers
+// before the first invalid one stay in the chain.
+func (c *HeaderChain) AddHeaders(headers []encoding.BlockHeader) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range headers {
+		err := c.addHeader(&headers[i])
+		if err != nil {
+			return fmt.Errorf("header %s: %w", headers[i].Hash(), err)
+		}
+	}
+	return nil
+}
+
+func (c *HeaderChain) addHeader(header *encoding.BlockHeader) error {
+	hash := header.Hash()
+	if _, known := c.index[hash]; known {
+		return nil
+	}
+	parent, ok := c.index[header.PrevBlock]
+	if !ok {
+		return ErrUnconnectedHeader
+	}
+	err := c.validate(header, parent)
+	if err != nil {
+		return err
+	}
+
+	node := &headerNode{
+		header: *header,
+		hash:   hash,
+		height: parent.height + 1,
+		work:   new(big.Int).Add(parent.work, Work(uint32(header.Bits))),
+		parent: parent,
+	}
+	c.index[hash] = node
+	if node.work.Cmp(c.best.work) > 0 {
+		c.best = node
+	}
+	return nil
+}
+
+func (c *HeaderChain) validate(header *encoding.BlockHeader, parent *headerNode) error {
+	if !checkProofOfWork(header, c.params) {
+		return ErrBadProofOfWork
+	}
+	expected := c.nextWorkRequired(parent, header)
+	if uint32(header.Bits) != expected {
+		return fmt.Errorf("%w: got %08x, expected %08x", ErrBadDifficulty, uint32(header.Bits), expected)
+	}
+	if header.Timestamp <= medianTimePast(parent) {
+		return ErrTimeTooOld
+	}
+	if limit := c.now().Add(maxFutureBlockTime); int64(header.Timestamp) > limit.Unix() {
+		return fmt.Errorf("%w: %d, limit is %d", ErrTimeTooNew, header.Timestamp, limit.Unix())
+	}
+	interval := c.params.RetargetInterval()
+	if c.params.EnforceBIP94 && (parent.height+1)%interval == 0 &&
+		int64(header.Timestamp) < int64(parent.header.Timestamp)-maxTimewarp {
+		return fmt.Errorf("%w: timewarp at retarget boundary", ErrTimeTooOld)
+	}
+	return nil
+}
+
+// Follows Bitcoin Core's GetNextWorkRequired.
+func (c *HeaderChain) nextWorkRequired(parent *headerNode, header *encoding.BlockHeader) uint32 {
+	params := c.params
+	powLimitBits := BigToCompact(params.PowLimit)
+	interval := params.RetargetInterval()
+
+	if (parent.height+1)%interval != 0 {
+		if !params.AllowMinDifficultyBlocks {
+			return uint32(parent.header.Bits)
+		}
+		// A block more than 20 minutes after the previous one may use min difficulty.
+		if int64(header.Timestamp) > int64(parent.header.Timestamp)+int64(2*params.TargetSpacing.Seconds()) {
+			return powLimitBits
+		}
+		// Otherwise use the difficulty of the last block that wasn't a min difficulty one.
+		node := parent
+		for node.parent != nil && node.height%interval != 0 && uint32(node.header.Bits) == powLimitBits {
+			node = node.parent
+		}
+		return uint32(node.header.Bits)
+	}
+
+	first := parent.ancestor(parent.height - (interval - 1))
+	return calculateNextWorkRequired(params,
+		uint32(parent.header.Bits), uint32(first.header.Bits),
+		uint32(parent.header.Timestamp), uint32(first.header.Timestamp),
+	)
+}
+
+func medianTimePast(node *headerNode) encoding.UInt32 {
+	times := make([]encoding.UInt32, 0, medianTimeBlocks)
+	for i := 0; i < medianTimeBlocks && node != nil; i++ {
+		times = append(times, node.header.Timestamp)
+		node = node.parent
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
@@ -0,0 +1,211 @@
+package chain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+func regtestChain(t *testing.T) *HeaderChain {
+	t.Helper()
+	params, err := ParamsFor(encoding.NetworkRegtest)
+	require.NoError(t, err)
+	return NewHeaderChain(params)
+}
+
+// Grinds the nonce until the header meets the regtest target.
+func mineHeader(t *testing.T, params *Params, prev encoding.Hash, timestamp uint32) encoding.BlockHeader {
+	t.Helper()
+	header := encoding.BlockHeader{
+		Version:   4,
+		PrevBlock: prev,
+		Timestamp: encoding.UInt32(timestamp),
+		Bits:      params.Genesis.Bits,
+	}
+	for !checkProofOfWork(&header, params) {
+		header.Nonce++
+	}
+	return header
+}
+
+func mineHeaders(t *testing.T, chain *HeaderChain, count int) []encoding.BlockHeader {
+	t.Helper()
+	tip, _ := chain.Best()
+	prev := tip.Hash()
+	timestamp := uint32(tip.Timestamp)
+	headers := make([]encoding.BlockHeader, 0, count)
+	for range count {
+		timestamp += 600
+		header := mineHeader(t, chain.params, prev, timestamp)
+		headers = append(headers, header)
+		prev = header.Hash()
+	}
+	return headers
+}
+
+func Test_HeaderChain_AddHeaders(t *testing.T) {
+	chain := regtestChain(t)
+	headers := mineHeaders(t, chain, 20)
+
+	require.NoError(t, chain.AddHeaders(headers))
+
+	best, height := chain.Best()
+	assert.Equal(t, int32(20), height)
+	assert.Equal(t, headers[19], best)
+	assert.True(t, chain.Contains(headers[5].Hash()))
+
+	// Adding known headers again is a no-op.
+	require.NoError(t, chain.AddHeaders(headers[:3]))
+	_, height = chain.Best()
+	assert.Equal(t, int32(20), height)
+}
+
+func Test_HeaderChain_Mainnet(t *testing.T) {
+	params, err := ParamsFor(encoding.NetworkMainnet)
+	require.NoError(t, err)
+	chain := NewHeaderChain(params)
+
+	block1 := encoding.BlockHeader{
+		Version:    1,
+		PrevBlock:  params.Genesis.Hash(),
+		MerkleRoot: mustHash("0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098"),
+		Timestamp:  1231469665,
+		Bits:       0x1d00ffff,
+		Nonce:      2573394689,
+	}
+	block2 := encoding.BlockHeader{
+		Version:    1,
+		PrevBlock:  block1.Hash(),
+		MerkleRoot: mustHash("9b0fc92260312ce44e74ef369f5c66bbb85848f2eddd5a7a1cde251e54ccfdd5"),
+		Timestamp:  1231469744,
+		Bits:       0x1d00ffff,
+		Nonce:      1639830024,
+	}
+	assert.Equal(t, "00000000839a8e6886ab5951d76f411475428afc90947ee320161bbf18eb6048", block1.Hash().String())
+	assert.Equal(t, "000000006a625f06636b8bb6ac7b960a8d03705d1ace08b1a19da3fdcc99ddbd", block2.Hash().String())
+
+	require.NoError(t, chain.AddHeaders([]encoding.BlockHeader{block1, block2}))
+	_, height := chain.Best()
+	assert.Equal(t, int32(2), height)
+}
+
+func Test_HeaderChain_Rejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(chain *HeaderChain, header *encoding.BlockHeader)
+		want   error
+	}{
+		{
+			name: "unconnected",
+			modify: func(_ *HeaderChain, header *encoding.BlockHeader) {
+				header.PrevBlock = encoding.Hash{1}
+			},
+			want: ErrUnconnectedHeader,
+		},
+		{
+			name: "bad proof of work",
+			modify: func(chain *HeaderChain, header *encoding.BlockHeader) {
+				for checkProofOfWork(header, chain.params) {
+					header.Nonce++
+				}
+			},
+			want: ErrBadProofOfWork,
+		},
+		{
+			name: "bad difficulty",
+			modify: func(chain *HeaderChain, header *encoding.BlockHeader) {
+				header.Bits = 0x207ffffe
+				for !checkProofOfWork(header, chain.params) {
+					header.Nonce++
+				}
+			},
+			want: ErrBadDifficulty,
+		},
+		{
+			name: "time too old",
+			modify: func(chain *HeaderChain, header *encoding.BlockHeader) {
+				header.Timestamp = chain.params.Genesis.Timestamp
+				for !checkProofOfWork(header, chain.params) {
+					header.Nonce++
+				}
+			},
+			want: ErrTimeTooOld,
+		},
+		{
+			name: "time too new",
+			modify: func(chain *HeaderChain, header *encoding.BlockHeader) {
+				chain.now = func() time.Time {
+					return time.Unix(int64(header.Timestamp), 0).Add(-maxFutureBlockTime - time.Second)
+				}
+			},
+			want: ErrTimeTooNew,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := regtestChain(t)
+			headers := mineHeaders(t, chain, 3)
+			tt.modify(chain, &headers[2])
+
+			err := chain.AddHeaders(headers)
+
+			assert.ErrorIs(t, err, tt.want)
+			// Headers before the invalid one are kept.
+			_, height := chain.Best()
+			assert.Equal(t, int32(2), height)
+		})
+	}
+}
+
+func Test_HeaderChain_Retarget(t *testing.T) {
+	params := *networkParams[encoding.NetworkRegtest]
+	params.NoRetargeting = false
+	params.TargetTimespan = 4 * params.TargetSpacing
+	chain := NewHeaderChain(&params)
+
+	// Like Core, the timespan is measured over interval-1 blocks: 900s against
+	// a 2400s target scales the target by 3/8.
+	tip := params.Genesis
+	var headers []encoding.BlockHeader
+	for range 3 {
+		header := mineHeader(t, &params, tip.Hash(), uint32(tip.Timestamp)+300)
+		headers = append(headers, header)
+		tip = header
+	}
+	require.NoError(t, chain.AddHeaders(headers))
+
+	want := chain.nextWorkRequired(chain.best, &tip)
+	assert.Equal(t, uint32(0x202fffff), want)
+
+	header := mineHeader(t, &params, tip.Hash(), uint32(tip.Timestamp)+300)
+	assert.ErrorIs(t, chain.AddHeaders([]encoding.BlockHeader{header}), ErrBadDifficulty)
+
+	header.Bits = encoding.UInt32(want)
+	for !checkProofOfWork(&header, &params) {
+		header.Nonce++
+	}
+	require.NoError(t, chain.AddHeaders([]encoding.BlockHeader{header}))
+	_, height := chain.Best()
+	assert.Equal(t, int32(4), height)
+}
+
+func Test_HeaderChain_Locator(t *testing.T) {
+	chain := regtestChain(t)
+	headers := mineHeaders(t, chain, 30)
+	require.NoError(t, chain.AddHeaders(headers))
+
+	locator := chain.Locator()
+
+	// Heights 30..19 one by one, then 17, 13, 5 and genesis.
+	require.Len(t, locator, 16)
+	assert.Equal(t, headers[29].Hash(), locator[0])
+	assert.Equal(t, headers[18].Hash(), locator[11])
+	assert.Equal(t, headers[16].Hash(), locator[12])
+	assert.Equal(t, headers[12].Hash(), locator[13])
+	assert.Equal(t, headers[4].Hash(), locator[14])
+	assert.Equal(t, chain.params.Genesis.Hash(), locator[15])
+}
@@ -0,0 +1,126 @@
+package chain
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Params holds the consensus rules we need to validate block headers.
+type Params struct {
+	Network encoding.Network
+	Genesis encoding.BlockHeader
+
+	// Highest target (lowest difficulty) allowed on the network.
+	PowLimit *big.Int
+
+	TargetTimespan time.Duration
+	TargetSpacing  time.Duration
+
+	// Testnets allow a min difficulty block when the previous block is more
+	// than two target spacings old.
+	AllowMinDifficultyBlocks bool
+	// Regtest never changes the difficulty.
+	NoRetargeting bool
+	// BIP94 (testnet4) retargets from the first block of the period and
+	// restricts the timestamp of the first block of a new period.
+	EnforceBIP94 bool
+}
+
+// Blocks between difficulty adjustments.
+func (p *Params) RetargetInterval() int32 {
+	return int32(p.TargetTimespan / p.TargetSpacing)
+}
+
+func ParamsFor(network encoding.Network) (*Params, error) {
+	params, ok := networkParams[network]
+	if !ok {
+		return nil, fmt.Errorf("no chain params for network: %s", network)
+	}
+	return params, nil
+}
+
+var (
+	mainPowLimit    = mustBig("00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	signetPowLimit  = mustBig("00000377ae000000000000000000000000000000000000000000000000000000")
+	regtestPowLimit = mustBig("7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+
+	mainnetMerkleRoot  = mustHash("4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b")
+	testnet4MerkleRoot = mustHash("7aa0a7ae1e223414cb807e40cd57e667b718e42aaf9306db9102fe28912b7b4e")
+)
+
+const (
+	targetTimespan = 14 * 24 * time.Hour
+	targetSpacing  = 10 * time.Minute
+)
+
+var networkParams = map[encoding.Network]*Params{
+	encoding.NetworkMainnet: {
+		Network:        encoding.NetworkMainnet,
+		Genesis:        genesis(mainnetMerkleRoot, 1231006505, 0x1d00ffff, 2083236893),
+		PowLimit:       mainPowLimit,
+		TargetTimespan: targetTimespan,
+		TargetSpacing:  targetSpacing,
+	},
+	encoding.NetworkTestnet3: {
+		Network:                  encoding.NetworkTestnet3,
+		Genesis:                  genesis(mainnetMerkleRoot, 1296688602, 0x1d00ffff, 414098458),
+		PowLimit:                 mainPowLimit,
+		TargetTimespan:           targetTimespan,
+		TargetSpacing:            targetSpacing,
+		AllowMinDifficultyBlocks: true,
+	},
+	encoding.NetworkTestnet4: {
+		Network:                  encoding.NetworkTestnet4,
+		Genesis:                  genesis(testnet4MerkleRoot, 1714777860, 0x1d00ffff, 393743547),
+		PowLimit:                 mainPowLimit,
+		TargetTimespan:           targetTimespan,
+		TargetSpacing:            targetSpacing,
+		AllowMinDifficultyBlocks: true,
+		EnforceBIP94:             true,
+	},
+	encoding.NetworkSignet: {
+		Network:        encoding.NetworkSignet,
+		Genesis:        genesis(mainnetMerkleRoot, 1598918400, 0x1e0377ae, 52613770),
+		PowLimit:       signetPowLimit,
+		TargetTimespan: targetTimespan,
+		TargetSpacing:  targetSpacing,
+	},
+	encoding.NetworkRegtest: {
+		Network:                  encoding.NetworkRegtest,
+		Genesis:                  genesis(mainnetMerkleRoot, 1296688602, 0x207fffff, 2),
+		PowLimit:                 regtestPowLimit,
+		TargetTimespan:           targetTimespan,
+		TargetSpacing:            targetSpacing,
+		AllowMinDifficultyBlocks: true,
+		NoRetargeting:            true,
+	},
+}
+
+func genesis(merkleRoot encoding.Hash, timestamp, bits, nonce uint32) encoding.BlockHeader {
+	return encoding.BlockHeader{
+		Version:    1,
+		MerkleRoot: merkleRoot,
+		Timestamp:  encoding.UInt32(timestamp),
+		Bits:       encoding.UInt32(bits),
+		Nonce:      encoding.UInt32(nonce),
+	}
+}
+
+func mustBig(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("invalid big number: " + s)
+	}
+	return n
+}
+
+func mustHash(s string) encoding.Hash {
+	hash, err := encoding.NewHashFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
@@ -0,0 +1,36 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+func Test_Params_GenesisHash(t *testing.T) {
+	tests := []struct {
+		network encoding.Network
+		want    string
+	}{
+		{network: encoding.NetworkMainnet, want: "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"},
+		{network: encoding.NetworkTestnet3, want: "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943"},
+		{network: encoding.NetworkTestnet4, want: "00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043"},
+		{network: encoding.NetworkSignet, want: "00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6"},
+		{network: encoding.NetworkRegtest, want: "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.network.String(), func(t *testing.T) {
+			params, err := ParamsFor(tt.network)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, params.Genesis.Hash().String())
+			assert.True(t, checkProofOfWork(&params.Genesis, params))
+			assert.Equal(t, int32(2016), params.RetargetInterval())
+		})
+	}
+}
+
+func Test_ParamsFor_Unknown(t *testing.T) {
+	_, err := ParamsFor(encoding.Network(42))
+	assert.EqualError(t, err, "no chain params for network: unknown(42)")
+}
@@ -0,0 +1,102 @@
+package chain
+
+import (
+	"math/big"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// CompactToBig expands the compact nBits representation of a target. The
+// sign bit is ignored, negative targets are never valid.
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := int64(compact & 0x007fffff)
+	exponent := uint(compact >> 24)
+
+	n := big.NewInt(mantissa)
+	if exponent <= 3 {
+		return n.Rsh(n, 8*(3-exponent))
+	}
+	return n.Lsh(n, 8*(exponent-3))
+}
+
+// BigToCompact encodes a target in the compact nBits representation.
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+
+	exponent := uint((n.BitLen() + 7) / 8)
+	var mantissa uint32
+	if exponent <= 3 {
+		mantissa = uint32(n.Uint64() << (8 * (3 - exponent)))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(n, 8*(exponent-3)).Uint64())
+	}
+
+	// The mantissa is signed, so move a set sign bit into the exponent.
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+	return uint32(exponent<<24) | mantissa
+}
+
+// HashToBig interprets a hash as the little endian 256 bit number compared
+// against the target.
+func HashToBig(hash encoding.Hash) *big.Int {
+	reversed := make([]byte, len(hash))
+	for i := range hash {
+		reversed[len(hash)-1-i] = hash[i]
+	}
+	return new(big.Int).SetBytes(reversed)
+}
+
+// Work is the expected number of hashes needed to find a block with the
+// given target: 2^256 / (target + 1).
+func Work(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
+
+// Checks that the header hash meets its own target and the target is within
+// the network limit.
+func checkProofOfWork(header *encoding.BlockHeader, params *Params) bool {
+	bits := uint32(header.Bits)
+	if bits&0x00800000 != 0 {
+		return false
+	}
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 || target.Cmp(params.PowLimit) > 0 {
+		return false
+	}
+	return HashToBig(header.Hash()).Cmp(target) <= 0
+}
+
+// Computes the new difficulty at the end of a retarget period. firstBits is
+// only used by BIP94 networks, the rest scale the last block's target.
+func calculateNextWorkRequired(params *Params, lastBits, firstBits, lastTime, firstTime uint32) uint32 {
+	if params.NoRetargeting {
+		return lastBits
+	}
+
+	timespan := int64(params.TargetTimespan.Seconds())
+	actual := int64(lastTime) - int64(firstTime)
+	actual = max(actual, timespan/4)
+	actual = min(actual, timespan*4)
+
+	bits := lastBits
+	if params.EnforceBIP94 {
+		bits = firstBits
+	}
+	target := CompactToBig(bits)
+	target.Mul(target, big.NewInt(actual))
+	target.Div(target, big.NewInt(timespan))
+	if target.Cmp(params.PowLimit) > 0 {
+		target.Set(params.PowLimit)
+	}
+	return BigToCompact(target)
+}
@@ -0,0 +1,79 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+func Test_CompactToBig(t *testing.T) {
+	tests := []struct {
+		compact uint32
+		want    string
+	}{
+		{compact: 0x00123456, want: "0"},
+		{compact: 0x01003456, want: "0"},
+		{compact: 0x01123456, want: "12"},
+		{compact: 0x02123456, want: "1234"},
+		{compact: 0x03123456, want: "123456"},
+		{compact: 0x04123456, want: "12345600"},
+		{compact: 0x05009234, want: "92340000"},
+		{compact: 0x1d00ffff, want: "ffff0000000000000000000000000000000000000000000000000000"},
+		{compact: 0x207fffff, want: "7fffff0000000000000000000000000000000000000000000000000000000000"},
+	}
+	for _, tt := range tests {
+		got := CompactToBig(tt.compact)
+		assert.Equal(t, tt.want, got.Text(16), "%08x", tt.compact)
+	}
+}
+
+func Test_BigToCompact(t *testing.T) {
+	tests := []struct {
+		n    string
+		want uint32
+	}{
+		{n: "0", want: 0},
+		{n: "12", want: 0x01120000},
+		{n: "80", want: 0x02008000},
+		{n: "1234", want: 0x02123400},
+		{n: "92340000", want: 0x05009234},
+		{n: "ffff0000000000000000000000000000000000000000000000000000", want: 0x1d00ffff},
+		{n: "7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", want: 0x207fffff},
+	}
+	for _, tt := range tests {
+		got := BigToCompact(mustBig(tt.n))
+		assert.Equal(t, tt.want, got, tt.n)
+	}
+}
+
+// Test vectors from Bitcoin Core's pow_tests.cpp.
+func Test_CalculateNextWorkRequired(t *testing.T) {
+	mainnet := networkParams[encoding.NetworkMainnet]
+	tests := []struct {
+		name      string
+		firstTime uint32
+		lastTime  uint32
+		lastBits  uint32
+		want      uint32
+	}{
+		{name: "get_next_work", firstTime: 1261130161, lastTime: 1262152739, lastBits: 0x1d00ffff, want: 0x1d00d86a},
+		{name: "pow_limit", firstTime: 1231006505, lastTime: 1233061996, lastBits: 0x1d00ffff, want: 0x1d00ffff},
+		{name: "lower_limit_actual", firstTime: 1279008237, lastTime: 1279297671, lastBits: 0x1c05a3f4, want: 0x1c0168fd},
+		{name: "upper_limit_actual", firstTime: 1263163443, lastTime: 1269211443, lastBits: 0x1c387f6f, want: 0x1d00e1fd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateNextWorkRequired(mainnet, tt.lastBits, tt.lastBits, tt.lastTime, tt.firstTime)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_Work(t *testing.T) {
+	// Difficulty 1 blocks take 2^32 hashes on average.
+	assert.Equal(t, big.NewInt(0x100010001), Work(0x1d00ffff))
+	assert.Equal(t, big.NewInt(2), Work(0x207fffff))
+}
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"math/rand"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"deshev.com/bitcoin-handshake/btc/chain"
 	"deshev.com/bitcoin-handshake/btc/encoding"
 	"deshev.com/bitcoin-handshake/config"
 )
@@ -19,39 +22,128 @@ type BTCClient struct {
 	messageC chan encoding.Message
 
 	ctx         context.Context
+	cancel      context.CancelCauseFunc
 	log         *slog.Logger
+	network     encoding.Network
 	nodeAddress string
+	conn        net.Conn
 	reader      io.Reader
 	writer      io.Writer
+	writeMu     sync.Mutex
+	receiver    *encoding.Receiver
 
-	handShakeVersion bool
-	handShakeVerack  bool
+	pingInterval  time.Duration
+	pingTimeout   time.Duration
+	pingMu        sync.Mutex
+	pingTimer     *time.Timer
+	maxSoftErrors int
+	softErrors    int
+
+	dialTimeout      time.Duration
+	handshakeTimeout time.Duration
+	idleTimeout      time.Duration
+	writeTimeout     time.Duration
+	requestTimeout   time.Duration
+
+	outbound   chan outboundMessage
+	requestsMu sync.Mutex
+	requests   []*pendingRequest
+
+	state       *StateMachine
+	peer        *Peer
+	inbound     bool
+	established chan struct{}
+
+	headers *chain.HeaderChain
+	// Headers messages in a row that didn't connect to our chain.
+	unconnectedHeaders int
+	options            Options
+	compactBlocks      bool
+	// Shared with other clients, nil unless set by ShareHighBandwidthSlots.
+	highBandwidthSlots *HighBandwidthSlots
+	highBandwidth      bool
 }
 
 const messageBufferSize = 10
 
-func New(ctx context.Context, log *slog.Logger, cfg *config.Config) *BTCClient {
-	return &BTCClient{
-		nodeAddress: cfg.BTCNodeAddress,
-		ctx:         ctx,
-		log:         log,
-		messageC:    make(chan encoding.Message, messageBufferSize),
+func New(ctx context.Context, log *slog.Logger, cfg *config.Config, network encoding.Network) *BTCClient {
+	c := &BTCClient{
+		network:       network,
+		nodeAddress:   cfg.BTCNodeAddress,
+		log:           log,
+		messageC:      make(chan encoding.Message, messageBufferSize),
+		pingInterval:  cfg.PingInterval,
+		pingTimeout:   cfg.PingTimeout,
+		maxSoftErrors: cfg.MaxSoftErrors,
+		peer:          &Peer{},
+		receiver:      encoding.NewReceiver(network),
+		established:   make(chan struct{}),
+		options:       OptionsFromConfig(cfg),
+		compactBlocks: cfg.CompactBlocks,
+
+		dialTimeout:      cfg.DialTimeout,
+		handshakeTimeout: cfg.HandshakeTimeout,
+		idleTimeout:      cfg.IdleTimeout,
+		writeTimeout:     cfg.WriteTimeout,
+		requestTimeout:   cfg.RequestTimeout,
+
+		outbound: make(chan outboundMessage, outboundQueueSize),
 	}
+	if cfg.MaxPayloadSize > 0 {
+		c.receiver.MaxPayloadSize = cfg.MaxPayloadSize
+	}
+	c.ctx, c.cancel = context.WithCancelCause(ctx)
+	c.state = NewStateMachine(c.logTransition)
+	return c
+}
+
+func (c *BTCClient) State() PeerState {
+	return c.state.State()
+}
+
+func (c *BTCClient) Peer() *Peer {
+	return c.peer
+}
+
+// Established is closed once the handshake completes.
+func (c *BTCClient) Established() <-chan struct{} {
+	return c.established
+}
+
+// Done is closed when the client starts shutting down.
+func (c *BTCClient) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// Disconnect drops the connection. The reason is reported by Err.
+func (c *BTCClient) Disconnect(reason error) {
+	c.disconnect(reason)
+}
+
+// Err returns the reason the client got disconnected or nil while it is still
+// running.
+func (c *BTCClient) Err() error {
+	return context.Cause(c.ctx)
 }
 
 func (c *BTCClient) Connect() (<-chan encoding.Message, error) {
-	c.log.Info("connecting to bitcoin node", "address", c.nodeAddress)
+	address, err := AddressWithPort(c.nodeAddress, c.network)
+	if err != nil {
+		return nil, err
+	}
+	c.nodeAddress = address
+	c.log.Info("connecting to bitcoin node", "address", c.nodeAddress, "network", c.network.String())
 
-	dialer := net.Dialer{}
+	dialer := net.Dialer{Timeout: c.dialTimeout}
 	conn, err := dialer.DialContext(c.ctx, "tcp", c.nodeAddress)
+	if isTimeout(err) {
+		return nil, fmt.Errorf("%w: %s after %s: %w", ErrDialTimeout, c.nodeAddress, c.dialTimeout, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to bitcoin node: %w", err)
 	}
 
-	c.reader = conn
-	c.writer = conn
-	go c.cleanup(conn)
-	go c.receiveMessages()
+	c.start(conn)
 
 	err = c.startHandshake()
 	if err != nil {
@@ -61,98 +153,313 @@ func (c *BTCClient) Connect() (<-chan encoding.Message, error) {
 	return c.messageC, nil
 }
 
+// Accept runs the responder side of the handshake on a connection accepted
+// from a remote peer: we wait for its version and answer with ours.
+func (c *BTCClient) Accept(conn net.Conn) (<-chan encoding.Message, error) {
+	c.inbound = true
+	c.nodeAddress = conn.RemoteAddr().String()
+	c.log.Info("accepted bitcoin peer", "address", c.nodeAddress, "network", c.network.String())
+
+	err := c.state.Transition(StateAccepted)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.start(conn)
+
+	return c.messageC, nil
+}
+
+// Address returns the address of the remote peer.
+func (c *BTCClient) Address() string {
+	return c.nodeAddress
+}
+
+// Inbound reports whether the remote peer opened the connection.
+func (c *BTCClient) Inbound() bool {
+	return c.inbound
+}
+
+func (c *BTCClient) start(conn net.Conn) {
+	c.conn = conn
+	c.reader = conn
+	c.writer = conn
+	c.startHandshakeTimer()
+	go c.cleanup(conn)
+	go c.writeMessages()
+	go c.receiveMessages()
+}
+
 func (c *BTCClient) startHandshake() error {
-	version, err := c.createConnectMessage()
+	// Move to the next state before sending, so we are ready for the response.
+	err := c.state.Transition(StateVersionSent)
+	if err != nil {
+		return err
+	}
+	return c.sendVersion()
+}
+
+func (c *BTCClient) sendVersion() error {
+	version, err := c.createVersionMessage()
 	if err != nil {
 		return errors.Wrap(err, "failed to create version message")
 	}
+	c.peer.setLocalNonce(uint64(version.Nonce))
+	sentNonces.add(uint64(version.Nonce))
 
 	c.log.Info("sending handshake version message")
-	err = encoding.SendMessage(encoding.NetworkRegtest, version, c.writer)
+	err = c.send(version)
 	if err != nil {
 		return errors.Wrap(err, "failed sending version")
 	}
-
 	return nil
 }
 
 func (c *BTCClient) receiveMessages() {
+	defer c.shutdown()
 	for {
-		_, msg, err := encoding.ReceiveMessage(c.reader)
+		err := c.setReadDeadline()
 		if err != nil {
-			c.log.Error("failed receiving message", "error", err)
-			close(c.messageC)
+			c.disconnect(fmt.Errorf("failed setting read deadline: %w", err))
 			return
 		}
+		header, msg, err := c.receiver.Receive(c.reader)
+		if isTimeout(err) {
+			err = fmt.Errorf("%w: no message for %s: %w", ErrIdleTimeout, c.idleTimeout, err)
+		}
+		if err != nil {
+			err = c.handleMessageError(classifyReceiveError(header, err))
+			if err != nil {
+				c.disconnect(fmt.Errorf("failed receiving message: %w", err))
+				return
+			}
+			continue
+		}
 		err = c.processMessage(msg)
 		if err != nil {
-			c.log.Error("failed processing message", "error", err)
-			close(c.messageC)
-			return
+			err = c.handleMessageError(err)
+			if err != nil {
+				c.disconnect(fmt.Errorf("failed processing message: %w", err))
+				return
+			}
 		}
 	}
 }
 
 func (c *BTCClient) processMessage(msg encoding.Message) error {
-	switch msg.GetCommand() {
+	command := msg.GetCommand()
+	if !c.state.Allows(command) {
+		return c.unexpectedMessageError(command)
+	}
+
+	switch command {
 	case encoding.VersionCommand:
-		if c.handShakeVersion {
-			return errors.New("received duplicate version message")
+		return c.handleVersion(msg)
+	case encoding.VerackCommand:
+		return c.handleVerack()
+	case encoding.WTxIDRelayCommand, encoding.SendAddrV2Command, encoding.SendHeadersCommand,
+		encoding.FeeFilterCommand, encoding.SendCmpctCommand:
+		return c.handleFeature(msg)
+	case encoding.PingCommand:
+		return c.handlePing(msg)
+	case encoding.PongCommand:
+		return c.handlePong(msg)
+	case encoding.HeadersCommand:
+		if c.headers != nil {
+			// A getheaders request gets its answer, but the headers still
+			// go into our chain. Other headers messages can announce new
+			// blocks, so the application gets them once they are in.
+			answered := c.answerRequest(msg)
+			err := c.handleHeaders(msg)
+			if err != nil || answered {
+				return err
+			}
+		}
+		c.forward(msg)
+	case encoding.InvCommand:
+		c.forward(msg)
+		if c.headers != nil {
+			return c.handleBlockInv(msg)
+		}
+	default:
+		c.forward(msg)
+	}
+	return nil
+}
+
+// Hands a message we don't handle internally to the application, unless it
+// answers one of our pending requests.
+func (c *BTCClient) forward(msg encoding.Message) {
+	if c.answerRequest(msg) {
+		return
+	}
+	c.log.Debug("received message", "command", string(msg.GetCommand()), "state", c.state.State().String())
+	c.messageC <- msg
+}
+
+func (c *BTCClient) handleVersion(msg encoding.Message) error {
+	version, ok := msg.(*encoding.MsgVersion)
+	if !ok {
+		return fmt.Errorf("unexpected version message type: %T", msg)
+	}
+	c.log.Info("received handshake version message")
+	// Versions before 106 have no nonce.
+	if version.Nonce != 0 && sentNonces.contains(uint64(version.Nonce)) {
+		return fmt.Errorf("%w: peer sent our version nonce %d", ErrSelfConnection, version.Nonce)
+	}
+	c.peer.setRemoteVersion(version)
+	// The receiver runs on this goroutine.
+	c.receiver.ProtocolVersion = c.peer.ProtocolVersion()
+	err := c.state.Transition(StateVersionReceived)
+	if err != nil {
+		return err
+	}
+
+	// Inbound peers spoke first, answer with our version.
+	if c.inbound {
+		err = c.sendVersion()
+		if err != nil {
+			return err
 		}
-		c.handShakeVersion = true
-		c.log.Info("received handshake version message")
+	}
 
-		verack, err := encoding.NewVerackMsg()
+	err = c.sendHandshakeFeatures()
+	if err != nil {
+		return err
+	}
+
+	verack, err := encoding.NewVerackMsg()
+	if err != nil {
+		return errors.Wrap(err, "failed to create verack message")
+	}
+	c.log.Info("sending handshake verack message")
+	err = c.send(verack)
+	if err != nil {
+		return errors.Wrap(err, "failed sending verack message")
+	}
+	return nil
+}
+
+func (c *BTCClient) handleVerack() error {
+	c.log.Info("received handshake verack message")
+	err := c.state.Transition(StateEstablished)
+	if err != nil {
+		return err
+	}
+	close(c.established)
+	go c.keepAlive()
+
+	// Ask outbound peers for addresses once, the answer is forwarded like any
+	// other message. Like Bitcoin Core, we don't ask inbound peers, anyone can
+	// connect to us and feed us their addresses.
+	if !c.inbound {
+		getAddr, err := encoding.NewGetAddrMsg()
 		if err != nil {
-			return errors.Wrap(err, "failed to create verack message")
+			return errors.Wrap(err, "failed to create getaddr message")
 		}
-		c.log.Info("sending handshake verack message")
-		err = encoding.SendMessage(encoding.NetworkRegtest, verack, c.writer)
+		err = c.send(getAddr)
 		if err != nil {
-			return errors.Wrap(err, "failed sending verack message")
+			return errors.Wrap(err, "failed sending getaddr message")
 		}
-	case encoding.VerackCommand:
-		if c.handShakeVerack {
-			return errors.New("received duplicate verack message")
+	}
+	err = c.sendEstablishedFeatures()
+	if err != nil {
+		return err
+	}
+
+	if c.headers != nil {
+		return c.requestHeaders()
+	}
+	return nil
+}
+
+func (c *BTCClient) unexpectedMessageError(command encoding.Command) error {
+	state := c.state.State()
+	switch {
+	case command == encoding.VersionCommand && state >= StateVersionReceived:
+		return &MessageError{
+			Command: command,
+			Code:    encoding.RejectDuplicate,
+			Reason:  "received duplicate version message",
 		}
-		c.handShakeVerack = true
-		c.log.Info("received handshake verack message")
-	default:
-		handshakeDone := c.handShakeVersion && c.handShakeVerack
-		if !handshakeDone {
-			return fmt.Errorf("received unexpected message before completing handshake: %s", msg.GetCommand())
+	case command == encoding.VerackCommand && state == StateEstablished:
+		return &MessageError{
+			Command: command,
+			Code:    encoding.RejectDuplicate,
+			Reason:  "received duplicate verack message",
 		}
-		c.log.Debug("received message", "command", string(msg.GetCommand()), "handshake_done", handshakeDone)
-		c.messageC <- msg
+	case state < StateEstablished:
+		return fmt.Errorf("received unexpected message before completing handshake: %s", command)
+	default:
+		return fmt.Errorf("received unexpected message in state %s: %s", state, command)
 	}
-	return nil
 }
 
-func (c *BTCClient) createConnectMessage() (encoding.Message, error) {
-	addrFrom, err := encoding.NewIP4Address(0, "0.0.0.0:0")
+func (c *BTCClient) send(msg encoding.Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	err := c.setWriteDeadline()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create from address")
+		return errors.Wrap(err, "failed setting write deadline")
 	}
-	addrRecv, err := encoding.NewIP4Address(0, c.nodeAddress)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create recv address")
+	err = encoding.SendMessage(c.network, msg, c.writer)
+	if isTimeout(err) {
+		return fmt.Errorf("%w: %s message after %s: %w", ErrWriteTimeout, msg.GetCommand(), c.writeTimeout, err)
+	}
+	return err
+}
+
+// AddressWithPort adds the default network port to addresses that don't
+// specify one.
+func AddressWithPort(address string, network encoding.Network) (string, error) {
+	_, _, err := net.SplitHostPort(address)
+	if err == nil {
+		return address, nil
 	}
-	version, err := encoding.NewVersionMsg(
-		time.Now(),
-		0,
-		addrRecv,
-		addrFrom,
-		uint64(rand.Int63()), //nolint:gosec // not a crypto random
-		1,
-	)
+	port, err := network.DefaultPort()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create version message")
+		return "", err
 	}
-	return version, nil
+	// JoinHostPort adds the brackets of IPv6 hosts itself.
+	host := strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// Drops the connection, recording the reason that is later reported by Err.
+func (c *BTCClient) disconnect(reason error) {
+	c.log.Error("disconnecting peer", "error", reason)
+	c.cancel(reason)
 }
 
 func (c *BTCClient) cleanup(conn net.Conn) {
 	<-c.ctx.Done()
 	c.log.Info("terminating client")
+	c.markClosing()
 	conn.Close()
 }
+
+func (c *BTCClient) shutdown() {
+	close(c.messageC)
+	c.stopPingTimer()
+	sentNonces.remove(c.peer.LocalNonce())
+	c.releaseHighBandwidth()
+	c.markClosing()
+	err := c.state.Transition(StateClosed)
+	if err != nil {
+		c.log.Error("failed closing peer state", "error", err)
+	}
+}
+
+func (c *BTCClient) markClosing() {
+	if c.state.State() >= StateClosing {
+		return
+	}
+	err := c.state.Transition(StateClosing)
+	if err != nil {
+		c.log.Debug("failed moving peer to closing state", "error", err)
+	}
+}
+
+func (c *BTCClient) logTransition(from, to PeerState) {
+	c.log.Debug("peer state transition", "from", from.String(), "to", to.String())
+}
@@ -3,11 +3,14 @@ package client
 import (
 	"bytes"
 	"context"
+	"io"
 	"log/slog"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"deshev.com/bitcoin-handshake/btc/encoding"
 	"deshev.com/bitcoin-handshake/config"
@@ -36,7 +39,7 @@ func Test_Client_Connect_and_Cleanup(t *testing.T) {
 	log := slog.Default()
 	ctx, cancel := context.WithCancel(context.Background())
 
-	c := New(ctx, log, cfg)
+	c := New(ctx, log, cfg, encoding.NetworkRegtest)
 	messageC, err := c.Connect()
 	assert.NoError(t, err)
 	assert.NotNil(t, messageC)
@@ -46,34 +49,97 @@ func Test_Client_Connect_and_Cleanup(t *testing.T) {
 	assert.False(t, stillOpen)
 }
 
+func Test_Client_WrongNetwork(t *testing.T) {
+	address := startFakePeer(t, func(conn net.Conn) {
+		_, _, err := encoding.ReceiveMessage(encoding.NetworkSignet, conn)
+		require.NoError(t, err)
+		addr, err := encoding.NewIP4Address(encoding.ServicesNone, "0.0.0.0:0")
+		require.NoError(t, err)
+		version, err := encoding.NewVersionMsg(time.Now(), encoding.ServicesNone, addr, addr, 1, 1)
+		require.NoError(t, err)
+		_ = encoding.SendMessage(encoding.NetworkMainnet, version, conn)
+	})
+
+	cfg := &config.Config{BTCNodeAddress: address}
+	c := New(context.Background(), slog.Default(), cfg, encoding.NetworkSignet)
+	messageC, err := c.Connect()
+	require.NoError(t, err)
+
+	for range messageC {
+	}
+	assert.ErrorIs(t, c.Err(), encoding.ErrWrongMagic)
+}
+
+func Test_AddressWithPort(t *testing.T) {
+	tests := []struct {
+		address string
+		network encoding.Network
+		want    string
+	}{
+		{address: "localhost", network: encoding.NetworkRegtest, want: "localhost:18444"},
+		{address: "10.0.0.1", network: encoding.NetworkMainnet, want: "10.0.0.1:8333"},
+		{address: "::1", network: encoding.NetworkSignet, want: "[::1]:38333"},
+		{address: "[::1]", network: encoding.NetworkRegtest, want: "[::1]:18444"},
+		{address: "[::1]:1234", network: encoding.NetworkRegtest, want: "[::1]:1234"},
+		{address: "node:1234", network: encoding.NetworkTestnet4, want: "node:1234"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, err := AddressWithPort(tt.address, tt.network)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_Client_HandshakeMessages(t *testing.T) {
+	c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+	writer := bytes.NewBuffer(nil)
+	c.writer = writer
+	require.NoError(t, c.state.Transition(StateVersionSent))
+
+	require.NoError(t, c.processMessage(&encoding.MsgVersion{}))
+	require.NoError(t, c.processMessage(&encoding.MsgSendAddrV2{}))
+	require.NoError(t, c.processMessage(&encoding.MsgVerack{}))
+
+	var sent []encoding.Command
+	for writer.Len() > 0 {
+		_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, writer)
+		require.NoError(t, err)
+		sent = append(sent, msg.GetCommand())
+	}
+	assert.Equal(t, []encoding.Command{
+		encoding.SendAddrV2Command,
+		encoding.VerackCommand,
+		encoding.GetAddrCommand,
+	}, sent)
+}
+
 func Test_Client_HandshakeStates(t *testing.T) {
 	cfg := config.New()
 	log := slog.Default()
 	ctx := context.Background()
-	pingCommand := [12]byte{}
-	copy(pingCommand[:], "ping")
+	alertCommand := [12]byte{}
+	copy(alertCommand[:], "alert")
 
 	tests := []struct {
-		name                 string
-		messages             []encoding.Message
-		wantHandShakeVersion bool
-		wantHandShakeVerack  bool
-		wantErr              string
-		wantAppMessages      []string
+		name            string
+		messages        []encoding.Message
+		wantState       PeerState
+		wantErr         string
+		wantAppMessages []string
 	}{
 		{
-			name:                 "initial state",
-			messages:             []encoding.Message{},
-			wantHandShakeVersion: false,
-			wantHandShakeVerack:  false,
+			name:      "initial state",
+			messages:  []encoding.Message{},
+			wantState: StateVersionSent,
 		},
 		{
 			name: "version message",
 			messages: []encoding.Message{
 				&encoding.MsgVersion{},
 			},
-			wantHandShakeVersion: true,
-			wantHandShakeVerack:  false,
+			wantState: StateVersionReceived,
 		},
 		{
 			name: "version and verack",
@@ -81,8 +147,7 @@ func Test_Client_HandshakeStates(t *testing.T) {
 				&encoding.MsgVersion{},
 				&encoding.MsgVerack{},
 			},
-			wantHandShakeVersion: true,
-			wantHandShakeVerack:  true,
+			wantState: StateEstablished,
 		},
 		{
 			name: "duplicate version",
@@ -90,9 +155,8 @@ func Test_Client_HandshakeStates(t *testing.T) {
 				&encoding.MsgVersion{},
 				&encoding.MsgVersion{},
 			},
-			wantHandShakeVersion: true,
-			wantHandShakeVerack:  false,
-			wantErr:              "received duplicate version message",
+			wantState: StateVersionReceived,
+			wantErr:   "received duplicate version message",
 		},
 		{
 			name: "duplicate verack",
@@ -101,32 +165,39 @@ func Test_Client_HandshakeStates(t *testing.T) {
 				&encoding.MsgVerack{},
 				&encoding.MsgVerack{},
 			},
-			wantHandShakeVersion: true,
-			wantHandShakeVerack:  true,
-			wantErr:              "received duplicate verack message",
+			wantState: StateEstablished,
+			wantErr:   "received duplicate verack message",
+		},
+		{
+			name: "app message before handshake",
+			messages: []encoding.Message{
+				&encoding.MsgVersion{},
+				&encoding.MsgRaw{Header: &encoding.Header{Command: alertCommand}},
+			},
+			wantState: StateVersionReceived,
+			wantErr:   "received unexpected message before completing handshake: alert",
 		},
 		{
 			name: "one app message after handshake",
 			messages: []encoding.Message{
 				&encoding.MsgVersion{},
 				&encoding.MsgVerack{},
-				&encoding.MsgRaw{Header: &encoding.Header{Command: pingCommand}},
+				&encoding.MsgRaw{Header: &encoding.Header{Command: alertCommand}},
 			},
-			wantHandShakeVersion: true,
-			wantHandShakeVerack:  true,
-			wantAppMessages:      []string{"ping"},
+			wantState:       StateEstablished,
+			wantAppMessages: []string{"alert"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := New(ctx, log, cfg)
+			c := New(ctx, log, cfg, encoding.NetworkRegtest)
 			c.writer = bytes.NewBuffer(nil)
 			c.reader = bytes.NewBuffer(nil)
 			c.messageC = make(chan encoding.Message, 5)
 
-			assert.False(t, c.handShakeVersion)
-			assert.False(t, c.handShakeVerack)
+			assert.Equal(t, StateDialing, c.State())
+			assert.NoError(t, c.state.Transition(StateVersionSent))
 
 			var err error
 			for _, message := range tt.messages {
@@ -141,8 +212,7 @@ func Test_Client_HandshakeStates(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 			}
-			assert.Equal(t, tt.wantHandShakeVersion, c.handShakeVersion)
-			assert.Equal(t, tt.wantHandShakeVerack, c.handShakeVerack)
+			assert.Equal(t, tt.wantState, c.State())
 
 			var appMessages []string
 			close(c.messageC)
@@ -153,3 +223,119 @@ func Test_Client_HandshakeStates(t *testing.T) {
 		})
 	}
 }
+
+func Test_Client_Accept(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	remote, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer remote.Close()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+
+	c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+	messageC, err := c.Accept(conn)
+	require.NoError(t, err)
+	assert.True(t, c.Inbound())
+	assert.Equal(t, remote.LocalAddr().String(), c.Address())
+
+	// The remote peer opens the handshake and we answer.
+	addr, err := encoding.NewIP4Address(encoding.ServicesNone, "0.0.0.0:0")
+	require.NoError(t, err)
+	version, err := encoding.NewVersionMsg(time.Now(), encoding.ServicesNone, addr, addr, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, encoding.SendMessage(encoding.NetworkRegtest, version, remote))
+
+	var commands []encoding.Command
+	for range 4 {
+		_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, remote)
+		require.NoError(t, err)
+		commands = append(commands, msg.GetCommand())
+	}
+	assert.Equal(t, []encoding.Command{
+		encoding.VersionCommand, encoding.WTxIDRelayCommand, encoding.SendAddrV2Command, encoding.VerackCommand,
+	}, commands)
+
+	require.NoError(t, encoding.SendMessage(encoding.NetworkRegtest, &encoding.MsgVerack{}, remote))
+	// We don't ask inbound peers for addresses, the pong is the next message.
+	require.NoError(t, encoding.SendMessage(encoding.NetworkRegtest, &encoding.MsgPing{Nonce: 1}, remote))
+	_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, remote)
+	require.NoError(t, err)
+	assert.Equal(t, encoding.PongCommand, msg.GetCommand())
+	assert.Equal(t, StateEstablished, c.State())
+
+	remote.Close()
+	for range messageC {
+	}
+	assert.Equal(t, StateClosed, c.State())
+}
+
+func Test_Client_NegotiatesProtocolVersion(t *testing.T) {
+	tests := []struct {
+		remote encoding.UInt32
+		want   uint32
+	}{
+		{remote: 60002, want: 60002},
+		{remote: encoding.ProtocolVersion, want: encoding.ProtocolVersion},
+		{remote: encoding.ProtocolVersion + 1, want: encoding.ProtocolVersion},
+	}
+	for _, tt := range tests {
+		c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+		c.writer = bytes.NewBuffer(nil)
+		require.NoError(t, c.state.Transition(StateVersionSent))
+		assert.Zero(t, c.Peer().ProtocolVersion())
+
+		require.NoError(t, c.processMessage(&encoding.MsgVersion{Version: tt.remote}))
+		assert.Equal(t, tt.want, c.Peer().ProtocolVersion())
+	}
+}
+
+// A message only our tests know.
+type msgCustom struct {
+	Value encoding.UInt32
+}
+
+func (msg *msgCustom) GetCommand() encoding.Command {
+	return "custom"
+}
+
+func (msg *msgCustom) Encode(writer io.Writer) error {
+	return msg.Value.Encode(writer)
+}
+
+func (msg *msgCustom) Decode(reader io.Reader) error {
+	return (&msg.Value).Decode(reader)
+}
+
+func Test_Client_CustomMessages(t *testing.T) {
+	registry := encoding.NewRegistry()
+	require.NoError(t, registry.Register("custom", func() encoding.Message { return &msgCustom{} }))
+
+	cfg := &config.Config{}
+	cfg.BTCNodeAddress = startFakePeer(t, func(conn net.Conn) {
+		acceptHandshake(t, conn)
+		_ = encoding.SendMessage(encoding.NetworkRegtest, &msgCustom{Value: 42}, conn)
+		_, _, _ = encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	c.SetRegistry(registry)
+	messageC, err := c.Connect()
+	require.NoError(t, err)
+
+	for {
+		select {
+		case msg := <-messageC:
+			if custom, ok := msg.(*msgCustom); ok {
+				assert.Equal(t, encoding.UInt32(42), custom.Value)
+				assert.Equal(t, encoding.ProtocolVersion, int(c.receiver.ProtocolVersion))
+				return
+			}
+		case <-time.After(time.Second):
+			require.FailNow(t, "custom message not received")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Features are the optional protocol features negotiated with the peer.
+type Features struct {
+	// Both sides announce and request transactions by wtxid (BIP339).
+	WTxIDRelay bool
+	// The peer accepts addrv2 messages (BIP155).
+	AddrV2 bool
+	// The peer wants new blocks announced with headers (BIP130).
+	SendHeaders bool
+	// The minimum fee rate of transactions the peer wants announced, in
+	// satoshis per 1000 virtual bytes (BIP133).
+	FeeFilter uint64
+	// The peer supports version 2 compact blocks and, with high bandwidth,
+	// wants them announced without an inv first (BIP152).
+	CompactBlocks         bool
+	CompactBlocksAnnounce bool
+}
+
+// Largest fee rate the peer can ask for, the total bitcoin supply in satoshis.
+const maxFeeFilter = 21_000_000 * 100_000_000
+
+// Sends the negotiation messages that have to go between version and verack.
+func (c *BTCClient) sendHandshakeFeatures() error {
+	if c.peer.ProtocolVersion() >= encoding.WTxIDRelayVersion {
+		wtxidRelay, err := encoding.NewWTxIDRelayMsg()
+		if err != nil {
+			return errors.Wrap(err, "failed to create wtxidrelay message")
+		}
+		err = c.send(wtxidRelay)
+		if err != nil {
+			return errors.Wrap(err, "failed sending wtxidrelay message")
+		}
+	}
+
+	// BIP155 requires sendaddrv2 to go between version and verack.
+	sendAddrV2, err := encoding.NewSendAddrV2Msg()
+	if err != nil {
+		return errors.Wrap(err, "failed to create sendaddrv2 message")
+	}
+	err = c.send(sendAddrV2)
+	if err != nil {
+		return errors.Wrap(err, "failed sending sendaddrv2 message")
+	}
+	return nil
+}
+
+// Asks for headers announcements if we sync headers and can take them, and
+// for compact block announcements when enabled, once the handshake is
+// complete.
+func (c *BTCClient) sendEstablishedFeatures() error {
+	version := c.peer.ProtocolVersion()
+	if c.headers != nil && version >= encoding.SendHeadersVersion {
+		sendHeaders, err := encoding.NewSendHeadersMsg()
+		if err != nil {
+			return errors.Wrap(err, "failed to create sendheaders message")
+		}
+		err = c.send(sendHeaders)
+		if err != nil {
+			return errors.Wrap(err, "failed sending sendheaders message")
+		}
+	}
+
+	// High bandwidth mode: the peer sends new blocks as cmpctblock right away,
+	// without an inv first. Peers without a free slot get low bandwidth mode.
+	if c.compactBlocks && version >= encoding.ShortIDsBlocksVersion {
+		sendCmpct, err := encoding.NewSendCmpctMsg(c.acquireHighBandwidth(), encoding.CmpctBlocksVersion)
+		if err != nil {
+			return errors.Wrap(err, "failed to create sendcmpct message")
+		}
+		err = c.send(sendCmpct)
+		if err != nil {
+			return errors.Wrap(err, "failed sending sendcmpct message")
+		}
+	}
+	return nil
+}
+
+// Records a negotiation message from the peer. The state machine makes sure
+// wtxidrelay and sendaddrv2 only arrive before verack.
+func (c *BTCClient) handleFeature(msg encoding.Message) error {
+	switch msg := msg.(type) {
+	case *encoding.MsgWTxIDRelay:
+		// Ignored from peers that are too old to know it, like Bitcoin Core does.
+		if c.peer.ProtocolVersion() < encoding.WTxIDRelayVersion {
+			return nil
+		}
+		c.log.Info("peer supports wtxid relay")
+		c.peer.updateFeatures(func(f *Features) { f.WTxIDRelay = true })
+	case *encoding.MsgSendAddrV2:
+		c.log.Info("peer supports addrv2 messages")
+		c.peer.updateFeatures(func(f *Features) { f.AddrV2 = true })
+	case *encoding.MsgSendHeaders:
+		c.log.Debug("peer wants headers announcements")
+		c.peer.updateFeatures(func(f *Features) { f.SendHeaders = true })
+	case *encoding.MsgFeeFilter:
+		if uint64(msg.FeeRate) > maxFeeFilter {
+			c.log.Debug("ignoring out of range fee filter", "fee_rate", uint64(msg.FeeRate))
+			return nil
+		}
+		c.peer.updateFeatures(func(f *Features) { f.FeeFilter = uint64(msg.FeeRate) })
+	case *encoding.MsgSendCmpct:
+		// Peers announce every version they support, we only speak version 2.
+		if msg.Version != encoding.CmpctBlocksVersion {
+			return nil
+		}
+		c.peer.updateFeatures(func(f *Features) {
+			f.CompactBlocks = true
+			f.CompactBlocksAnnounce = msg.Announce != 0
+		})
+	default:
+		return fmt.Errorf("unexpected feature message type: %T", msg)
+	}
+	return nil
+}
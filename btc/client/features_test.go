@@ -0,0 +1,129 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+func commands(messages []encoding.Message) []encoding.Command {
+	var result []encoding.Command
+	for _, msg := range messages {
+		result = append(result, msg.GetCommand())
+	}
+	return result
+}
+
+func Test_Client_NegotiatesFeatures(t *testing.T) {
+	c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+	writer := bytes.NewBuffer(nil)
+	c.writer = writer
+	require.NoError(t, c.state.Transition(StateVersionSent))
+
+	for _, msg := range []encoding.Message{
+		&encoding.MsgVersion{Version: encoding.ProtocolVersion},
+		&encoding.MsgWTxIDRelay{},
+		&encoding.MsgSendAddrV2{},
+		&encoding.MsgVerack{},
+		&encoding.MsgSendHeaders{},
+		&encoding.MsgFeeFilter{FeeRate: 1000},
+		&encoding.MsgSendCmpct{Announce: 1, Version: encoding.CmpctBlocksVersion},
+		// Unsupported compact block versions don't change the negotiated one.
+		&encoding.MsgSendCmpct{Announce: 0, Version: 1},
+	} {
+		require.NoError(t, c.processMessage(msg))
+	}
+
+	assert.Equal(t, Features{
+		WTxIDRelay:            true,
+		AddrV2:                true,
+		SendHeaders:           true,
+		FeeFilter:             1000,
+		CompactBlocks:         true,
+		CompactBlocksAnnounce: true,
+	}, c.Peer().Features())
+	assert.Equal(t, []encoding.Command{
+		encoding.WTxIDRelayCommand,
+		encoding.SendAddrV2Command,
+		encoding.VerackCommand,
+		encoding.GetAddrCommand,
+	}, commands(sentMessages(t, writer)))
+
+	// Handshake features can't be negotiated after verack.
+	err := c.processMessage(&encoding.MsgWTxIDRelay{})
+	assert.ErrorContains(t, err, "received unexpected message in state established: wtxidrelay")
+}
+
+func Test_Client_Features_OldPeer(t *testing.T) {
+	c, writer := newSyncingClient(t)
+	require.NoError(t, c.state.Transition(StateVersionSent))
+
+	require.NoError(t, c.processMessage(&encoding.MsgVersion{Version: encoding.WTxIDRelayVersion - 1}))
+	require.NoError(t, c.processMessage(&encoding.MsgWTxIDRelay{}))
+	require.NoError(t, c.processMessage(&encoding.MsgVerack{}))
+
+	assert.False(t, c.Peer().Features().WTxIDRelay)
+	// No wtxidrelay for a peer that doesn't know it, but sendheaders since we
+	// sync headers.
+	assert.Equal(t, []encoding.Command{
+		encoding.SendAddrV2Command,
+		encoding.VerackCommand,
+		encoding.GetAddrCommand,
+		encoding.SendHeadersCommand,
+		encoding.GetHeadersCommand,
+	}, commands(sentMessages(t, writer)))
+}
+
+func Test_Client_Features_IgnoresBadFeeFilter(t *testing.T) {
+	c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+	require.NoError(t, c.handleFeature(&encoding.MsgFeeFilter{FeeRate: 1000}))
+	require.NoError(t, c.handleFeature(&encoding.MsgFeeFilter{FeeRate: maxFeeFilter + 1}))
+	assert.Equal(t, uint64(1000), c.Peer().Features().FeeFilter)
+}
+
+func Test_Client_Features_RequestsCompactBlocks(t *testing.T) {
+	c := New(context.Background(), slog.Default(), &config.Config{CompactBlocks: true}, encoding.NetworkRegtest)
+	writer := bytes.NewBuffer(nil)
+	c.writer = writer
+	require.NoError(t, c.state.Transition(StateVersionSent))
+
+	require.NoError(t, c.processMessage(&encoding.MsgVersion{Version: encoding.ProtocolVersion}))
+	require.NoError(t, c.processMessage(&encoding.MsgVerack{}))
+
+	sent := sentMessages(t, writer)
+	require.NotEmpty(t, sent)
+	assert.Equal(t, &encoding.MsgSendCmpct{Announce: 1, Version: encoding.CmpctBlocksVersion}, sent[len(sent)-1])
+}
+
+func Test_Client_Features_LimitsHighBandwidthPeers(t *testing.T) {
+	slots := NewHighBandwidthSlots(1)
+	handshake := func() (*BTCClient, encoding.Message) {
+		c := New(context.Background(), slog.Default(), &config.Config{CompactBlocks: true}, encoding.NetworkRegtest)
+		c.ShareHighBandwidthSlots(slots)
+		writer := bytes.NewBuffer(nil)
+		c.writer = writer
+		require.NoError(t, c.state.Transition(StateVersionSent))
+		require.NoError(t, c.processMessage(&encoding.MsgVersion{Version: encoding.ProtocolVersion}))
+		require.NoError(t, c.processMessage(&encoding.MsgVerack{}))
+		sent := sentMessages(t, writer)
+		require.NotEmpty(t, sent)
+		return c, sent[len(sent)-1]
+	}
+
+	first, sendCmpct := handshake()
+	assert.Equal(t, &encoding.MsgSendCmpct{Announce: 1, Version: encoding.CmpctBlocksVersion}, sendCmpct)
+	_, sendCmpct = handshake()
+	assert.Equal(t, &encoding.MsgSendCmpct{Announce: 0, Version: encoding.CmpctBlocksVersion}, sendCmpct)
+
+	// The slot is free again once the first peer is gone.
+	first.releaseHighBandwidth()
+	_, sendCmpct = handshake()
+	assert.Equal(t, &encoding.MsgSendCmpct{Announce: 1, Version: encoding.CmpctBlocksVersion}, sendCmpct)
+}
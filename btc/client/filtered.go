@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/bloom"
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Collects the answer to a filtered block request: the merkleblock and then
+// a tx message for each transaction it proves.
+type filteredBlock struct {
+	hash        encoding.Hash
+	merkleBlock *encoding.MsgMerkleBlock
+	notFound    bool
+	err         error
+	waiting     map[encoding.Hash]bool
+	txs         []*encoding.MsgTx
+}
+
+func (f *filteredBlock) match(msg encoding.Message) bool {
+	switch msg := msg.(type) {
+	case *encoding.MsgMerkleBlock:
+		if f.merkleBlock != nil || msg.Header.Hash() != f.hash {
+			return false
+		}
+		f.merkleBlock = msg
+		matches, err := bloom.ExtractMatches(msg)
+		f.err = err
+		f.waiting = map[encoding.Hash]bool{}
+		for _, txid := range matches {
+			f.waiting[txid] = true
+		}
+		return true
+	case *encoding.MsgTx:
+		txid := msg.TxHash()
+		if !f.waiting[txid] {
+			return false
+		}
+		delete(f.waiting, txid)
+		f.txs = append(f.txs, msg)
+		return true
+	case *encoding.MsgNotFound:
+		for _, vect := range msg.Inventory {
+			if f.merkleBlock == nil && vect.Hash == f.hash {
+				f.notFound = true
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func (f *filteredBlock) done() bool {
+	return f.notFound || f.err != nil || (f.merkleBlock != nil && len(f.waiting) == 0)
+}
+
+// RequestFilteredBlock asks for a block filtered by the bloom filter loaded
+// with filterload (BIP37). It verifies the merkleblock proof against the
+// header and waits for the proven transactions, which the peer sends right
+// after it.
+func (c *BTCClient) RequestFilteredBlock(ctx context.Context, blockHash encoding.Hash) (*encoding.MsgMerkleBlock, []*encoding.MsgTx, error) {
+	getData, err := encoding.NewGetDataMsg([]encoding.InvVect{{Type: encoding.InvTypeFilteredBlock, Hash: blockHash}})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create getdata message")
+	}
+	filtered := &filteredBlock{hash: blockHash}
+	request := &pendingRequest{match: filtered.match, done: filtered.done, response: make(chan encoding.Message, 1)}
+	_, err = c.request(ctx, getData, request)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The collector is only written before the response is delivered.
+	if filtered.notFound {
+		return nil, nil, fmt.Errorf("%w: filtered block %s", ErrRequestNotFound, blockHash)
+	}
+	if filtered.err != nil {
+		return nil, nil, fmt.Errorf("bad merkleblock %s from peer: %w", blockHash, filtered.err)
+	}
+	return filtered.merkleBlock, filtered.txs, nil
+}
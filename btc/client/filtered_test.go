@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+func Test_Client_RequestFilteredBlock(t *testing.T) {
+	matched, other := testTx(), testTx()
+	other.LockTime = 1
+	txids := []encoding.Hash{matched.TxHash(), other.TxHash()}
+	// Root, matched left leaf, unmatched right leaf.
+	merkleBlock := &encoding.MsgMerkleBlock{
+		Header:            encoding.BlockHeader{MerkleRoot: encoding.DoubleSHA256(append(txids[0][:], txids[1][:]...))},
+		TotalTransactions: 2,
+		Hashes:            txids,
+		Flags:             encoding.VarBytes{0x03},
+	}
+	blockHash := merkleBlock.Header.Hash()
+
+	c := connectServingPeer(t, &config.Config{RequestTimeout: time.Second}, func(conn net.Conn, msg encoding.Message) {
+		getData, ok := msg.(*encoding.MsgGetData)
+		if !ok {
+			return
+		}
+		if getData.Inventory[0].Hash != blockHash {
+			_ = encoding.SendMessage(encoding.NetworkRegtest, &encoding.MsgNotFound{Inventory: getData.Inventory}, conn)
+			return
+		}
+		_ = encoding.SendMessage(encoding.NetworkRegtest, merkleBlock, conn)
+		_ = encoding.SendMessage(encoding.NetworkRegtest, matched, conn)
+	})
+
+	got, txs, err := c.RequestFilteredBlock(context.Background(), blockHash)
+	require.NoError(t, err)
+	assert.Equal(t, merkleBlock, got)
+	require.Len(t, txs, 1)
+	assert.Equal(t, matched.TxHash(), txs[0].TxHash())
+
+	_, _, err = c.RequestFilteredBlock(context.Background(), encoding.Hash{1})
+	assert.ErrorIs(t, err, ErrRequestNotFound)
+}
+
+func Test_FilteredBlock_BadProof(t *testing.T) {
+	merkleBlock := &encoding.MsgMerkleBlock{
+		TotalTransactions: 1,
+		Hashes:            []encoding.Hash{{1}},
+		Flags:             encoding.VarBytes{0x01},
+	}
+	filtered := &filteredBlock{hash: merkleBlock.Header.Hash()}
+	assert.True(t, filtered.match(merkleBlock))
+	assert.True(t, filtered.done())
+	assert.Error(t, filtered.err)
+}
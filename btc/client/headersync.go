@@ -0,0 +1,106 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/chain"
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// SyncHeaders makes the client download and validate block headers into the
+// given chain once the handshake is complete. It has to be called before
+// Connect. The chain is owned by the caller, so it survives reconnects.
+func (c *BTCClient) SyncHeaders(headers *chain.HeaderChain) {
+	c.headers = headers
+}
+
+// Headers returns the chain the client syncs into or nil if header sync is
+// disabled.
+func (c *BTCClient) Headers() *chain.HeaderChain {
+	return c.headers
+}
+
+// How many headers messages in a row may fail to connect to our chain before
+// we stop asking for the gap, like MAX_NUM_UNCONNECTING_HEADERS_MSGS in
+// Bitcoin Core. Otherwise a peer could keep us requesting headers forever.
+const maxUnconnectedHeaders = 10
+
+// Asks for the headers following our best tip. The peer answers with up to
+// MaxHeadersResults headers.
+func (c *BTCClient) requestHeaders() error {
+	getHeaders, err := encoding.NewGetHeadersMsg(c.headers.Locator(), encoding.Hash{})
+	if err != nil {
+		return errors.Wrap(err, "failed to create getheaders message")
+	}
+	_, height := c.headers.Best()
+	c.log.Debug("requesting headers", "height", height)
+	err = c.send(getHeaders)
+	if err != nil {
+		return errors.Wrap(err, "failed sending getheaders message")
+	}
+	return nil
+}
+
+func (c *BTCClient) handleHeaders(msg encoding.Message) error {
+	headers, ok := msg.(*encoding.MsgHeaders)
+	if !ok {
+		return fmt.Errorf("unexpected headers message type: %T", msg)
+	}
+	if len(headers.Headers) == 0 {
+		return nil
+	}
+
+	err := c.headers.AddHeaders(headers.Headers)
+	switch {
+	case errors.Is(err, chain.ErrUnconnectedHeader):
+		// Usually a new block announcement on top of headers we don't have
+		// yet, ask for the gap.
+		c.unconnectedHeaders++
+		c.log.Debug("received unconnected headers", "error", err, "in_a_row", c.unconnectedHeaders)
+		if c.unconnectedHeaders > maxUnconnectedHeaders {
+			return &MessageError{
+				Command: encoding.HeadersCommand,
+				Code:    encoding.RejectInvalid,
+				Reason:  "too many unconnected headers",
+				Err:     err,
+			}
+		}
+		return c.requestHeaders()
+	case err != nil:
+		return &MessageError{
+			Command: encoding.HeadersCommand,
+			Code:    encoding.RejectInvalid,
+			Reason:  "invalid block header",
+			Err:     err,
+		}
+	}
+
+	c.unconnectedHeaders = 0
+	best, height := c.headers.Best()
+	c.log.Info("synced headers", "height", height, "best", best.Hash().String())
+
+	// A full batch means the peer has more headers for us.
+	if len(headers.Headers) == encoding.MaxHeadersResults {
+		return c.requestHeaders()
+	}
+	return nil
+}
+
+// Requests headers when the peer announces a block we don't know.
+func (c *BTCClient) handleBlockInv(msg encoding.Message) error {
+	inv, ok := msg.(*encoding.MsgInv)
+	if !ok {
+		return fmt.Errorf("unexpected inv message type: %T", msg)
+	}
+	for _, vect := range inv.Inventory {
+		if vect.Type&^encoding.InvWitnessFlag != encoding.InvTypeBlock {
+			continue
+		}
+		if !c.headers.Contains(vect.Hash) {
+			return c.requestHeaders()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/chain"
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+func newSyncingClient(t *testing.T) (*BTCClient, *bytes.Buffer) {
+	t.Helper()
+	params, err := chain.ParamsFor(encoding.NetworkRegtest)
+	require.NoError(t, err)
+	c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+	c.SyncHeaders(chain.NewHeaderChain(params))
+	writer := bytes.NewBuffer(nil)
+	c.writer = writer
+	return c, writer
+}
+
+func sentMessages(t *testing.T, writer *bytes.Buffer) []encoding.Message {
+	t.Helper()
+	var sent []encoding.Message
+	for writer.Len() > 0 {
+		_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, writer)
+		require.NoError(t, err)
+		sent = append(sent, msg)
+	}
+	return sent
+}
+
+// Mines regtest headers on top of the chain tip.
+func mineHeaders(t *testing.T, headers *chain.HeaderChain, count int) []encoding.BlockHeader {
+	t.Helper()
+	tip, _ := headers.Best()
+	target := chain.CompactToBig(uint32(tip.Bits))
+	result := make([]encoding.BlockHeader, 0, count)
+	for range count {
+		header := encoding.BlockHeader{
+			Version:   4,
+			PrevBlock: tip.Hash(),
+			Timestamp: tip.Timestamp + 600,
+			Bits:      tip.Bits,
+		}
+		for chain.HashToBig(header.Hash()).Cmp(target) > 0 {
+			header.Nonce++
+		}
+		result = append(result, header)
+		tip = header
+	}
+	return result
+}
+
+func Test_Client_HeaderSync_RequestsAfterHandshake(t *testing.T) {
+	c, writer := newSyncingClient(t)
+	require.NoError(t, c.state.Transition(StateVersionSent))
+
+	require.NoError(t, c.processMessage(&encoding.MsgVersion{}))
+	require.NoError(t, c.processMessage(&encoding.MsgVerack{}))
+
+	sent := sentMessages(t, writer)
+	require.NotEmpty(t, sent)
+	getHeaders, ok := sent[len(sent)-1].(*encoding.MsgGetHeaders)
+	require.True(t, ok, "got %T", sent[len(sent)-1])
+	genesis, _ := c.Headers().Best()
+	assert.Equal(t, []encoding.Hash{genesis.Hash()}, getHeaders.Locator)
+	assert.Equal(t, encoding.Hash{}, getHeaders.HashStop)
+}
+
+func Test_Client_HeaderSync_Headers(t *testing.T) {
+	c, writer := newSyncingClient(t)
+	headers := mineHeaders(t, c.Headers(), 3)
+
+	require.NoError(t, c.handleHeaders(&encoding.MsgHeaders{Headers: headers[:2]}))
+
+	best, height := c.Headers().Best()
+	assert.Equal(t, int32(2), height)
+	assert.Equal(t, headers[1], best)
+	assert.Empty(t, sentMessages(t, writer), "a partial batch ends the sync")
+
+	// A header on top of one we don't have triggers a new request.
+	require.NoError(t, c.handleHeaders(&encoding.MsgHeaders{Headers: headers[2:]}))
+	unconnected := mineHeaders(t, c.Headers(), 2)[1:]
+	require.NoError(t, c.handleHeaders(&encoding.MsgHeaders{Headers: unconnected}))
+	sent := sentMessages(t, writer)
+	require.Len(t, sent, 1)
+	assert.IsType(t, &encoding.MsgGetHeaders{}, sent[0])
+}
+
+func Test_Client_HeaderSync_FullBatch(t *testing.T) {
+	c, writer := newSyncingClient(t)
+	headers := mineHeaders(t, c.Headers(), encoding.MaxHeadersResults)
+
+	require.NoError(t, c.handleHeaders(&encoding.MsgHeaders{Headers: headers}))
+
+	_, height := c.Headers().Best()
+	assert.Equal(t, int32(encoding.MaxHeadersResults), height)
+	sent := sentMessages(t, writer)
+	require.Len(t, sent, 1)
+	getHeaders, ok := sent[0].(*encoding.MsgGetHeaders)
+	require.True(t, ok)
+	assert.Equal(t, headers[len(headers)-1].Hash(), getHeaders.Locator[0])
+}
+
+func Test_Client_HeaderSync_InvalidHeader(t *testing.T) {
+	c, _ := newSyncingClient(t)
+	headers := mineHeaders(t, c.Headers(), 1)
+	headers[0].Bits = 0x1d00ffff
+
+	err := c.handleHeaders(&encoding.MsgHeaders{Headers: headers})
+
+	var msgErr *MessageError
+	require.ErrorAs(t, err, &msgErr)
+	assert.Equal(t, encoding.RejectInvalid, msgErr.Code)
+	assert.Equal(t, encoding.HeadersCommand, msgErr.Command)
+	assert.ErrorIs(t, err, chain.ErrBadProofOfWork)
+}
+
+func Test_Client_HeaderSync_UnconnectedHeadersLimit(t *testing.T) {
+	c, writer := newSyncingClient(t)
+	c.maxSoftErrors = 1
+	unconnected := mineHeaders(t, c.Headers(), 2)[1:]
+
+	for range maxUnconnectedHeaders {
+		require.NoError(t, c.handleHeaders(&encoding.MsgHeaders{Headers: unconnected}))
+	}
+	assert.Len(t, sentMessages(t, writer), maxUnconnectedHeaders)
+
+	// Further ones aren't answered and count as bad messages.
+	err := c.handleHeaders(&encoding.MsgHeaders{Headers: unconnected})
+	var msgErr *MessageError
+	require.ErrorAs(t, err, &msgErr)
+	assert.ErrorIs(t, err, chain.ErrUnconnectedHeader)
+	assert.Empty(t, sentMessages(t, writer))
+	require.NoError(t, c.handleMessageError(err))
+	err = c.handleMessageError(c.handleHeaders(&encoding.MsgHeaders{Headers: unconnected}))
+	assert.ErrorIs(t, err, ErrTooManyBadMessages)
+
+	// Headers that connect start the count over.
+	c.unconnectedHeaders = maxUnconnectedHeaders
+	require.NoError(t, c.handleHeaders(&encoding.MsgHeaders{Headers: mineHeaders(t, c.Headers(), 1)}))
+	assert.Zero(t, c.unconnectedHeaders)
+}
+
+func Test_Client_HeaderSync_BlockInv(t *testing.T) {
+	c, writer := newSyncingClient(t)
+	require.NoError(t, c.state.Transition(StateVersionSent))
+	require.NoError(t, c.state.Transition(StateVersionReceived))
+	require.NoError(t, c.state.Transition(StateEstablished))
+	genesis, _ := c.Headers().Best()
+
+	known := &encoding.MsgInv{Inventory: encoding.InvList{{Type: encoding.InvTypeBlock, Hash: genesis.Hash()}}}
+	require.NoError(t, c.processMessage(known))
+	assert.Empty(t, sentMessages(t, writer))
+
+	unknown := &encoding.MsgInv{Inventory: encoding.InvList{
+		{Type: encoding.InvTypeTx, Hash: encoding.Hash{1}},
+		{Type: encoding.InvTypeWitnessBlock, Hash: encoding.Hash{2}},
+	}}
+	require.NoError(t, c.processMessage(unknown))
+	sent := sentMessages(t, writer)
+	require.Len(t, sent, 1)
+	assert.IsType(t, &encoding.MsgGetHeaders{}, sent[0])
+
+	// The inv is still handed to the application.
+	assert.Equal(t, known, <-c.messageC)
+	assert.Equal(t, unknown, <-c.messageC)
+}
+
+func Test_Client_HeaderSync_ForwardsAnnouncements(t *testing.T) {
+	c, _ := newSyncingClient(t)
+	require.NoError(t, c.state.Transition(StateVersionSent))
+	require.NoError(t, c.state.Transition(StateVersionReceived))
+	require.NoError(t, c.state.Transition(StateEstablished))
+	headers := mineHeaders(t, c.Headers(), 1)
+
+	announcement := &encoding.MsgHeaders{Headers: headers}
+	require.NoError(t, c.processMessage(announcement))
+
+	_, height := c.Headers().Best()
+	assert.Equal(t, int32(1), height)
+	assert.Equal(t, announcement, <-c.messageC)
+}
@@ -0,0 +1,59 @@
+package client
+
+import "sync"
+
+// BIP152 asks nodes to request high bandwidth compact blocks from at most
+// three peers.
+const MaxHighBandwidthPeers = 3
+
+// HighBandwidthSlots limits how many of a group of clients ask their peer for
+// high bandwidth compact blocks. The other peers get low bandwidth mode and
+// announce new blocks first.
+type HighBandwidthSlots struct {
+	mu   sync.Mutex
+	free int
+}
+
+func NewHighBandwidthSlots(count int) *HighBandwidthSlots {
+	return &HighBandwidthSlots{free: count}
+}
+
+func (s *HighBandwidthSlots) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.free == 0 {
+		return false
+	}
+	s.free--
+	return true
+}
+
+func (s *HighBandwidthSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.free++
+}
+
+// ShareHighBandwidthSlots makes the client take one of the slots before it
+// asks the peer for high bandwidth compact blocks, and give it back when it
+// disconnects. It has to be called before Connect or Accept. Without slots a
+// client with compact blocks enabled always asks for high bandwidth mode.
+func (c *BTCClient) ShareHighBandwidthSlots(slots *HighBandwidthSlots) {
+	c.highBandwidthSlots = slots
+}
+
+// Takes a slot if the client shares them. The slot is held until shutdown.
+func (c *BTCClient) acquireHighBandwidth() bool {
+	if c.highBandwidthSlots == nil {
+		return true
+	}
+	c.highBandwidth = c.highBandwidthSlots.acquire()
+	return c.highBandwidth
+}
+
+func (c *BTCClient) releaseHighBandwidth() {
+	if c.highBandwidth {
+		c.highBandwidth = false
+		c.highBandwidthSlots.release()
+	}
+}
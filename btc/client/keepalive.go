@@ -0,0 +1,121 @@
+package client
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+var ErrPingTimeout = errors.New("peer did not answer ping in time")
+
+// Sends pings on every interval tick while we are connected. We skip a tick if
+// the previous ping is still waiting for its pong. A zero interval disables
+// pings.
+func (c *BTCClient) keepAlive() {
+	if c.pingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		if !c.peer.pingPending() {
+			err := c.sendPing()
+			if err != nil {
+				c.disconnect(err)
+				return
+			}
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *BTCClient) sendPing() error {
+	nonce := rand.Uint64() //nolint:gosec // not a crypto random
+	ping, err := encoding.NewPingMsg(nonce)
+	if err != nil {
+		return errors.Wrap(err, "failed to create ping message")
+	}
+
+	c.peer.startPing(nonce, time.Now())
+	c.startPingTimer(nonce)
+
+	c.log.Debug("sending ping", "nonce", nonce)
+	err = c.send(ping)
+	if err != nil {
+		return errors.Wrap(err, "failed sending ping")
+	}
+	return nil
+}
+
+// Disconnects the peer unless the ping is answered in time. The pong and the
+// shutdown stop the timer, so it doesn't keep the client around.
+func (c *BTCClient) startPingTimer(nonce uint64) {
+	if c.pingTimeout <= 0 {
+		return
+	}
+	c.pingMu.Lock()
+	defer c.pingMu.Unlock()
+	// The shutdown already stopped the timer.
+	if c.ctx.Err() != nil {
+		return
+	}
+	c.pingTimer = time.AfterFunc(c.pingTimeout, func() {
+		if c.peer.pingOutstanding(nonce) {
+			c.disconnect(fmt.Errorf("%w: no pong after %s", ErrPingTimeout, c.pingTimeout))
+		}
+	})
+}
+
+func (c *BTCClient) stopPingTimer() {
+	c.pingMu.Lock()
+	defer c.pingMu.Unlock()
+	if c.pingTimer != nil {
+		c.pingTimer.Stop()
+		c.pingTimer = nil
+	}
+}
+
+func (c *BTCClient) handlePing(msg encoding.Message) error {
+	ping, ok := msg.(*encoding.MsgPing)
+	if !ok {
+		return fmt.Errorf("unexpected ping message type: %T", msg)
+	}
+	nonce := uint64(ping.Nonce)
+	c.peer.setLastPing(nonce, time.Now())
+
+	pong, err := encoding.NewPongMsg(nonce)
+	if err != nil {
+		return errors.Wrap(err, "failed to create pong message")
+	}
+	c.log.Debug("answering ping", "nonce", nonce)
+	err = c.send(pong)
+	if err != nil {
+		return errors.Wrap(err, "failed sending pong")
+	}
+	return nil
+}
+
+func (c *BTCClient) handlePong(msg encoding.Message) error {
+	pong, ok := msg.(*encoding.MsgPong)
+	if !ok {
+		return fmt.Errorf("unexpected pong message type: %T", msg)
+	}
+	rtt, ok := c.peer.finishPing(uint64(pong.Nonce), time.Now())
+	if !ok {
+		c.log.Debug("ignoring unexpected pong", "nonce", uint64(pong.Nonce))
+		return nil
+	}
+	c.stopPingTimer()
+	c.log.Debug("received pong", "rtt", rtt)
+	return nil
+}
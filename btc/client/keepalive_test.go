@@ -0,0 +1,177 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+func Test_Client_AnswersPing(t *testing.T) {
+	cfg := &config.Config{}
+	c := New(context.Background(), slog.Default(), cfg, encoding.NetworkRegtest)
+	writer := bytes.NewBuffer(nil)
+	c.writer = writer
+	assert.NoError(t, c.state.Transition(StateVersionSent))
+
+	messages := []encoding.Message{
+		&encoding.MsgVersion{},
+		&encoding.MsgVerack{},
+		&encoding.MsgPing{Nonce: 42},
+	}
+	for _, message := range messages {
+		assert.NoError(t, c.processMessage(message))
+	}
+
+	nonce, at := c.Peer().LastPing()
+	assert.Equal(t, uint64(42), nonce)
+	assert.False(t, at.IsZero())
+
+	var sent []encoding.Message
+	for writer.Len() > 0 {
+		_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, writer)
+		require.NoError(t, err)
+		sent = append(sent, msg)
+	}
+	require.NotEmpty(t, sent)
+	assert.Equal(t, &encoding.MsgPong{Nonce: 42}, sent[len(sent)-1])
+}
+
+func Test_Client_PongRTT(t *testing.T) {
+	c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+	c.peer.startPing(7, time.Now().Add(-time.Second))
+
+	assert.NoError(t, c.handlePong(&encoding.MsgPong{Nonce: 8}))
+	assert.True(t, c.peer.pingPending())
+	assert.Zero(t, c.Peer().PingRTT())
+
+	assert.NoError(t, c.handlePong(&encoding.MsgPong{Nonce: 7}))
+	assert.False(t, c.peer.pingPending())
+	assert.GreaterOrEqual(t, c.Peer().PingRTT(), time.Second)
+}
+
+func Test_Client_PingTimerStopped(t *testing.T) {
+	cfg := &config.Config{PingTimeout: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	c.writer = bytes.NewBuffer(nil)
+
+	require.NoError(t, c.sendPing())
+	require.NotNil(t, c.pingTimer)
+	require.NoError(t, c.handlePong(&encoding.MsgPong{Nonce: encoding.UInt64(c.peer.pendingPingNonce)}))
+	assert.Nil(t, c.pingTimer, "the pong stops the timer")
+
+	require.NoError(t, c.sendPing())
+	require.NotNil(t, c.pingTimer)
+	cancel()
+	c.shutdown()
+	assert.Nil(t, c.pingTimer, "the shutdown stops the timer")
+	require.NoError(t, c.sendPing())
+	assert.Nil(t, c.pingTimer, "no timer after the shutdown")
+}
+
+func Test_Client_PingTimeout(t *testing.T) {
+	address := startFakePeer(t, func(conn net.Conn) {
+		acceptHandshake(t, conn)
+		for {
+			// never answer pings
+			_, _, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	cfg := &config.Config{
+		BTCNodeAddress: address,
+		PingInterval:   10 * time.Millisecond,
+		PingTimeout:    50 * time.Millisecond,
+	}
+	c := New(context.Background(), slog.Default(), cfg, encoding.NetworkRegtest)
+	messageC, err := c.Connect()
+	require.NoError(t, err)
+
+	for range messageC {
+	}
+	assert.ErrorIs(t, c.Err(), ErrPingTimeout)
+	assert.Equal(t, StateClosed, c.State())
+}
+
+func Test_Client_PingAnswered(t *testing.T) {
+	address := startFakePeer(t, func(conn net.Conn) {
+		acceptHandshake(t, conn)
+		for {
+			_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+			if err != nil {
+				return
+			}
+			if ping, ok := msg.(*encoding.MsgPing); ok {
+				err = encoding.SendMessage(encoding.NetworkRegtest, &encoding.MsgPong{Nonce: ping.Nonce}, conn)
+				if err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	cfg := &config.Config{
+		BTCNodeAddress: address,
+		PingInterval:   10 * time.Millisecond,
+		PingTimeout:    time.Second,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	_, err := c.Connect()
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return c.Peer().PingRTT() > 0
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, c.Err())
+}
+
+// Starts a TCP listener on a random local port and runs the handler for the
+// first accepted connection.
+func startFakePeer(t *testing.T, handler func(conn net.Conn)) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handler(conn)
+	}()
+	return listener.Addr().String()
+}
+
+// Plays the remote side of the handshake: waits for our version and answers
+// with its own version and a verack.
+func acceptHandshake(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+	require.NoError(t, err)
+	require.Equal(t, encoding.VersionCommand, msg.GetCommand())
+
+	addr, err := encoding.NewIP4Address(encoding.ServicesNone, "0.0.0.0:0")
+	require.NoError(t, err)
+	version, err := encoding.NewVersionMsg(time.Now(), encoding.ServicesNone, addr, addr, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, encoding.SendMessage(encoding.NetworkRegtest, version, conn))
+	require.NoError(t, encoding.SendMessage(encoding.NetworkRegtest, &encoding.MsgVerack{}, conn))
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var ErrSelfConnection = errors.New("connected to ourselves")
+
+// Nonces of the version messages sent by all clients in this process. A peer
+// version carrying one of them means the connection looped back to us,
+// through our own server or a NAT.
+var sentNonces = &nonceSet{nonces: map[uint64]struct{}{}}
+
+type nonceSet struct {
+	mu     sync.RWMutex
+	nonces map[uint64]struct{}
+}
+
+func (s *nonceSet) add(nonce uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nonces[nonce] = struct{}{}
+}
+
+func (s *nonceSet) remove(nonce uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.nonces, nonce)
+}
+
+func (s *nonceSet) contains(nonce uint64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.nonces[nonce]
+	return ok
+}
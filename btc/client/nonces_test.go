@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+func Test_Client_SelfConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inboundC := make(chan *BTCClient, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		inbound := New(ctx, slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+		messageC, err := inbound.Accept(conn)
+		assert.NoError(t, err)
+		for range messageC {
+		}
+		inboundC <- inbound
+	}()
+
+	outbound := New(ctx, slog.Default(), &config.Config{BTCNodeAddress: listener.Addr().String()}, encoding.NetworkRegtest)
+	messageC, err := outbound.Connect()
+	require.NoError(t, err)
+	for range messageC {
+	}
+
+	// The inbound side sees our nonce first, the outbound side loses the
+	// connection or sees the inbound side's nonce.
+	inbound := <-inboundC
+	assert.ErrorIs(t, inbound.Err(), ErrSelfConnection)
+	assert.Error(t, outbound.Err())
+	assert.False(t, sentNonces.contains(outbound.Peer().LocalNonce()))
+}
+
+func Test_NonceSet(t *testing.T) {
+	s := &nonceSet{nonces: map[uint64]struct{}{}}
+	assert.False(t, s.contains(1))
+	s.add(1)
+	assert.True(t, s.contains(1))
+	s.remove(1)
+	assert.False(t, s.contains(1))
+}
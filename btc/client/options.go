@@ -0,0 +1,106 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+// Options controls what the client announces about itself in its version
+// message.
+type Options struct {
+	Services encoding.Services
+	// Added to our user agent as BIP14 comments.
+	UserAgentComments []string
+	StartHeight       uint32
+	// Whether the peer should announce transactions to us.
+	Relay bool
+}
+
+func OptionsFromConfig(cfg *config.Config) Options {
+	return Options{
+		Services:          encoding.Services(cfg.Services),
+		UserAgentComments: cfg.UserAgentComments,
+		StartHeight:       cfg.StartHeight,
+		Relay:             cfg.Relay,
+	}
+}
+
+// UserAgent returns our BIP14 user agent including the comments.
+func (o *Options) UserAgent() (string, error) {
+	return encoding.BuildUserAgent(encoding.ClientName, encoding.ClientVersion, o.UserAgentComments...)
+}
+
+// SetOptions replaces the options taken from the config. It has to be called
+// before Connect or Accept.
+func (c *BTCClient) SetOptions(options Options) {
+	c.options = options
+}
+
+// SetRegistry replaces the default message registry, e.g. to receive custom
+// messages. It has to be called before Connect or Accept.
+func (c *BTCClient) SetRegistry(registry *encoding.Registry) {
+	c.receiver.Registry = registry
+}
+
+func (c *BTCClient) createVersionMessage() (*encoding.MsgVersion, error) {
+	userAgent, err := c.options.UserAgent()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	// We don't know the services of outbound peers yet.
+	recvServices := encoding.ServicesNone
+	if remote := c.peer.RemoteVersion(); remote != nil {
+		recvServices = remote.Services
+	}
+	localAddress, remoteAddress := "0.0.0.0:0", c.nodeAddress
+	if c.conn != nil {
+		localAddress, remoteAddress = c.conn.LocalAddr().String(), c.conn.RemoteAddr().String()
+	}
+	addrRecv, err := encoding.NewNetworkAddress(recvServices, remoteAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create recv address")
+	}
+	addrFrom, err := encoding.NewNetworkAddress(c.options.Services, localAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create from address")
+	}
+
+	version, err := encoding.NewVersionMsg(
+		time.Now(),
+		c.options.Services,
+		addrRecv,
+		addrFrom,
+		nonce,
+		c.options.StartHeight,
+	)
+	if err != nil {
+		return nil, err
+	}
+	version.UserAgent = encoding.VarStr(userAgent)
+	if c.options.Relay {
+		version.Relay = 1
+	}
+	return version, nil
+}
+
+// The nonce lets nodes detect connections to themselves, so it should not be
+// predictable.
+func randomNonce() (uint64, error) {
+	var buf [8]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to generate nonce")
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
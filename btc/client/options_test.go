@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+func Test_Client_VersionMessage(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cfg := &config.Config{
+		Services:          uint64(encoding.ServicesNodeWitness | encoding.ServicesNodeNetworkLimited),
+		UserAgentComments: []string{"test", "regtest"},
+		StartHeight:       42,
+		Relay:             true,
+	}
+	c := New(context.Background(), slog.Default(), cfg, encoding.NetworkRegtest)
+	c.conn = conn
+
+	version, err := c.createVersionMessage()
+	require.NoError(t, err)
+	assert.Equal(t, encoding.ServicesNodeWitness|encoding.ServicesNodeNetworkLimited, version.Services)
+	assert.Equal(t, encoding.VarStr("/MemeClient:0.0.1(test; regtest)/"), version.UserAgent)
+	assert.Equal(t, encoding.UInt32(42), version.StartHeight)
+	assert.Equal(t, encoding.UInt8(1), version.Relay)
+	assert.Equal(t, conn.LocalAddr().String(), version.AddrFrom.String())
+	assert.Equal(t, conn.RemoteAddr().String(), version.AddrRecv.String())
+	assert.Equal(t, encoding.UInt64(cfg.Services), version.AddrFrom.Services)
+
+	other, err := c.createVersionMessage()
+	require.NoError(t, err)
+	assert.NotEqual(t, version.Nonce, other.Nonce)
+}
+
+func Test_Client_VersionMessage_BadUserAgent(t *testing.T) {
+	c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+	c.SetOptions(Options{UserAgentComments: []string{"no <tags>"}})
+
+	_, err := c.createVersionMessage()
+	assert.ErrorIs(t, err, encoding.ErrInvalidUserAgent)
+}
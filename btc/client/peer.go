@@ -0,0 +1,128 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Peer keeps the state we have accumulated from previous messages exchanged
+// with the remote node.
+type Peer struct {
+	mu sync.RWMutex
+
+	localNonce      uint64
+	remoteVersion   *encoding.MsgVersion
+	protocolVersion uint32
+	features        Features
+
+	lastPingNonce uint64
+	lastPingTime  time.Time
+
+	pendingPingNonce uint64
+	pendingPingTime  time.Time
+	pingRTT          time.Duration
+}
+
+func (p *Peer) LocalNonce() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.localNonce
+}
+
+func (p *Peer) setLocalNonce(nonce uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.localNonce = nonce
+}
+
+// RemoteVersion returns the version message the peer sent during the
+// handshake or nil if we haven't received it yet.
+func (p *Peer) RemoteVersion() *encoding.MsgVersion {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.remoteVersion
+}
+
+func (p *Peer) setRemoteVersion(version *encoding.MsgVersion) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remoteVersion = version
+	p.protocolVersion = min(encoding.ProtocolVersion, uint32(version.Version))
+}
+
+// ProtocolVersion returns the version both sides speak: the lower of ours and
+// the peer's. It is zero until we receive the peer's version.
+func (p *Peer) ProtocolVersion() uint32 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.protocolVersion
+}
+
+// LastPing returns the nonce and receive time of the last ping from the peer.
+func (p *Peer) LastPing() (uint64, time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.lastPingNonce, p.lastPingTime
+}
+
+func (p *Peer) setLastPing(nonce uint64, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastPingNonce = nonce
+	p.lastPingTime = at
+}
+
+// PingRTT returns the round-trip time measured with our last answered ping.
+func (p *Peer) PingRTT() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pingRTT
+}
+
+func (p *Peer) pingPending() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return !p.pendingPingTime.IsZero()
+}
+
+func (p *Peer) pingOutstanding(nonce uint64) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return !p.pendingPingTime.IsZero() && p.pendingPingNonce == nonce
+}
+
+func (p *Peer) startPing(nonce uint64, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pendingPingNonce = nonce
+	p.pendingPingTime = at
+}
+
+// Completes the pending ping if the nonce matches and records the round-trip
+// time.
+func (p *Peer) finishPing(nonce uint64, at time.Time) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pendingPingTime.IsZero() || p.pendingPingNonce != nonce {
+		return 0, false
+	}
+	p.pingRTT = at.Sub(p.pendingPingTime)
+	p.pendingPingNonce = 0
+	p.pendingPingTime = time.Time{}
+	return p.pingRTT, true
+}
+
+// Features returns the optional features negotiated with the peer so far.
+func (p *Peer) Features() Features {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.features
+}
+
+func (p *Peer) updateFeatures(update func(features *Features)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	update(&p.features)
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+var ErrTooManyBadMessages = errors.New("too many bad messages from peer")
+
+// MessageError is a problem with a single message from the peer. It doesn't
+// break the message stream, so we answer it with a reject and keep going
+// until the peer runs out of soft errors.
+type MessageError struct {
+	Command encoding.Command
+	Code    encoding.RejectCode
+	Reason  string
+	Err     error
+}
+
+func (e *MessageError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Reason, e.Err)
+	}
+	return e.Reason
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+// Turns receive errors that leave the stream in a good state into message
+// errors. Everything else is returned unchanged.
+func classifyReceiveError(header *encoding.Header, err error) error {
+	if header == nil {
+		return err
+	}
+	switch {
+	case errors.Is(err, encoding.ErrBadChecksum):
+		return &MessageError{
+			Command: header.GetCommand(),
+			Code:    encoding.RejectMalformed,
+			Reason:  "bad checksum",
+			Err:     err,
+		}
+	case errors.Is(err, encoding.ErrMalformedPayload):
+		return &MessageError{
+			Command: header.GetCommand(),
+			Code:    encoding.RejectMalformed,
+			Reason:  "error parsing message",
+			Err:     err,
+		}
+	default:
+		return err
+	}
+}
+
+// Applies the bad message policy: soft errors get a reject and are tolerated
+// up to the configured limit. Returns the error that should disconnect the
+// peer or nil if we can keep going.
+func (c *BTCClient) handleMessageError(err error) error {
+	var msgErr *MessageError
+	if !errors.As(err, &msgErr) {
+		return err
+	}
+
+	c.softErrors++
+	c.log.Warn("received bad message",
+		"command", string(msgErr.Command),
+		"error", err,
+		"soft_errors", c.softErrors,
+	)
+	var payloadErr *encoding.PayloadError
+	if errors.As(err, &payloadErr) {
+		c.log.Debug("bad message payload",
+			"command", string(msgErr.Command),
+			"payload", hex.EncodeToString(payloadErr.Payload),
+		)
+	}
+	if c.softErrors > c.maxSoftErrors {
+		return fmt.Errorf("%w: %d bad messages, last one: %w", ErrTooManyBadMessages, c.softErrors, err)
+	}
+
+	rejectErr := c.sendReject(msgErr)
+	if rejectErr != nil {
+		return errors.Wrap(rejectErr, "failed sending reject")
+	}
+	return nil
+}
+
+func (c *BTCClient) sendReject(msgErr *MessageError) error {
+	if c.peer.ProtocolVersion() < encoding.RejectVersion {
+		c.log.Debug("peer does not support reject messages", "command", string(msgErr.Command))
+		return nil
+	}
+
+	reject, err := encoding.NewRejectMsg(msgErr.Command, msgErr.Code, msgErr.Reason, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create reject message")
+	}
+	c.log.Info("sending reject", "command", string(msgErr.Command), "reason", msgErr.Reason)
+	return c.send(reject)
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+func Test_Client_HandleMessageError(t *testing.T) {
+	badChecksum := &MessageError{
+		Command: encoding.PingCommand,
+		Code:    encoding.RejectMalformed,
+		Reason:  "bad checksum",
+	}
+	tests := []struct {
+		name          string
+		peerVersion   uint32
+		maxSoftErrors int
+		errs          []error
+		wantErr       error
+		wantRejects   int
+	}{
+		{
+			name:          "soft errors answered with reject",
+			peerVersion:   encoding.ProtocolVersion,
+			maxSoftErrors: 2,
+			errs:          []error{badChecksum, badChecksum},
+			wantRejects:   2,
+		},
+		{
+			name:          "too many soft errors",
+			peerVersion:   encoding.ProtocolVersion,
+			maxSoftErrors: 2,
+			errs:          []error{badChecksum, badChecksum, badChecksum},
+			wantErr:       ErrTooManyBadMessages,
+			wantRejects:   2,
+		},
+		{
+			name:          "old peer does not get rejects",
+			peerVersion:   60002,
+			maxSoftErrors: 2,
+			errs:          []error{badChecksum},
+		},
+		{
+			name:          "fatal error",
+			peerVersion:   encoding.ProtocolVersion,
+			maxSoftErrors: 2,
+			errs:          []error{encoding.ErrWrongMagic},
+			wantErr:       encoding.ErrWrongMagic,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{MaxSoftErrors: tt.maxSoftErrors}
+			c := New(context.Background(), slog.Default(), cfg, encoding.NetworkRegtest)
+			writer := bytes.NewBuffer(nil)
+			c.writer = writer
+			c.peer.setRemoteVersion(&encoding.MsgVersion{Version: encoding.UInt32(tt.peerVersion)})
+
+			var err error
+			for _, e := range tt.errs {
+				err = c.handleMessageError(e)
+				if err != nil {
+					break
+				}
+			}
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			rejects := 0
+			for writer.Len() > 0 {
+				_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, writer)
+				require.NoError(t, err)
+				assert.Equal(t, &encoding.MsgReject{
+					Message: "ping",
+					Code:    encoding.RejectMalformed,
+					Reason:  "bad checksum",
+				}, msg)
+				rejects++
+			}
+			assert.Equal(t, tt.wantRejects, rejects)
+		})
+	}
+}
+
+func Test_ClassifyReceiveError(t *testing.T) {
+	header, err := encoding.NewHeader(encoding.NetworkRegtest, encoding.PingCommand, nil)
+	require.NoError(t, err)
+
+	var msgErr *MessageError
+	err = classifyReceiveError(header, errors.Wrap(encoding.ErrBadChecksum, "receive"))
+	require.ErrorAs(t, err, &msgErr)
+	assert.Equal(t, encoding.PingCommand, msgErr.Command)
+	assert.Equal(t, encoding.RejectMalformed, msgErr.Code)
+
+	err = classifyReceiveError(header, errors.Wrap(encoding.ErrMalformedPayload, "receive"))
+	require.ErrorAs(t, err, &msgErr)
+	assert.Equal(t, "error parsing message", msgErr.Reason)
+
+	err = classifyReceiveError(nil, encoding.ErrWrongMagic)
+	assert.False(t, errors.As(err, &msgErr))
+}
+
+func Test_Client_RejectsBadChecksum(t *testing.T) {
+	rejectC := make(chan encoding.Message, 1)
+	address := startFakePeer(t, func(conn net.Conn) {
+		acceptHandshake(t, conn)
+
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, encoding.SendMessage(encoding.NetworkRegtest, &encoding.MsgPing{Nonce: 1}, buf))
+		frame := buf.Bytes()
+		frame[len(frame)-1]++
+		_, err := conn.Write(frame)
+		require.NoError(t, err)
+
+		for {
+			_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+			if err != nil {
+				return
+			}
+			if msg.GetCommand() == encoding.RejectCommand {
+				rejectC <- msg
+			}
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := &config.Config{BTCNodeAddress: address, MaxSoftErrors: 1}
+	c := New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	_, err := c.Connect()
+	require.NoError(t, err)
+
+	reject := <-rejectC
+	assert.Equal(t, &encoding.MsgReject{
+		Message: "ping",
+		Code:    encoding.RejectMalformed,
+		Reason:  "bad checksum",
+	}, reject)
+	assert.NoError(t, c.Err())
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+var (
+	ErrNotEstablished  = errors.New("peer handshake not complete")
+	ErrClientClosed    = errors.New("peer disconnected")
+	ErrRequestTimeout  = errors.New("peer did not answer request in time")
+	ErrInvalidRequest  = errors.New("message can't be sent as a request")
+	ErrRequestNotFound = errors.New("peer does not have the requested data")
+)
+
+// How many messages Send can queue before callers block.
+const outboundQueueSize = 100
+
+type outboundMessage struct {
+	msg  encoding.Message
+	done chan error
+}
+
+// A request waiting for its response. Responses are matched in the order the
+// requests were made.
+type pendingRequest struct {
+	match func(msg encoding.Message) bool
+	// For requests answered by several messages: whether the messages
+	// matched so far complete the answer. Nil for single responses.
+	done     func() bool
+	response chan encoding.Message
+}
+
+// Send queues a message for the peer and waits until it is written. It can
+// be called from any goroutine once the handshake is complete. If ctx ends
+// first, the message may still be sent.
+func (c *BTCClient) Send(ctx context.Context, msg encoding.Message) error {
+	if c.ctx.Err() != nil {
+		return c.closedError()
+	}
+	select {
+	case <-c.established:
+	default:
+		return fmt.Errorf("%w: can't send %s message in state %s", ErrNotEstablished, msg.GetCommand(), c.State())
+	}
+
+	item := outboundMessage{msg: msg, done: make(chan error, 1)}
+	select {
+	case c.outbound <- item:
+	case <-c.ctx.Done():
+		return c.closedError()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-item.done:
+		return err
+	case <-c.ctx.Done():
+		return c.closedError()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Request sends a getdata, getheaders, getblocktxn or BIP157 filter message
+// and waits for the response. A getdata has to ask for a single transaction or (compact) block
+// and is answered by the tx, block or cmpctblock message, or by a notfound
+// message together with ErrRequestNotFound. Headers messages don't say what
+// they answer, so a getheaders gets the next headers message from the peer.
+// A getblocktxn gets the blocktxn or the full block. Filter requests get the
+// cfheaders or cfcheckpt for their stop hash, or the cfilter of the stop
+// block; the other filters of a getcfilters range go to the handlers.
+func (c *BTCClient) Request(ctx context.Context, msg encoding.Message) (encoding.Message, error) {
+	match, err := responseMatcher(msg)
+	if err != nil {
+		return nil, err
+	}
+	request := &pendingRequest{match: match, response: make(chan encoding.Message, 1)}
+	response, err := c.request(ctx, msg, request)
+	if err == nil && response.GetCommand() == encoding.NotFoundCommand {
+		return response, ErrRequestNotFound
+	}
+	return response, err
+}
+
+func (c *BTCClient) request(ctx context.Context, msg encoding.Message, request *pendingRequest) (encoding.Message, error) {
+	if c.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, c.requestTimeout,
+			fmt.Errorf("%w: no answer to %s message after %s", ErrRequestTimeout, msg.GetCommand(), c.requestTimeout))
+		defer cancel()
+	}
+
+	// Register before sending, the response can arrive before Send returns.
+	c.addRequest(request)
+	defer c.removeRequest(request)
+
+	err := c.Send(ctx, msg)
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+
+	select {
+	case response := <-request.response:
+		return response, nil
+	case <-c.ctx.Done():
+		return nil, c.closedError()
+	case <-ctx.Done():
+		return nil, requestError(ctx, ctx.Err())
+	}
+}
+
+// Reports our request timeout instead of a plain deadline error.
+func requestError(ctx context.Context, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) && errors.Is(context.Cause(ctx), ErrRequestTimeout) {
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+func (c *BTCClient) closedError() error {
+	return fmt.Errorf("%w: %w", ErrClientClosed, c.Err())
+}
+
+// Writes the queued messages one at a time. Failing to write leaves the
+// connection in an unknown state, so we disconnect.
+func (c *BTCClient) writeMessages() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case item := <-c.outbound:
+			err := c.send(item.msg)
+			if err != nil {
+				err = fmt.Errorf("failed sending %s message: %w", item.msg.GetCommand(), err)
+				c.disconnect(err)
+			}
+			item.done <- err
+		}
+	}
+}
+
+func (c *BTCClient) addRequest(request *pendingRequest) {
+	c.requestsMu.Lock()
+	defer c.requestsMu.Unlock()
+	c.requests = append(c.requests, request)
+}
+
+func (c *BTCClient) removeRequest(request *pendingRequest) {
+	c.requestsMu.Lock()
+	defer c.requestsMu.Unlock()
+	c.requests = slices.DeleteFunc(c.requests, func(other *pendingRequest) bool {
+		return other == request
+	})
+}
+
+// Hands the message to the oldest request it answers. Each request gets a
+// single response, the last message if it is answered by several.
+func (c *BTCClient) answerRequest(msg encoding.Message) bool {
+	c.requestsMu.Lock()
+	defer c.requestsMu.Unlock()
+	for i, request := range c.requests {
+		if !request.match(msg) {
+			continue
+		}
+		if request.done != nil && !request.done() {
+			return true
+		}
+		c.requests = slices.Delete(c.requests, i, i+1)
+		request.response <- msg
+		return true
+	}
+	return false
+}
+
+func responseMatcher(msg encoding.Message) (func(encoding.Message) bool, error) {
+	switch request := msg.(type) {
+	case *encoding.MsgGetHeaders:
+		return func(response encoding.Message) bool {
+			return response.GetCommand() == encoding.HeadersCommand
+		}, nil
+	case *encoding.MsgGetData:
+		if len(request.Inventory) != 1 {
+			return nil, fmt.Errorf("%w: getdata has %d inventory entries, requests support one",
+				ErrInvalidRequest, len(request.Inventory))
+		}
+		return inventoryMatcher(request.Inventory[0])
+	case *encoding.MsgGetBlockTxn:
+		// Bitcoin Core answers with the full block if it is too deep.
+		return func(response encoding.Message) bool {
+			switch response := response.(type) {
+			case *encoding.MsgBlockTxn:
+				return response.BlockHash == request.BlockHash
+			case *encoding.MsgBlock:
+				return response.BlockHash() == request.BlockHash
+			default:
+				return false
+			}
+		}, nil
+	case *encoding.MsgGetCFilters:
+		// A range is answered with one cfilter per block, the request ends
+		// with the filter of the stop block.
+		return func(response encoding.Message) bool {
+			cfilter, ok := response.(*encoding.MsgCFilter)
+			return ok && cfilter.FilterType == request.FilterType && cfilter.BlockHash == request.StopHash
+		}, nil
+	case *encoding.MsgGetCFHeaders:
+		return func(response encoding.Message) bool {
+			cfHeaders, ok := response.(*encoding.MsgCFHeaders)
+			return ok && cfHeaders.FilterType == request.FilterType && cfHeaders.StopHash == request.StopHash
+		}, nil
+	case *encoding.MsgGetCFCheckpt:
+		return func(response encoding.Message) bool {
+			cfCheckpt, ok := response.(*encoding.MsgCFCheckpt)
+			return ok && cfCheckpt.FilterType == request.FilterType && cfCheckpt.StopHash == request.StopHash
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRequest, msg.GetCommand())
+	}
+}
+
+func inventoryMatcher(vect encoding.InvVect) (func(encoding.Message) bool, error) {
+	var matchData func(encoding.Message) bool
+	switch vect.Type &^ encoding.InvWitnessFlag {
+	case encoding.InvTypeTx:
+		matchData = func(response encoding.Message) bool {
+			tx, ok := response.(*encoding.MsgTx)
+			return ok && tx.TxHash() == vect.Hash
+		}
+	case encoding.InvTypeWTx:
+		matchData = func(response encoding.Message) bool {
+			tx, ok := response.(*encoding.MsgTx)
+			return ok && tx.WitnessHash() == vect.Hash
+		}
+	case encoding.InvTypeBlock:
+		matchData = func(response encoding.Message) bool {
+			block, ok := response.(*encoding.MsgBlock)
+			return ok && block.BlockHash() == vect.Hash
+		}
+	case encoding.InvTypeCmpctBlock:
+		matchData = func(response encoding.Message) bool {
+			cmpct, ok := response.(*encoding.MsgCmpctBlock)
+			return ok && cmpct.Header.Hash() == vect.Hash
+		}
+	default:
+		return nil, fmt.Errorf("%w: getdata for %s", ErrInvalidRequest, vect.Type)
+	}
+
+	return func(response encoding.Message) bool {
+		notFound, ok := response.(*encoding.MsgNotFound)
+		if !ok {
+			return matchData(response)
+		}
+		return slices.ContainsFunc(notFound.Inventory, func(other encoding.InvVect) bool {
+			return other.Hash == vect.Hash
+		})
+	}, nil
+}
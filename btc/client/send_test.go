@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+func testTx() *encoding.MsgTx {
+	return &encoding.MsgTx{
+		Version: 2,
+		TxIn: []encoding.TxIn{{
+			PreviousOutPoint: encoding.OutPoint{Hash: encoding.Hash{1}, Index: 0},
+			Sequence:         0xffffffff,
+		}},
+		TxOut: []encoding.TxOut{{Value: 1000, PkScript: encoding.VarBytes{0x51}}},
+	}
+}
+
+// Connects to a fake peer that passes every message it receives after the
+// handshake to the handler.
+func connectServingPeer(t *testing.T, cfg *config.Config, handler func(conn net.Conn, msg encoding.Message)) *BTCClient {
+	t.Helper()
+
+	cfg.BTCNodeAddress = startFakePeer(t, func(conn net.Conn) {
+		acceptHandshake(t, conn)
+		for {
+			_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+			if err != nil {
+				return
+			}
+			handler(conn, msg)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c := New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	_, err := c.Connect()
+	require.NoError(t, err)
+
+	select {
+	case <-c.Established():
+	case <-time.After(time.Second):
+		require.FailNow(t, "handshake did not complete")
+	}
+	return c
+}
+
+func Test_Client_Send_NotEstablished(t *testing.T) {
+	c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+	err := c.Send(context.Background(), &encoding.MsgPing{Nonce: 1})
+	assert.ErrorIs(t, err, ErrNotEstablished)
+}
+
+func Test_Client_Send_Concurrent(t *testing.T) {
+	var mu sync.Mutex
+	received := map[encoding.UInt64]bool{}
+	c := connectServingPeer(t, &config.Config{}, func(_ net.Conn, msg encoding.Message) {
+		if ping, ok := msg.(*encoding.MsgPing); ok {
+			mu.Lock()
+			received[ping.Nonce] = true
+			mu.Unlock()
+		}
+	})
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, c.Send(context.Background(), &encoding.MsgPing{Nonce: encoding.UInt64(i + 1)}))
+		}()
+	}
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 20
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, c.Err())
+}
+
+func Test_Client_Send_Closed(t *testing.T) {
+	c := connectServingPeer(t, &config.Config{}, func(net.Conn, encoding.Message) {})
+	c.Disconnect(assert.AnError)
+
+	err := c.Send(context.Background(), &encoding.MsgPing{Nonce: 1})
+	assert.ErrorIs(t, err, ErrClientClosed)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func Test_Client_Request(t *testing.T) {
+	tx := testTx()
+	c := connectServingPeer(t, &config.Config{RequestTimeout: time.Second}, func(conn net.Conn, msg encoding.Message) {
+		var response encoding.Message
+		switch msg := msg.(type) {
+		case *encoding.MsgGetData:
+			response = &encoding.MsgNotFound{Inventory: msg.Inventory}
+			if msg.Inventory[0].Hash == tx.TxHash() {
+				response = tx
+			}
+		case *encoding.MsgGetHeaders:
+			response = &encoding.MsgHeaders{}
+		default:
+			return
+		}
+		_ = encoding.SendMessage(encoding.NetworkRegtest, response, conn)
+	})
+
+	getData, err := encoding.NewGetDataMsg([]encoding.InvVect{{Type: encoding.InvTypeWitnessTx, Hash: tx.TxHash()}})
+	require.NoError(t, err)
+	response, err := c.Request(context.Background(), getData)
+	require.NoError(t, err)
+	require.IsType(t, &encoding.MsgTx{}, response)
+	assert.Equal(t, tx.TxHash(), response.(*encoding.MsgTx).TxHash())
+
+	getData, err = encoding.NewGetDataMsg([]encoding.InvVect{{Type: encoding.InvTypeBlock, Hash: encoding.Hash{2}}})
+	require.NoError(t, err)
+	response, err = c.Request(context.Background(), getData)
+	assert.ErrorIs(t, err, ErrRequestNotFound)
+	assert.IsType(t, &encoding.MsgNotFound{}, response)
+
+	getHeaders, err := encoding.NewGetHeadersMsg([]encoding.Hash{{3}}, encoding.Hash{})
+	require.NoError(t, err)
+	response, err = c.Request(context.Background(), getHeaders)
+	require.NoError(t, err)
+	assert.IsType(t, &encoding.MsgHeaders{}, response)
+}
+
+func Test_Client_Request_Timeout(t *testing.T) {
+	c := connectServingPeer(t, &config.Config{RequestTimeout: 50 * time.Millisecond}, func(net.Conn, encoding.Message) {})
+
+	getData, err := encoding.NewGetDataMsg([]encoding.InvVect{{Type: encoding.InvTypeBlock, Hash: encoding.Hash{1}}})
+	require.NoError(t, err)
+	_, err = c.Request(context.Background(), getData)
+	assert.ErrorIs(t, err, ErrRequestTimeout)
+
+	// The peer is slow, not broken.
+	assert.NoError(t, c.Err())
+}
+
+func Test_Client_Request_Invalid(t *testing.T) {
+	c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+
+	_, err := c.Request(context.Background(), &encoding.MsgPing{Nonce: 1})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+
+	getData, err := encoding.NewGetDataMsg([]encoding.InvVect{
+		{Type: encoding.InvTypeTx, Hash: encoding.Hash{1}},
+		{Type: encoding.InvTypeTx, Hash: encoding.Hash{2}},
+	})
+	require.NoError(t, err)
+	_, err = c.Request(context.Background(), getData)
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func Test_Client_AnswerRequest_Order(t *testing.T) {
+	c := New(context.Background(), slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+	matchHeaders, err := responseMatcher(&encoding.MsgGetHeaders{})
+	require.NoError(t, err)
+	first := &pendingRequest{match: matchHeaders, response: make(chan encoding.Message, 1)}
+	second := &pendingRequest{match: matchHeaders, response: make(chan encoding.Message, 1)}
+	c.addRequest(first)
+	c.addRequest(second)
+
+	assert.False(t, c.answerRequest(&encoding.MsgPing{}))
+	assert.True(t, c.answerRequest(&encoding.MsgHeaders{}))
+	assert.Len(t, first.response, 1)
+	assert.Empty(t, second.response)
+	assert.True(t, c.answerRequest(&encoding.MsgHeaders{}))
+	assert.Len(t, second.response, 1)
+	assert.False(t, c.answerRequest(&encoding.MsgHeaders{}))
+}
+
+func Test_ResponseMatcher_CompactBlocks(t *testing.T) {
+	header := encoding.BlockHeader{Version: 1, Nonce: 2}
+	block := &encoding.MsgBlock{Header: header}
+
+	match, err := responseMatcher(&encoding.MsgGetBlockTxn{BlockHash: block.BlockHash(), Indexes: []uint16{1}})
+	require.NoError(t, err)
+	assert.True(t, match(&encoding.MsgBlockTxn{BlockHash: block.BlockHash()}))
+	assert.True(t, match(block))
+	assert.False(t, match(&encoding.MsgBlockTxn{BlockHash: encoding.Hash{1}}))
+
+	getData, err := encoding.NewGetDataMsg([]encoding.InvVect{{Type: encoding.InvTypeCmpctBlock, Hash: block.BlockHash()}})
+	require.NoError(t, err)
+	match, err = responseMatcher(getData)
+	require.NoError(t, err)
+	assert.True(t, match(&encoding.MsgCmpctBlock{Header: header}))
+	assert.False(t, match(block))
+}
+
+func Test_ResponseMatcher_Filters(t *testing.T) {
+	stop := encoding.Hash{1}
+	getCFilters, err := encoding.NewGetCFiltersMsg(encoding.FilterTypeBasic, 10, stop)
+	require.NoError(t, err)
+	match, err := responseMatcher(getCFilters)
+	require.NoError(t, err)
+	assert.True(t, match(&encoding.MsgCFilter{BlockHash: stop}))
+	assert.False(t, match(&encoding.MsgCFilter{BlockHash: encoding.Hash{2}}))
+	assert.False(t, match(&encoding.MsgCFilter{FilterType: 1, BlockHash: stop}))
+
+	getCFHeaders, err := encoding.NewGetCFHeadersMsg(encoding.FilterTypeBasic, 10, stop)
+	require.NoError(t, err)
+	match, err = responseMatcher(getCFHeaders)
+	require.NoError(t, err)
+	assert.True(t, match(&encoding.MsgCFHeaders{StopHash: stop}))
+	assert.False(t, match(&encoding.MsgCFCheckpt{StopHash: stop}))
+
+	getCFCheckpt, err := encoding.NewGetCFCheckptMsg(encoding.FilterTypeBasic, stop)
+	require.NoError(t, err)
+	match, err = responseMatcher(getCFCheckpt)
+	require.NoError(t, err)
+	assert.True(t, match(&encoding.MsgCFCheckpt{StopHash: stop}))
+	assert.False(t, match(&encoding.MsgCFCheckpt{StopHash: encoding.Hash{2}}))
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+type PeerState int
+
+const (
+	StateDialing PeerState = iota
+	// Inbound connection waiting for the remote version.
+	StateAccepted
+	StateVersionSent
+	StateVersionReceived
+	StateEstablished
+	StateClosing
+	StateClosed
+)
+
+func (s PeerState) String() string {
+	switch s {
+	case StateDialing:
+		return "dialing"
+	case StateAccepted:
+		return "accepted"
+	case StateVersionSent:
+		return "version_sent"
+	case StateVersionReceived:
+		return "version_received"
+	case StateEstablished:
+		return "established"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// Valid target states for every source state. Closing can be entered from
+// any state that is not already shutting down. Outbound peers send their
+// version first, inbound peers go through accepted and answer the remote
+// version with ours.
+var transitions = map[PeerState][]PeerState{
+	StateDialing:         {StateVersionSent, StateAccepted, StateClosing},
+	StateAccepted:        {StateVersionReceived, StateClosing},
+	StateVersionSent:     {StateVersionReceived, StateClosing},
+	StateVersionReceived: {StateEstablished, StateClosing},
+	StateEstablished:     {StateClosing},
+	StateClosing:         {StateClosed},
+	StateClosed:          {},
+}
+
+// Commands accepted from the peer in the handshake states. Established
+// accepts everything except handshake commands, see Allows.
+var handshakeCommands = map[PeerState][]encoding.Command{
+	StateAccepted:        {encoding.VersionCommand},
+	StateVersionSent:     {encoding.VersionCommand},
+	StateVersionReceived: {encoding.VerackCommand, encoding.WTxIDRelayCommand, encoding.SendAddrV2Command},
+}
+
+type TransitionHook func(from, to PeerState)
+
+type StateMachine struct {
+	mu     sync.RWMutex
+	state  PeerState
+	onMove TransitionHook
+}
+
+func NewStateMachine(hook TransitionHook) *StateMachine {
+	return &StateMachine{
+		state:  StateDialing,
+		onMove: hook,
+	}
+}
+
+func (m *StateMachine) State() PeerState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+func (m *StateMachine) Transition(to PeerState) error {
+	m.mu.Lock()
+	from := m.state
+	if !canTransition(from, to) {
+		m.mu.Unlock()
+		return fmt.Errorf("invalid state transition: %s -> %s", from, to)
+	}
+	m.state = to
+	m.mu.Unlock()
+
+	if m.onMove != nil {
+		m.onMove(from, to)
+	}
+	return nil
+}
+
+// Allows reports whether a message with the given command can be processed
+// in the current state.
+func (m *StateMachine) Allows(command encoding.Command) bool {
+	state := m.State()
+	if state == StateEstablished {
+		return command != encoding.VersionCommand && command != encoding.VerackCommand &&
+			command != encoding.WTxIDRelayCommand && command != encoding.SendAddrV2Command
+	}
+	for _, allowed := range handshakeCommands[state] {
+		if allowed == command {
+			return true
+		}
+	}
+	return false
+}
+
+func canTransition(from, to PeerState) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+func Test_StateMachine_Transitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    []PeerState
+		want    PeerState
+		wantErr string
+	}{
+		{
+			name: "full handshake",
+			path: []PeerState{StateVersionSent, StateVersionReceived, StateEstablished},
+			want: StateEstablished,
+		},
+		{
+			name: "inbound handshake",
+			path: []PeerState{StateAccepted, StateVersionReceived, StateEstablished},
+			want: StateEstablished,
+		},
+		{
+			name:    "inbound sends version first",
+			path:    []PeerState{StateAccepted, StateVersionSent},
+			want:    StateAccepted,
+			wantErr: "invalid state transition: accepted -> version_sent",
+		},
+		{
+			name: "close after handshake",
+			path: []PeerState{StateVersionSent, StateVersionReceived, StateEstablished, StateClosing, StateClosed},
+			want: StateClosed,
+		},
+		{
+			name: "close while dialing",
+			path: []PeerState{StateClosing, StateClosed},
+			want: StateClosed,
+		},
+		{
+			name:    "skip version",
+			path:    []PeerState{StateVersionSent, StateEstablished},
+			want:    StateVersionSent,
+			wantErr: "invalid state transition: version_sent -> established",
+		},
+		{
+			name:    "reopen",
+			path:    []PeerState{StateClosing, StateClosed, StateDialing},
+			want:    StateClosed,
+			wantErr: "invalid state transition: closed -> dialing",
+		},
+		{
+			name:    "closed without closing",
+			path:    []PeerState{StateVersionSent, StateClosed},
+			want:    StateVersionSent,
+			wantErr: "invalid state transition: version_sent -> closed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hooked []PeerState
+			m := NewStateMachine(func(from, to PeerState) {
+				hooked = append(hooked, to)
+			})
+
+			var err error
+			for _, state := range tt.path {
+				err = m.Transition(state)
+				if err != nil {
+					break
+				}
+			}
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.path, hooked)
+			}
+			assert.Equal(t, tt.want, m.State())
+		})
+	}
+}
+
+func Test_StateMachine_Allows(t *testing.T) {
+	ping := encoding.Command("ping")
+	tests := []struct {
+		name  string
+		path  []PeerState
+		allow []encoding.Command
+		deny  []encoding.Command
+	}{
+		{
+			name: "dialing",
+			deny: []encoding.Command{encoding.VersionCommand, encoding.VerackCommand, ping},
+		},
+		{
+			name:  "version sent",
+			path:  []PeerState{StateVersionSent},
+			allow: []encoding.Command{encoding.VersionCommand},
+			deny:  []encoding.Command{encoding.VerackCommand, ping},
+		},
+		{
+			name:  "accepted",
+			path:  []PeerState{StateAccepted},
+			allow: []encoding.Command{encoding.VersionCommand},
+			deny:  []encoding.Command{encoding.VerackCommand, ping},
+		},
+		{
+			name:  "version received",
+			path:  []PeerState{StateVersionSent, StateVersionReceived},
+			allow: []encoding.Command{encoding.VerackCommand, encoding.WTxIDRelayCommand, encoding.SendAddrV2Command},
+			deny:  []encoding.Command{encoding.VersionCommand, ping},
+		},
+		{
+			name:  "established",
+			path:  []PeerState{StateVersionSent, StateVersionReceived, StateEstablished},
+			allow: []encoding.Command{ping, encoding.SendHeadersCommand},
+			deny:  []encoding.Command{encoding.VersionCommand, encoding.VerackCommand, encoding.WTxIDRelayCommand},
+		},
+		{
+			name: "closing",
+			path: []PeerState{StateVersionSent, StateVersionReceived, StateEstablished, StateClosing},
+			deny: []encoding.Command{encoding.VersionCommand, encoding.VerackCommand, ping},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewStateMachine(nil)
+			for _, state := range tt.path {
+				assert.NoError(t, m.Transition(state))
+			}
+			for _, command := range tt.allow {
+				assert.True(t, m.Allows(command), command)
+			}
+			for _, command := range tt.deny {
+				assert.False(t, m.Allows(command), command)
+			}
+		})
+	}
+}
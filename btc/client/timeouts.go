@@ -0,0 +1,57 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrDialTimeout      = errors.New("timed out connecting to peer")
+	ErrHandshakeTimeout = errors.New("peer did not complete the handshake in time")
+	ErrIdleTimeout      = errors.New("peer went idle")
+	ErrWriteTimeout     = errors.New("timed out writing to peer")
+)
+
+// Disconnects peers that accept the connection but don't finish the
+// handshake, whoever was supposed to speak first.
+func (c *BTCClient) startHandshakeTimer() {
+	if c.handshakeTimeout <= 0 {
+		return
+	}
+	timer := time.AfterFunc(c.handshakeTimeout, func() {
+		if c.state.State() < StateEstablished {
+			c.disconnect(fmt.Errorf("%w: still %s after %s", ErrHandshakeTimeout, c.state.State(), c.handshakeTimeout))
+		}
+	})
+	go func() {
+		select {
+		case <-c.established:
+		case <-c.ctx.Done():
+		}
+		timer.Stop()
+	}()
+}
+
+// Gives the peer idleTimeout to send the next message. Pings keep healthy
+// peers from going idle.
+func (c *BTCClient) setReadDeadline() error {
+	if c.conn == nil || c.idleTimeout <= 0 {
+		return nil
+	}
+	return c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+}
+
+func (c *BTCClient) setWriteDeadline() error {
+	if c.conn == nil || c.writeTimeout <= 0 {
+		return nil
+	}
+	return c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
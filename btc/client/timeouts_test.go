@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+func Test_Client_DialTimeout(t *testing.T) {
+	address := startFakePeer(t, func(net.Conn) {})
+
+	// Too short for any dial to finish.
+	cfg := &config.Config{BTCNodeAddress: address, DialTimeout: time.Nanosecond}
+	c := New(context.Background(), slog.Default(), cfg, encoding.NetworkRegtest)
+	_, err := c.Connect()
+
+	assert.ErrorIs(t, err, ErrDialTimeout)
+}
+
+func Test_Client_HandshakeTimeout(t *testing.T) {
+	// Takes our version and never answers.
+	address := startFakePeer(t, func(conn net.Conn) {
+		for {
+			_, _, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	cfg := &config.Config{BTCNodeAddress: address, HandshakeTimeout: 50 * time.Millisecond}
+	c := New(context.Background(), slog.Default(), cfg, encoding.NetworkRegtest)
+	messageC, err := c.Connect()
+	require.NoError(t, err)
+
+	for range messageC {
+	}
+	assert.ErrorIs(t, c.Err(), ErrHandshakeTimeout)
+	assert.ErrorContains(t, c.Err(), "still version_sent")
+}
+
+func Test_Client_InboundHandshakeTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// The remote connects but never sends its version.
+	remote, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer remote.Close()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+
+	cfg := &config.Config{HandshakeTimeout: 50 * time.Millisecond}
+	c := New(context.Background(), slog.Default(), cfg, encoding.NetworkRegtest)
+	messageC, err := c.Accept(conn)
+	require.NoError(t, err)
+
+	for range messageC {
+	}
+	assert.ErrorIs(t, c.Err(), ErrHandshakeTimeout)
+}
+
+func Test_Client_HandshakeTimeoutStopped(t *testing.T) {
+	address := startFakePeer(t, func(conn net.Conn) {
+		acceptHandshake(t, conn)
+		for {
+			_, _, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	cfg := &config.Config{BTCNodeAddress: address, HandshakeTimeout: 50 * time.Millisecond}
+	c := New(context.Background(), slog.Default(), cfg, encoding.NetworkRegtest)
+	_, err := c.Connect()
+	require.NoError(t, err)
+
+	<-c.Established()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, c.Err())
+	assert.Equal(t, StateEstablished, c.State())
+}
+
+func Test_Client_IdleTimeout(t *testing.T) {
+	// Completes the handshake and goes silent.
+	address := startFakePeer(t, func(conn net.Conn) {
+		acceptHandshake(t, conn)
+		for {
+			_, _, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	cfg := &config.Config{BTCNodeAddress: address, IdleTimeout: 100 * time.Millisecond}
+	c := New(context.Background(), slog.Default(), cfg, encoding.NetworkRegtest)
+	messageC, err := c.Connect()
+	require.NoError(t, err)
+
+	for range messageC {
+	}
+	assert.ErrorIs(t, c.Err(), ErrIdleTimeout)
+	// The handshake went through, only the silence afterwards is a problem.
+	select {
+	case <-c.Established():
+	default:
+		t.Fatal("handshake did not complete")
+	}
+}
+
+func Test_Client_WriteTimeout(t *testing.T) {
+	// Nobody reads the other end of the pipe, so writes block.
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	cfg := &config.Config{WriteTimeout: 20 * time.Millisecond}
+	c := New(context.Background(), slog.Default(), cfg, encoding.NetworkRegtest)
+	c.conn = local
+	c.writer = local
+
+	err := c.send(&encoding.MsgPing{Nonce: 1})
+
+	assert.ErrorIs(t, err, ErrWriteTimeout)
+	assert.ErrorContains(t, err, "ping message after 20ms")
+}
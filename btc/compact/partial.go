@@ -0,0 +1,119 @@
+package compact
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+var (
+	ErrInvalidCompactBlock = errors.New("invalid compact block")
+	ErrShortIDCollision    = errors.New("compact block has duplicate short ids")
+	ErrMerkleMismatch      = errors.New("reconstructed block does not match the merkle root")
+)
+
+// TxPool provides the transactions we already know, e.g. from a mempool.
+type TxPool interface {
+	Transactions() []*encoding.MsgTx
+}
+
+// PartialBlock is a compact block with the transactions we found so far
+// (BIP152). The rest have to be requested from the peer.
+type PartialBlock struct {
+	cmpct *encoding.MsgCmpctBlock
+	txs   []*encoding.MsgTx
+}
+
+// NewPartialBlock places the prefilled transactions and looks up the short
+// ids in the pool, which may be nil. Pool transactions that share a short id
+// are both dropped, the peer has to send the right one.
+func NewPartialBlock(cmpct *encoding.MsgCmpctBlock, pool TxPool) (*PartialBlock, error) {
+	count := cmpct.TxCount()
+	if count == 0 {
+		return nil, fmt.Errorf("%w: no transactions", ErrInvalidCompactBlock)
+	}
+	p := &PartialBlock{cmpct: cmpct, txs: make([]*encoding.MsgTx, count)}
+	for i := range cmpct.PrefilledTxs {
+		prefilled := &cmpct.PrefilledTxs[i]
+		if int(prefilled.Index) >= count {
+			return nil, fmt.Errorf("%w: prefilled index %d in a block of %d transactions",
+				ErrInvalidCompactBlock, prefilled.Index, count)
+		}
+		p.txs[prefilled.Index] = &prefilled.Tx
+	}
+
+	// The short ids fill the positions left between the prefilled ones.
+	slots := make(map[encoding.ShortID]int, len(cmpct.ShortIDs))
+	position := 0
+	for _, id := range cmpct.ShortIDs {
+		for p.txs[position] != nil {
+			position++
+		}
+		if _, ok := slots[id]; ok {
+			return nil, fmt.Errorf("%w: %012x", ErrShortIDCollision, uint64(id))
+		}
+		slots[id] = position
+		position++
+	}
+	if pool == nil {
+		return p, nil
+	}
+
+	collided := map[int]bool{}
+	for _, tx := range pool.Transactions() {
+		position, ok := slots[cmpct.ShortID(tx.WitnessHash())]
+		if !ok || collided[position] {
+			continue
+		}
+		if p.txs[position] != nil {
+			collided[position] = true
+			p.txs[position] = nil
+			continue
+		}
+		p.txs[position] = tx
+	}
+	return p, nil
+}
+
+// Missing returns the positions of the transactions we don't have.
+func (p *PartialBlock) Missing() []uint16 {
+	var missing []uint16
+	for i, tx := range p.txs {
+		if tx == nil {
+			missing = append(missing, uint16(i))
+		}
+	}
+	return missing
+}
+
+// Fill completes the block with the missing transactions, in the order of
+// Missing. A pool transaction with a colliding short id shows up as a merkle
+// root mismatch.
+func (p *PartialBlock) Fill(missing []encoding.MsgTx) (*encoding.MsgBlock, error) {
+	block := &encoding.MsgBlock{
+		Header:       p.cmpct.Header,
+		Transactions: make([]encoding.MsgTx, len(p.txs)),
+	}
+	next := 0
+	for i, tx := range p.txs {
+		if tx != nil {
+			block.Transactions[i] = *tx
+			continue
+		}
+		if next >= len(missing) {
+			return nil, fmt.Errorf("%w: got %d missing transactions, need more", ErrInvalidCompactBlock, len(missing))
+		}
+		block.Transactions[i] = missing[next]
+		next++
+	}
+	if next != len(missing) {
+		return nil, fmt.Errorf("%w: got %d missing transactions, need %d", ErrInvalidCompactBlock, len(missing), next)
+	}
+
+	if block.MerkleRoot() != block.Header.MerkleRoot {
+		return nil, ErrMerkleMismatch
+	}
+	return block, nil
+}
@@ -0,0 +1,82 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Requester sends a request to the peer that announced the block and waits
+// for the answer, see client.BTCClient.Request.
+type Requester interface {
+	Request(ctx context.Context, msg encoding.Message) (encoding.Message, error)
+}
+
+// Reconstruct rebuilds the full block from a compact block, taking the
+// transactions it can from the pool and requesting the rest from the peer.
+// If the short ids turn out to be ambiguous it downloads the full block
+// instead, like Bitcoin Core does.
+func Reconstruct(ctx context.Context, peer Requester, cmpct *encoding.MsgCmpctBlock, pool TxPool) (*encoding.MsgBlock, error) {
+	hash := cmpct.Header.Hash()
+	partial, err := NewPartialBlock(cmpct, pool)
+	if errors.Is(err, ErrShortIDCollision) {
+		return FetchBlock(ctx, peer, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []encoding.MsgTx
+	if indexes := partial.Missing(); len(indexes) > 0 {
+		getBlockTxn, err := encoding.NewGetBlockTxnMsg(hash, indexes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create getblocktxn message")
+		}
+		response, err := peer.Request(ctx, getBlockTxn)
+		if err != nil {
+			return nil, fmt.Errorf("failed requesting %d missing transactions: %w", len(indexes), err)
+		}
+		switch response := response.(type) {
+		case *encoding.MsgBlock:
+			return checkBlock(response)
+		case *encoding.MsgBlockTxn:
+			missing = response.Transactions
+		default:
+			return nil, fmt.Errorf("unexpected getblocktxn response: %s", response.GetCommand())
+		}
+	}
+
+	block, err := partial.Fill(missing)
+	if errors.Is(err, ErrMerkleMismatch) {
+		return FetchBlock(ctx, peer, hash)
+	}
+	return block, err
+}
+
+// FetchBlock downloads a full block with its witness data and checks its
+// merkle root.
+func FetchBlock(ctx context.Context, peer Requester, hash encoding.Hash) (*encoding.MsgBlock, error) {
+	getData, err := encoding.NewGetDataMsg([]encoding.InvVect{{Type: encoding.InvTypeWitnessBlock, Hash: hash}})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create getdata message")
+	}
+	response, err := peer.Request(ctx, getData)
+	if err != nil {
+		return nil, fmt.Errorf("failed requesting full block %s: %w", hash, err)
+	}
+	block, ok := response.(*encoding.MsgBlock)
+	if !ok {
+		return nil, fmt.Errorf("unexpected getdata response: %s", response.GetCommand())
+	}
+	return checkBlock(block)
+}
+
+func checkBlock(block *encoding.MsgBlock) (*encoding.MsgBlock, error) {
+	if block.MerkleRoot() != block.Header.MerkleRoot {
+		return nil, ErrMerkleMismatch
+	}
+	return block, nil
+}
@@ -0,0 +1,146 @@
+package compact
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+type txList []*encoding.MsgTx
+
+func (l txList) Transactions() []*encoding.MsgTx {
+	return l
+}
+
+// Answers requests from a list of canned responses and records them.
+type fakePeer struct {
+	responses []encoding.Message
+	requests  []encoding.Message
+}
+
+func (p *fakePeer) Request(_ context.Context, msg encoding.Message) (encoding.Message, error) {
+	p.requests = append(p.requests, msg)
+	if len(p.responses) == 0 {
+		return nil, context.DeadlineExceeded
+	}
+	response := p.responses[0]
+	p.responses = p.responses[1:]
+	return response, nil
+}
+
+func testBlock(txCount int) *encoding.MsgBlock {
+	block := &encoding.MsgBlock{Header: encoding.BlockHeader{Version: 0x20000000, Bits: 0x207fffff}}
+	for i := range txCount {
+		tx := encoding.MsgTx{
+			Version: 2,
+			TxIn:    []encoding.TxIn{{PreviousOutPoint: encoding.OutPoint{Hash: encoding.Hash{byte(i)}}}},
+			TxOut:   []encoding.TxOut{{Value: encoding.UInt64(i)}},
+		}
+		if i == 0 {
+			tx.TxIn[0].PreviousOutPoint = encoding.OutPoint{Index: 0xffffffff}
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+	block.Header.MerkleRoot = block.MerkleRoot()
+	return block
+}
+
+func newCmpct(t *testing.T, block *encoding.MsgBlock) *encoding.MsgCmpctBlock {
+	t.Helper()
+	cmpct, err := encoding.NewCmpctBlockMsg(block, 7)
+	require.NoError(t, err)
+	return cmpct
+}
+
+func Test_Reconstruct_FromPool(t *testing.T) {
+	block := testBlock(4)
+	pool := txList{&block.Transactions[3], &block.Transactions[1], &block.Transactions[2]}
+	peer := &fakePeer{}
+
+	got, err := Reconstruct(context.Background(), peer, newCmpct(t, block), pool)
+	require.NoError(t, err)
+	assert.Equal(t, block, got)
+	assert.Empty(t, peer.requests)
+}
+
+func Test_Reconstruct_RequestsMissing(t *testing.T) {
+	block := testBlock(5)
+	pool := txList{&block.Transactions[2]}
+	peer := &fakePeer{responses: []encoding.Message{&encoding.MsgBlockTxn{
+		BlockHash:    block.BlockHash(),
+		Transactions: []encoding.MsgTx{block.Transactions[1], block.Transactions[3], block.Transactions[4]},
+	}}}
+
+	got, err := Reconstruct(context.Background(), peer, newCmpct(t, block), pool)
+	require.NoError(t, err)
+	assert.Equal(t, block, got)
+	require.Len(t, peer.requests, 1)
+	assert.Equal(t, &encoding.MsgGetBlockTxn{BlockHash: block.BlockHash(), Indexes: []uint16{1, 3, 4}}, peer.requests[0])
+}
+
+func Test_Reconstruct_FallsBackToFullBlock(t *testing.T) {
+	block := testBlock(3)
+	getData := &encoding.MsgGetData{Inventory: encoding.InvList{{Type: encoding.InvTypeWitnessBlock, Hash: block.BlockHash()}}}
+
+	t.Run("short id collision", func(t *testing.T) {
+		cmpct := newCmpct(t, block)
+		cmpct.ShortIDs[1] = cmpct.ShortIDs[0]
+		peer := &fakePeer{responses: []encoding.Message{block}}
+
+		got, err := Reconstruct(context.Background(), peer, cmpct, nil)
+		require.NoError(t, err)
+		assert.Equal(t, block, got)
+		assert.Equal(t, []encoding.Message{getData}, peer.requests)
+	})
+
+	t.Run("merkle mismatch", func(t *testing.T) {
+		wrong := testBlock(4).Transactions[3]
+		peer := &fakePeer{responses: []encoding.Message{
+			&encoding.MsgBlockTxn{BlockHash: block.BlockHash(), Transactions: []encoding.MsgTx{block.Transactions[1], wrong}},
+			block,
+		}}
+
+		got, err := Reconstruct(context.Background(), peer, newCmpct(t, block), nil)
+		require.NoError(t, err)
+		assert.Equal(t, block, got)
+		require.Len(t, peer.requests, 2)
+		assert.Equal(t, getData, peer.requests[1])
+	})
+}
+
+func Test_Reconstruct_Errors(t *testing.T) {
+	block := testBlock(3)
+
+	t.Run("wrong number of transactions", func(t *testing.T) {
+		peer := &fakePeer{responses: []encoding.Message{
+			&encoding.MsgBlockTxn{BlockHash: block.BlockHash(), Transactions: block.Transactions[1:2]},
+		}}
+		_, err := Reconstruct(context.Background(), peer, newCmpct(t, block), nil)
+		assert.ErrorIs(t, err, ErrInvalidCompactBlock)
+	})
+
+	t.Run("prefilled index out of range", func(t *testing.T) {
+		cmpct := newCmpct(t, block)
+		cmpct.PrefilledTxs[0].Index = 3
+		_, err := Reconstruct(context.Background(), &fakePeer{}, cmpct, nil)
+		assert.ErrorIs(t, err, ErrInvalidCompactBlock)
+	})
+
+	t.Run("peer does not answer", func(t *testing.T) {
+		_, err := Reconstruct(context.Background(), &fakePeer{}, newCmpct(t, block), nil)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func Test_PartialBlock_PoolCollision(t *testing.T) {
+	block := testBlock(2)
+	cmpct := newCmpct(t, block)
+	// Two pool transactions claim the same slot, so neither is trusted.
+	partial, err := NewPartialBlock(cmpct, txList{&block.Transactions[1], &block.Transactions[1]})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1}, partial.Missing())
+}
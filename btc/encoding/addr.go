@@ -0,0 +1,55 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// Peers are not allowed to send more than 1000 addresses in a single message.
+const MaxAddrEntries = 1000
+
+// Time, services, IP and port of an addr entry.
+const timedAddrSize = 4 + 8 + 16 + 2
+
+type MsgAddr struct {
+	Addresses []TimedNetworkAddress
+}
+
+func NewAddrMsg(addresses []TimedNetworkAddress) (*MsgAddr, error) {
+	if len(addresses) > MaxAddrEntries {
+		return nil, fmt.Errorf("too many addresses: %d, limit is %d", len(addresses), MaxAddrEntries)
+	}
+	return &MsgAddr{Addresses: addresses}, nil
+}
+
+func (addr *MsgAddr) GetCommand() Command {
+	return AddrCommand
+}
+
+func (addr *MsgAddr) Encode(writer io.Writer) error {
+	count := VarInt(len(addr.Addresses))
+	steps := []*encodeStep{step("count", &count)}
+	for i := range addr.Addresses {
+		steps = append(steps, step("addr_list", &addr.Addresses[i]))
+	}
+	err := encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding addr fields: %w", err)
+	}
+	return nil
+}
+
+func (addr *MsgAddr) Decode(reader io.Reader) error {
+	count, err := decodeCount(reader, MaxAddrEntries, timedAddrSize)
+	if err != nil {
+		return fmt.Errorf("error decoding addr count: %w", err)
+	}
+	addr.Addresses = make([]TimedNetworkAddress, count)
+	for i := range addr.Addresses {
+		err = addr.Addresses[i].Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding addr_list: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Addr_Roundtrip(t *testing.T) {
+	testTime := UInt32(time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC).Unix())
+	addresses := []TimedNetworkAddress{
+		{
+			Time: testTime,
+			NetworkAddress: *noErr(t, func() (*NetworkAddress, error) {
+				return NewIP4Address(ServicesNodeNetwork, "10.0.0.1:8333")
+			}),
+		},
+		{
+			Time: testTime + 1,
+			NetworkAddress: *noErr(t, func() (*NetworkAddress, error) {
+				return NewNetworkAddress(ServicesNodeWitness, "[2001:db8::1]:18444")
+			}),
+		},
+	}
+	addr, err := NewAddrMsg(addresses)
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	err = SendMessage(NetworkRegtest, addr, buf)
+	assert.NoError(t, err)
+
+	header, got, err := ReceiveMessage(NetworkRegtest, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, AddrCommand, header.GetCommand())
+	assert.Equal(t, UInt32(1+2*30), header.PayloadSize)
+
+	gotAddr, ok := got.(*MsgAddr)
+	assert.True(t, ok)
+	assert.Len(t, gotAddr.Addresses, 2)
+	assert.Equal(t, "10.0.0.1:8333", gotAddr.Addresses[0].String())
+	assert.Equal(t, "[2001:db8::1]:18444", gotAddr.Addresses[1].String())
+	assert.Equal(t, testTime+1, gotAddr.Addresses[1].Time)
+}
+
+func Test_Addr_Limits(t *testing.T) {
+	_, err := NewAddrMsg(make([]TimedNetworkAddress, MaxAddrEntries+1))
+	assert.ErrorContains(t, err, "too many addresses: 1001")
+
+	input := unformatBinary(`FD E9 03`)
+	err = (&MsgAddr{}).Decode(bytes.NewBuffer(input))
+	assert.ErrorContains(t, err, "too many entries: 1001, limit is 1000")
+}
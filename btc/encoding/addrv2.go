@@ -0,0 +1,211 @@
+package encoding
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BIP155 network IDs.
+type NetworkID UInt8
+
+const (
+	NetworkIDIPv4  NetworkID = 1
+	NetworkIDIPv6  NetworkID = 2
+	NetworkIDTorV2 NetworkID = 3
+	NetworkIDTorV3 NetworkID = 4
+	NetworkIDI2P   NetworkID = 5
+	NetworkIDCJDNS NetworkID = 6
+)
+
+// Longest address BIP155 allows for any network, including unknown ones.
+const MaxAddrV2Size = 512
+
+// Time, single byte services, network id and address size, empty address and
+// port.
+const minAddrV2Size = 4 + 1 + 1 + 1 + 2
+
+var networkIDSizes = map[NetworkID]int{
+	NetworkIDIPv4:  4,
+	NetworkIDIPv6:  16,
+	NetworkIDTorV2: 10,
+	NetworkIDTorV3: 32,
+	NetworkIDI2P:   32,
+	NetworkIDCJDNS: 16,
+}
+
+func (id NetworkID) String() string {
+	switch id {
+	case NetworkIDIPv4:
+		return "ipv4"
+	case NetworkIDIPv6:
+		return "ipv6"
+	case NetworkIDTorV2:
+		return "torv2"
+	case NetworkIDTorV3:
+		return "torv3"
+	case NetworkIDI2P:
+		return "i2p"
+	case NetworkIDCJDNS:
+		return "cjdns"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(id))
+	}
+}
+
+func (id *NetworkID) Encode(writer io.Writer) error {
+	ui := UInt8(*id)
+	return (&ui).Encode(writer)
+}
+
+func (id *NetworkID) Decode(reader io.Reader) error {
+	ui := UInt8(0)
+	err := (&ui).Decode(reader)
+	if err != nil {
+		return errors.Wrap(err, "network id read error")
+	}
+	*id = NetworkID(ui)
+	return nil
+}
+
+// AddressV2 is the BIP155 address format used in addrv2 messages. Unlike
+// NetworkAddress it can hold addresses that don't fit in 16 bytes.
+type AddressV2 struct {
+	Time      UInt32
+	Services  VarInt
+	NetworkID NetworkID
+	Addr      []byte
+	Port      PortNumber
+}
+
+// NewAddressV2 creates an IPv4 or IPv6 address entry from an IP and a port.
+func NewAddressV2(timestamp UInt32, services Services, ip net.IP, port uint16) (*AddressV2, error) {
+	addr := &AddressV2{
+		Time:     timestamp,
+		Services: VarInt(services),
+		Port:     PortNumber(port),
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		addr.NetworkID = NetworkIDIPv4
+		addr.Addr = ip4
+		return addr, nil
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		addr.NetworkID = NetworkIDIPv6
+		addr.Addr = ip16
+		return addr, nil
+	}
+	return nil, fmt.Errorf("invalid ip address: %v", ip)
+}
+
+// TCPAddr returns a dialable host:port string for the networks we can reach
+// directly (IPv4, IPv6 and CJDNS).
+func (addr *AddressV2) TCPAddr() (string, bool) {
+	switch addr.NetworkID {
+	case NetworkIDIPv4, NetworkIDIPv6, NetworkIDCJDNS:
+		return net.JoinHostPort(net.IP(addr.Addr).String(), strconv.Itoa(int(addr.Port))), true
+	default:
+		return "", false
+	}
+}
+
+// String formats the address for logging. I2P addresses get their .b32.i2p
+// form. Tor addresses are printed as hex since building the onion name needs
+// a SHA3 checksum.
+func (addr *AddressV2) String() string {
+	if tcpAddr, ok := addr.TCPAddr(); ok {
+		return tcpAddr
+	}
+	host := fmt.Sprintf("%s:%s", addr.NetworkID, hex.EncodeToString(addr.Addr))
+	if addr.NetworkID == NetworkIDI2P {
+		encoder := base32.StdEncoding.WithPadding(base32.NoPadding)
+		host = strings.ToLower(encoder.EncodeToString(addr.Addr)) + ".b32.i2p"
+	}
+	return fmt.Sprintf("%s:%d", host, addr.Port)
+}
+
+func (addr *AddressV2) Encode(writer io.Writer) error {
+	size := VarInt(len(addr.Addr))
+	return encode(writer,
+		step("time", &addr.Time),
+		step("services", &addr.Services),
+		step("network_id", &addr.NetworkID),
+		step("addr_size", &size),
+		step("addr", RawBytes(addr.Addr)),
+		step("port", &addr.Port),
+	)
+}
+
+func (addr *AddressV2) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("time", &addr.Time),
+		step("services", &addr.Services),
+		step("network_id", &addr.NetworkID),
+	)
+	if err != nil {
+		return err
+	}
+
+	size, err := decodeCount(reader, MaxAddrV2Size, 1)
+	if err != nil {
+		return errors.Wrap(err, "addr size read error")
+	}
+	// Unknown networks are allowed with any size, so the receiver can skip them.
+	if want, known := networkIDSizes[addr.NetworkID]; known && size != want {
+		return fmt.Errorf("invalid %s address size: %d, expected %d", addr.NetworkID, size, want)
+	}
+	addr.Addr = make([]byte, size)
+	return decode(reader,
+		step("addr", RawBytes(addr.Addr)),
+		step("port", &addr.Port),
+	)
+}
+
+type MsgAddrV2 struct {
+	Addresses []AddressV2
+}
+
+func NewAddrV2Msg(addresses []AddressV2) (*MsgAddrV2, error) {
+	if len(addresses) > MaxAddrEntries {
+		return nil, fmt.Errorf("too many addresses: %d, limit is %d", len(addresses), MaxAddrEntries)
+	}
+	return &MsgAddrV2{Addresses: addresses}, nil
+}
+
+func (addrV2 *MsgAddrV2) GetCommand() Command {
+	return AddrV2Command
+}
+
+func (addrV2 *MsgAddrV2) Encode(writer io.Writer) error {
+	count := VarInt(len(addrV2.Addresses))
+	steps := []*encodeStep{step("count", &count)}
+	for i := range addrV2.Addresses {
+		steps = append(steps, step("addr_list", &addrV2.Addresses[i]))
+	}
+	err := encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding addrv2 fields: %w", err)
+	}
+	return nil
+}
+
+func (addrV2 *MsgAddrV2) Decode(reader io.Reader) error {
+	count, err := decodeCount(reader, MaxAddrEntries, minAddrV2Size)
+	if err != nil {
+		return fmt.Errorf("error decoding addrv2 count: %w", err)
+	}
+	addrV2.Addresses = make([]AddressV2, count)
+	for i := range addrV2.Addresses {
+		err = addrV2.Addresses[i].Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding addr_list: %w", err)
+		}
+	}
+	return nil
+}
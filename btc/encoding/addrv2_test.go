@@ -0,0 +1,128 @@
+package encoding
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AddressV2_Encode(t *testing.T) {
+	tests := []struct {
+		name string
+		addr *AddressV2
+		want string
+	}{
+		{
+			name: "IPv4",
+			addr: noErr(t, func() (*AddressV2, error) {
+				return NewAddressV2(0x66090000, ServicesNodeNetwork, net.ParseIP("10.0.0.1"), 8333)
+			}),
+			want: strip(`
+			00 00 09 66 01 01 04 0A 00 00 01 20 8D`),
+		},
+		{
+			name: "IPv6",
+			addr: noErr(t, func() (*AddressV2, error) {
+				return NewAddressV2(0x66090000, ServicesNodeWitness, net.ParseIP("2001:db8::1"), 8333)
+			}),
+			want: strip(`
+			00 00 09 66 08 02 10 20 01 0D B8 00 00 00 00 00
+			00 00 00 00 00 00 01 20 8D`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := tt.addr.Encode(buf)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, formatBinary(buf.Bytes()))
+		})
+	}
+}
+
+func Test_AddressV2_Decode(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     string
+		wantTCP  bool
+		wantErr  string
+		wantAddr []byte
+	}{
+		{
+			name:    "IPv4",
+			input:   `00 00 09 66 01 01 04 0A 00 00 01 20 8D`,
+			want:    "10.0.0.1:8333",
+			wantTCP: true,
+		},
+		{
+			name: "I2P",
+			input: `
+			00 00 09 66 00 05 20 00 01 02 03 04 05 06 07 08
+			09 0A 0B 0C 0D 0E 0F 10 11 12 13 14 15 16 17 18
+			19 1A 1B 1C 1D 1E 1F 00 00`,
+			want: "aaaqeayeaudaocajbifqydiob4ibceqtcqkrmfyydenbwha5dypq.b32.i2p:0",
+		},
+		{
+			name:     "unknown network",
+			input:    `00 00 09 66 00 2A 03 01 02 03 20 8D`,
+			want:     "unknown(42):010203:8333",
+			wantAddr: []byte{1, 2, 3},
+		},
+		{
+			name:    "wrong IPv4 size",
+			input:   `00 00 09 66 01 01 05 0A 00 00 01 01 20 8D`,
+			wantErr: "invalid ipv4 address size: 5, expected 4",
+		},
+		{
+			name:    "address too long",
+			input:   `00 00 09 66 01 2A FD 01 02`,
+			wantErr: "too many entries: 513, limit is 512",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &AddressV2{}
+			err := got.Decode(bytes.NewBuffer(unformatBinary(tt.input)))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+			_, ok := got.TCPAddr()
+			assert.Equal(t, tt.wantTCP, ok)
+			if tt.wantAddr != nil {
+				assert.Equal(t, tt.wantAddr, got.Addr)
+			}
+		})
+	}
+}
+
+func Test_AddrV2_Roundtrip(t *testing.T) {
+	addresses := []AddressV2{
+		*noErr(t, func() (*AddressV2, error) {
+			return NewAddressV2(1, ServicesNodeNetwork, net.ParseIP("10.0.0.1"), 8333)
+		}),
+		{
+			Time:      2,
+			Services:  VarInt(ServicesNodeNetworkLimited),
+			NetworkID: NetworkIDTorV3,
+			Addr:      bytes.Repeat([]byte{0xAB}, 32),
+			Port:      9050,
+		},
+	}
+	addrV2, err := NewAddrV2Msg(addresses)
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	err = SendMessage(NetworkRegtest, addrV2, buf)
+	assert.NoError(t, err)
+
+	header, got, err := ReceiveMessage(NetworkRegtest, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, AddrV2Command, header.GetCommand())
+	assert.Equal(t, addrV2, got)
+}
@@ -0,0 +1,140 @@
+package encoding
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Smallest possible transaction: version, one input, one output and lock
+// time.
+const minTxSize = 4 + 1 + minTxInSize + 1 + minTxOutSize + 4
+
+const maxBlockTxs = MaxBlockWeight / WitnessScaleFactor / minTxSize
+
+// BIP141 witness commitments are OP_RETURN outputs of the coinbase starting
+// with this header, followed by the 32 byte commitment.
+var witnessCommitmentHeader = []byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}
+
+type MsgBlock struct {
+	Header       BlockHeader
+	Transactions []MsgTx
+}
+
+func (block *MsgBlock) GetCommand() Command {
+	return BlockCommand
+}
+
+func (block *MsgBlock) BlockHash() Hash {
+	return block.Header.Hash()
+}
+
+// MerkleRoot computes the merkle root of the transaction ids. It should match
+// the merkle root in the header.
+func (block *MsgBlock) MerkleRoot() Hash {
+	hashes := make([]Hash, len(block.Transactions))
+	for i := range block.Transactions {
+		hashes[i] = block.Transactions[i].TxHash()
+	}
+	return MerkleRoot(hashes)
+}
+
+// WitnessMerkleRoot computes the merkle root of the wtxids. The coinbase wtxid
+// is replaced by zeros.
+func (block *MsgBlock) WitnessMerkleRoot() Hash {
+	hashes := make([]Hash, len(block.Transactions))
+	for i := 1; i < len(block.Transactions); i++ {
+		hashes[i] = block.Transactions[i].WitnessHash()
+	}
+	return MerkleRoot(hashes)
+}
+
+// WitnessCommitment computes the BIP141 commitment from the witness merkle
+// root and the reserved value in the coinbase witness.
+func (block *MsgBlock) WitnessCommitment() (Hash, error) {
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return Hash{}, errors.New("block has no coinbase")
+	}
+	witness := block.Transactions[0].TxIn[0].Witness
+	if len(witness) != 1 || len(witness[0]) != len(Hash{}) {
+		return Hash{}, errors.New("coinbase witness is not a single 32 byte reserved value")
+	}
+	root := block.WitnessMerkleRoot()
+	return DoubleSHA256(append(root[:], witness[0]...)), nil
+}
+
+// CoinbaseWitnessCommitment returns the witness commitment stored in the
+// coinbase. If there are several, the last one counts.
+func (block *MsgBlock) CoinbaseWitnessCommitment() (Hash, bool) {
+	if len(block.Transactions) == 0 {
+		return Hash{}, false
+	}
+	outputs := block.Transactions[0].TxOut
+	for i := len(outputs) - 1; i >= 0; i-- {
+		script := outputs[i].PkScript
+		if len(script) >= len(witnessCommitmentHeader)+len(Hash{}) &&
+			bytes.HasPrefix(script, witnessCommitmentHeader) {
+			commitment := Hash{}
+			copy(commitment[:], script[len(witnessCommitmentHeader):])
+			return commitment, true
+		}
+	}
+	return Hash{}, false
+}
+
+func (block *MsgBlock) Encode(writer io.Writer) error {
+	count := VarInt(len(block.Transactions))
+	steps := []*encodeStep{
+		step("header", &block.Header),
+		step("txn_count", &count),
+	}
+	for i := range block.Transactions {
+		steps = append(steps, step("tx", &block.Transactions[i]))
+	}
+	err := encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding block fields: %w", err)
+	}
+	return nil
+}
+
+func (block *MsgBlock) Decode(reader io.Reader) error {
+	err := (&block.Header).Decode(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding block header: %w", err)
+	}
+	count, err := decodeCount(reader, maxBlockTxs, minTxEncodedSize)
+	if err != nil {
+		return fmt.Errorf("error decoding block txn_count: %w", err)
+	}
+	block.Transactions = make([]MsgTx, count)
+	for i := range block.Transactions {
+		err = (&block.Transactions[i]).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding block tx %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// MerkleRoot computes the merkle root of the hashes the way Bitcoin does:
+// levels with an odd number of hashes duplicate the last one.
+func MerkleRoot(hashes []Hash) Hash {
+	if len(hashes) == 0 {
+		return Hash{}
+	}
+	level := append([]Hash(nil), hashes...)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		next := level[:0]
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, DoubleSHA256(append(level[i][:], level[i+1][:]...)))
+		}
+		level = next
+	}
+	return level[0]
+}
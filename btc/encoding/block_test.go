@@ -0,0 +1,86 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Block_DecodeGenesis(t *testing.T) {
+	raw := append(append(append([]byte{}, genesisHeaderBytes...), 0x01), mustHex(t, genesisCoinbaseHex)...)
+
+	_, msg, err := ReceiveMessage(NetworkMainnet, frame(t, NetworkMainnet, BlockCommand, raw))
+	require.NoError(t, err)
+	block, ok := msg.(*MsgBlock)
+	require.True(t, ok, "got %T", msg)
+
+	assert.Equal(t, "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f", block.BlockHash().String())
+	require.Len(t, block.Transactions, 1)
+	assert.Equal(t, block.Header.MerkleRoot, block.MerkleRoot())
+	_, ok = block.CoinbaseWitnessCommitment()
+	assert.False(t, ok)
+	_, err = block.WitnessCommitment()
+	assert.EqualError(t, err, "coinbase witness is not a single 32 byte reserved value")
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, block.Encode(buf))
+	assert.Equal(t, raw, buf.Bytes())
+}
+
+func Test_Block_WitnessCommitment(t *testing.T) {
+	segwitTx := &MsgTx{}
+	require.NoError(t, segwitTx.Decode(bytes.NewReader(mustHex(t, segwitTxHex))))
+	coinbase := MsgTx{
+		Version: 2,
+		TxIn: []TxIn{{
+			PreviousOutPoint: OutPoint{Index: 0xffffffff},
+			SignatureScript:  VarBytes{0x51, 0x00},
+			Sequence:         0xffffffff,
+			Witness:          TxWitness{make(VarBytes, 32)},
+		}},
+		TxOut: []TxOut{{Value: 5_000_000_000, PkScript: VarBytes{0x51}}},
+	}
+	block := &MsgBlock{Transactions: []MsgTx{coinbase, *segwitTx}}
+
+	// The witness root ignores the coinbase wtxid.
+	assert.Equal(t, MerkleRoot([]Hash{{}, segwitTx.WitnessHash()}), block.WitnessMerkleRoot())
+	assert.Equal(t, MerkleRoot([]Hash{coinbase.TxHash(), segwitTx.TxHash()}), block.MerkleRoot())
+
+	commitment, err := block.WitnessCommitment()
+	require.NoError(t, err)
+	script := append(append(VarBytes{}, witnessCommitmentHeader...), commitment[:]...)
+	block.Transactions[0].TxOut = append(block.Transactions[0].TxOut, TxOut{PkScript: script})
+	block.Header.MerkleRoot = block.MerkleRoot()
+
+	stored, ok := block.CoinbaseWitnessCommitment()
+	require.True(t, ok)
+	assert.Equal(t, commitment, stored)
+
+	// Roundtrip the block through the wire format.
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, SendMessage(NetworkRegtest, block, buf))
+	_, msg, err := ReceiveMessage(NetworkRegtest, buf)
+	require.NoError(t, err)
+	assert.Equal(t, block, msg)
+}
+
+func Test_MerkleRoot(t *testing.T) {
+	assert.Equal(t, Hash{}, MerkleRoot(nil))
+	assert.Equal(t, Hash{0x01}, MerkleRoot([]Hash{{0x01}}))
+	// An odd level duplicates its last hash.
+	assert.Equal(t, "e9ffb584c62449f157c8be88257bd1eebb2d8ef824f5c86b43c4f8fd9e800d6a",
+		MerkleRoot([]Hash{{0x01}, {0x02}, {0x03}}).String())
+}
+
+// Wraps a payload in a message header.
+func frame(t *testing.T, network Network, command Command, payload []byte) *bytes.Buffer {
+	t.Helper()
+	header, err := NewHeader(network, command, payload)
+	require.NoError(t, err)
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, header.Encode(buf))
+	buf.Write(payload)
+	return buf
+}
@@ -0,0 +1,47 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+)
+
+const BlockHeaderSize = 80
+
+type BlockHeader struct {
+	Version    UInt32
+	PrevBlock  Hash
+	MerkleRoot Hash
+	Timestamp  UInt32
+	Bits       UInt32
+	Nonce      UInt32
+}
+
+// Hash returns the block hash: the double SHA-256 of the serialized header.
+func (header *BlockHeader) Hash() Hash {
+	buf := bytes.NewBuffer(make([]byte, 0, BlockHeaderSize))
+	// Writing to a bytes.Buffer can't fail.
+	_ = header.Encode(buf)
+	return DoubleSHA256(buf.Bytes())
+}
+
+func (header *BlockHeader) Encode(writer io.Writer) error {
+	return encode(writer,
+		step("version", &header.Version),
+		step("prev_block", &header.PrevBlock),
+		step("merkle_root", &header.MerkleRoot),
+		step("timestamp", &header.Timestamp),
+		step("bits", &header.Bits),
+		step("nonce", &header.Nonce),
+	)
+}
+
+func (header *BlockHeader) Decode(reader io.Reader) error {
+	return decode(reader,
+		step("version", &header.Version),
+		step("prev_block", &header.PrevBlock),
+		step("merkle_root", &header.MerkleRoot),
+		step("timestamp", &header.Timestamp),
+		step("bits", &header.Bits),
+		step("nonce", &header.Nonce),
+	)
+}
@@ -0,0 +1,48 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Mainnet genesis block header.
+var genesisHeaderBytes = unformatBinary(`
+	01 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+	00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+	00 00 00 00 3B A3 ED FD 7A 7B 12 B2 7A C7 2C 3E
+	67 76 8F 61 7F C8 1B C3 88 8A 51 32 3A 9F B8 AA
+	4B 1E 5E 4A 29 AB 5F 49 FF FF 00 1D 1D AC 2B 7C`)
+
+func Test_BlockHeader_Decode(t *testing.T) {
+	header := &BlockHeader{}
+	err := header.Decode(bytes.NewBuffer(genesisHeaderBytes))
+	assert.NoError(t, err)
+
+	assert.Equal(t, UInt32(1), header.Version)
+	assert.Equal(t, Hash{}, header.PrevBlock)
+	assert.Equal(t, "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b", header.MerkleRoot.String())
+	assert.Equal(t, UInt32(1231006505), header.Timestamp)
+	assert.Equal(t, UInt32(0x1d00ffff), header.Bits)
+	assert.Equal(t, UInt32(2083236893), header.Nonce)
+	assert.Equal(t, "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f", header.Hash().String())
+
+	buf := bytes.NewBuffer(nil)
+	err = header.Encode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, genesisHeaderBytes, buf.Bytes())
+}
+
+func Test_NewHashFromString(t *testing.T) {
+	s := "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	hash, err := NewHashFromString(s)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x6F), hash[0])
+	assert.Equal(t, s, hash.String())
+
+	_, err = NewHashFromString("abcd")
+	assert.ErrorContains(t, err, "expected 32 bytes, got 2")
+	_, err = NewHashFromString("xyz")
+	assert.ErrorContains(t, err, "invalid hash")
+}
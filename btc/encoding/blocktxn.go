@@ -0,0 +1,52 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgBlockTxn answers a getblocktxn with the requested transactions in the
+// order they were asked for (BIP152).
+type MsgBlockTxn struct {
+	BlockHash    Hash
+	Transactions []MsgTx
+}
+
+func (blockTxn *MsgBlockTxn) GetCommand() Command {
+	return BlockTxnCommand
+}
+
+func (blockTxn *MsgBlockTxn) Encode(writer io.Writer) error {
+	count := VarInt(len(blockTxn.Transactions))
+	steps := []*encodeStep{
+		step("block_hash", &blockTxn.BlockHash),
+		step("transactions_length", &count),
+	}
+	for i := range blockTxn.Transactions {
+		steps = append(steps, step("tx", &blockTxn.Transactions[i]))
+	}
+	err := encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding blocktxn fields: %w", err)
+	}
+	return nil
+}
+
+func (blockTxn *MsgBlockTxn) Decode(reader io.Reader) error {
+	err := (&blockTxn.BlockHash).Decode(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding blocktxn block_hash: %w", err)
+	}
+	count, err := decodeCount(reader, maxBlockTxs, minTxEncodedSize)
+	if err != nil {
+		return fmt.Errorf("error decoding blocktxn transactions_length: %w", err)
+	}
+	blockTxn.Transactions = make([]MsgTx, count)
+	for i := range blockTxn.Transactions {
+		err = (&blockTxn.Transactions[i]).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding blocktxn tx %d: %w", i, err)
+		}
+	}
+	return nil
+}
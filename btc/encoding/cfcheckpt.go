@@ -0,0 +1,64 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// The filter headers in a cfcheckpt are for the blocks at multiples of this
+// height.
+const CFCheckptInterval = 1000
+
+// A checkpoint takes 32 bytes, so the payload limit bounds their number.
+const maxCFCheckpts = DefaultMaxPayloadSize / 32
+
+// MsgCFCheckpt carries the filter headers at every CFCheckptInterval blocks
+// up to StopHash, starting at height 1000 (BIP157).
+type MsgCFCheckpt struct {
+	FilterType    FilterType
+	StopHash      Hash
+	FilterHeaders []Hash
+}
+
+func (cfCheckpt *MsgCFCheckpt) GetCommand() Command {
+	return CFCheckptCommand
+}
+
+func (cfCheckpt *MsgCFCheckpt) Encode(writer io.Writer) error {
+	count := VarInt(len(cfCheckpt.FilterHeaders))
+	steps := []*encodeStep{
+		step("filter_type", &cfCheckpt.FilterType),
+		step("stop_hash", &cfCheckpt.StopHash),
+		step("filter_headers_length", &count),
+	}
+	for i := range cfCheckpt.FilterHeaders {
+		steps = append(steps, step("filter_header", &cfCheckpt.FilterHeaders[i]))
+	}
+	err := encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding cfcheckpt fields: %w", err)
+	}
+	return nil
+}
+
+func (cfCheckpt *MsgCFCheckpt) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("filter_type", &cfCheckpt.FilterType),
+		step("stop_hash", &cfCheckpt.StopHash),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding cfcheckpt fields: %w", err)
+	}
+	count, err := decodeCount(reader, maxCFCheckpts, hashSize)
+	if err != nil {
+		return fmt.Errorf("error decoding cfcheckpt filter_headers_length: %w", err)
+	}
+	cfCheckpt.FilterHeaders = make([]Hash, count)
+	for i := range cfCheckpt.FilterHeaders {
+		err = (&cfCheckpt.FilterHeaders[i]).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding cfcheckpt filter_header %d: %w", i, err)
+		}
+	}
+	return nil
+}
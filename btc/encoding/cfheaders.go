@@ -0,0 +1,61 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgCFHeaders carries the filter hashes of a range of blocks and the filter
+// header of the block before it, so the receiver can compute the filter
+// headers (BIP157).
+type MsgCFHeaders struct {
+	FilterType           FilterType
+	StopHash             Hash
+	PreviousFilterHeader Hash
+	FilterHashes         []Hash
+}
+
+func (cfHeaders *MsgCFHeaders) GetCommand() Command {
+	return CFHeadersCommand
+}
+
+func (cfHeaders *MsgCFHeaders) Encode(writer io.Writer) error {
+	count := VarInt(len(cfHeaders.FilterHashes))
+	steps := []*encodeStep{
+		step("filter_type", &cfHeaders.FilterType),
+		step("stop_hash", &cfHeaders.StopHash),
+		step("previous_filter_header", &cfHeaders.PreviousFilterHeader),
+		step("filter_hashes_length", &count),
+	}
+	for i := range cfHeaders.FilterHashes {
+		steps = append(steps, step("filter_hash", &cfHeaders.FilterHashes[i]))
+	}
+	err := encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding cfheaders fields: %w", err)
+	}
+	return nil
+}
+
+func (cfHeaders *MsgCFHeaders) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("filter_type", &cfHeaders.FilterType),
+		step("stop_hash", &cfHeaders.StopHash),
+		step("previous_filter_header", &cfHeaders.PreviousFilterHeader),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding cfheaders fields: %w", err)
+	}
+	count, err := decodeCount(reader, MaxCFHeadersPerMsg, hashSize)
+	if err != nil {
+		return fmt.Errorf("error decoding cfheaders filter_hashes_length: %w", err)
+	}
+	cfHeaders.FilterHashes = make([]Hash, count)
+	for i := range cfHeaders.FilterHashes {
+		err = (&cfHeaders.FilterHashes[i]).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding cfheaders filter_hash %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// FilterType identifies a BIP158 filter type. Basic is the only one defined.
+type FilterType = UInt8
+
+const FilterTypeBasic FilterType = 0x00
+
+// MsgCFilter carries the compact filter of a block (BIP157).
+type MsgCFilter struct {
+	FilterType FilterType
+	BlockHash  Hash
+	Filter     VarBytes
+}
+
+func (cfilter *MsgCFilter) GetCommand() Command {
+	return CFilterCommand
+}
+
+func (cfilter *MsgCFilter) Encode(writer io.Writer) error {
+	err := encode(writer,
+		step("filter_type", &cfilter.FilterType),
+		step("block_hash", &cfilter.BlockHash),
+		step("filter_bytes", &cfilter.Filter),
+	)
+	if err != nil {
+		return fmt.Errorf("error encoding cfilter fields: %w", err)
+	}
+	return nil
+}
+
+func (cfilter *MsgCFilter) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("filter_type", &cfilter.FilterType),
+		step("block_hash", &cfilter.BlockHash),
+		step("filter_bytes", &cfilter.Filter),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding cfilter fields: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package encoding
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FilterMessages_Roundtrip(t *testing.T) {
+	stop := Hash{1}
+	tests := []struct {
+		msg         Message
+		payloadSize UInt32
+	}{
+		{msg: noErr(t, func() (*MsgGetCFilters, error) { return NewGetCFiltersMsg(FilterTypeBasic, 10, stop) }), payloadSize: 37},
+		{msg: &MsgCFilter{BlockHash: stop, Filter: VarBytes{0x01, 0x9d, 0xfc, 0xa8}}, payloadSize: 38},
+		{msg: noErr(t, func() (*MsgGetCFHeaders, error) { return NewGetCFHeadersMsg(FilterTypeBasic, 10, stop) }), payloadSize: 37},
+		{msg: &MsgCFHeaders{StopHash: stop, PreviousFilterHeader: Hash{2}, FilterHashes: []Hash{{3}, {4}}}, payloadSize: 130},
+		{msg: noErr(t, func() (*MsgGetCFCheckpt, error) { return NewGetCFCheckptMsg(FilterTypeBasic, stop) }), payloadSize: 33},
+		{msg: &MsgCFCheckpt{StopHash: stop, FilterHeaders: []Hash{{5}}}, payloadSize: 66},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.msg.GetCommand()), func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			assert.NoError(t, SendMessage(NetworkMainnet, tt.msg, buf))
+			header, got, err := ReceiveMessage(NetworkMainnet, buf)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.msg.GetCommand(), header.GetCommand())
+			assert.Equal(t, tt.payloadSize, header.PayloadSize)
+			assert.Equal(t, tt.msg, got)
+		})
+	}
+}
+
+func Test_CFHeaders_DecodeTooMany(t *testing.T) {
+	// filter type, stop hash, previous header and a count of 2001.
+	raw := "00 " + strings.Repeat("00 ", 64) + "FD D1 07"
+	err := (&MsgCFHeaders{}).Decode(bytes.NewReader(unformatBinary(raw)))
+	assert.Error(t, err)
+}
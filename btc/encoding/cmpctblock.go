@@ -0,0 +1,206 @@
+package encoding
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Short transaction ids are the lower 6 bytes of a SipHash-2-4.
+const shortIDSize = 6
+
+// ShortID identifies a transaction in a compact block (BIP152).
+type ShortID uint64
+
+func (id *ShortID) Encode(writer io.Writer) error {
+	var buf [8]byte
+	le.PutUint64(buf[:], uint64(*id))
+	_, err := writer.Write(buf[:shortIDSize])
+	if err != nil {
+		return errors.Wrap(err, "short id write error")
+	}
+	return nil
+}
+
+func (id *ShortID) Decode(reader io.Reader) error {
+	var buf [8]byte
+	_, err := io.ReadFull(reader, buf[:shortIDSize])
+	if err != nil {
+		return errors.Wrap(err, "short id read error")
+	}
+	*id = ShortID(le.Uint64(buf[:]))
+	return nil
+}
+
+// PrefilledTx is a transaction sent in full with a compact block, usually the
+// coinbase. Index is the position in the block.
+type PrefilledTx struct {
+	Index uint16
+	Tx    MsgTx
+}
+
+// MsgCmpctBlock announces a block with short ids of its transactions, which
+// the receiver looks up in its own pool (BIP152). We only speak version 2,
+// where the short ids come from wtxids.
+type MsgCmpctBlock struct {
+	Header       BlockHeader
+	Nonce        UInt64
+	ShortIDs     []ShortID
+	PrefilledTxs []PrefilledTx
+}
+
+// NewCmpctBlockMsg builds a compact block with the coinbase prefilled.
+func NewCmpctBlockMsg(block *MsgBlock, nonce uint64) (*MsgCmpctBlock, error) {
+	if len(block.Transactions) == 0 {
+		return nil, errors.New("block has no transactions")
+	}
+	if len(block.Transactions) > math.MaxUint16+1 {
+		return nil, fmt.Errorf("too many transactions for a compact block: %d", len(block.Transactions))
+	}
+	cmpct := &MsgCmpctBlock{
+		Header:       block.Header,
+		Nonce:        UInt64(nonce),
+		ShortIDs:     make([]ShortID, 0, len(block.Transactions)-1),
+		PrefilledTxs: []PrefilledTx{{Index: 0, Tx: block.Transactions[0]}},
+	}
+	for i := 1; i < len(block.Transactions); i++ {
+		cmpct.ShortIDs = append(cmpct.ShortIDs, cmpct.ShortID(block.Transactions[i].WitnessHash()))
+	}
+	return cmpct, nil
+}
+
+func (cmpct *MsgCmpctBlock) GetCommand() Command {
+	return CmpctBlockCommand
+}
+
+// TxCount returns the number of transactions in the block.
+func (cmpct *MsgCmpctBlock) TxCount() int {
+	return len(cmpct.ShortIDs) + len(cmpct.PrefilledTxs)
+}
+
+// ShortID computes the short id of a transaction from its wtxid. The SipHash
+// key is the SHA-256 of the header and the nonce, so it differs per block and
+// per peer.
+func (cmpct *MsgCmpctBlock) ShortID(wtxid Hash) ShortID {
+	buf := bytes.NewBuffer(make([]byte, 0, BlockHeaderSize+8))
+	// Writing to a bytes.Buffer can't fail.
+	_ = cmpct.Header.Encode(buf)
+	_ = cmpct.Nonce.Encode(buf)
+	key := sha256.Sum256(buf.Bytes())
+	hash := SipHash24(le.Uint64(key[0:8]), le.Uint64(key[8:16]), wtxid[:])
+	return ShortID(hash & (1<<(8*shortIDSize) - 1))
+}
+
+func (cmpct *MsgCmpctBlock) Encode(writer io.Writer) error {
+	idCount := VarInt(len(cmpct.ShortIDs))
+	steps := []*encodeStep{
+		step("header", &cmpct.Header),
+		step("nonce", &cmpct.Nonce),
+		step("shortids_length", &idCount),
+	}
+	for i := range cmpct.ShortIDs {
+		steps = append(steps, step("shortid", &cmpct.ShortIDs[i]))
+	}
+
+	indexes := make([]uint16, len(cmpct.PrefilledTxs))
+	for i := range cmpct.PrefilledTxs {
+		indexes[i] = cmpct.PrefilledTxs[i].Index
+	}
+	diffs, err := differentialIndexes(indexes)
+	if err != nil {
+		return fmt.Errorf("error encoding prefilled txs: %w", err)
+	}
+	prefilledCount := VarInt(len(cmpct.PrefilledTxs))
+	steps = append(steps, step("prefilled_txn_length", &prefilledCount))
+	for i := range cmpct.PrefilledTxs {
+		steps = append(steps,
+			step("prefilled_index", &diffs[i]),
+			step("prefilled_tx", &cmpct.PrefilledTxs[i].Tx),
+		)
+	}
+
+	err = encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding cmpctblock fields: %w", err)
+	}
+	return nil
+}
+
+func (cmpct *MsgCmpctBlock) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("header", &cmpct.Header),
+		step("nonce", &cmpct.Nonce),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding cmpctblock fields: %w", err)
+	}
+
+	idCount, err := decodeCount(reader, maxBlockTxs, shortIDSize)
+	if err != nil {
+		return fmt.Errorf("error decoding cmpctblock shortids_length: %w", err)
+	}
+	cmpct.ShortIDs = make([]ShortID, idCount)
+	for i := range cmpct.ShortIDs {
+		err = (&cmpct.ShortIDs[i]).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding cmpctblock shortid %d: %w", i, err)
+		}
+	}
+
+	prefilledCount, err := decodeCount(reader, maxBlockTxs, 1+minTxEncodedSize)
+	if err != nil {
+		return fmt.Errorf("error decoding cmpctblock prefilled_txn_length: %w", err)
+	}
+	cmpct.PrefilledTxs = make([]PrefilledTx, prefilledCount)
+	next := 0
+	for i := range cmpct.PrefilledTxs {
+		prefilled := &cmpct.PrefilledTxs[i]
+		prefilled.Index, err = decodeDifferentialIndex(reader, next)
+		if err != nil {
+			return fmt.Errorf("error decoding cmpctblock prefilled index %d: %w", i, err)
+		}
+		next = int(prefilled.Index) + 1
+		err = (&prefilled.Tx).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding cmpctblock prefilled tx %d: %w", i, err)
+		}
+	}
+
+	if cmpct.TxCount() > maxBlockTxs {
+		return fmt.Errorf("too many transactions: %d, limit is %d", cmpct.TxCount(), maxBlockTxs)
+	}
+	return nil
+}
+
+// BIP152 sends ascending indexes as the difference to the previous index
+// minus one.
+func differentialIndexes(indexes []uint16) ([]VarInt, error) {
+	diffs := make([]VarInt, len(indexes))
+	next := 0
+	for i, index := range indexes {
+		if int(index) < next {
+			return nil, fmt.Errorf("indexes are not ascending: %d after %d", index, next-1)
+		}
+		diffs[i] = VarInt(int(index) - next)
+		next = int(index) + 1
+	}
+	return diffs, nil
+}
+
+// Reads one differentially encoded index. next is the smallest index the
+// difference applies to. Indexes are limited to 16 bits like in Bitcoin Core.
+func decodeDifferentialIndex(reader io.Reader, next int) (uint16, error) {
+	diff := VarInt(0)
+	err := (&diff).Decode(reader)
+	if err != nil {
+		return 0, errors.Wrap(err, "index read error")
+	}
+	if uint64(diff) > math.MaxUint16 || next+int(diff) > math.MaxUint16 {
+		return 0, fmt.Errorf("index overflows 16 bits: %d after %d", uint64(diff), next)
+	}
+	return uint16(next + int(diff)), nil
+}
@@ -0,0 +1,92 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBlock(t *testing.T) *MsgBlock {
+	t.Helper()
+	coinbase, segwit := MsgTx{}, MsgTx{}
+	require.NoError(t, coinbase.Decode(bytes.NewReader(mustHex(t, genesisCoinbaseHex))))
+	require.NoError(t, segwit.Decode(bytes.NewReader(mustHex(t, segwitTxHex))))
+	block := &MsgBlock{
+		Header:       BlockHeader{Version: 0x20000000, Timestamp: 1700000000, Bits: 0x207fffff},
+		Transactions: []MsgTx{coinbase, segwit},
+	}
+	block.Header.MerkleRoot = block.MerkleRoot()
+	return block
+}
+
+func Test_CmpctBlock_Roundtrip(t *testing.T) {
+	block := testBlock(t)
+	cmpct, err := NewCmpctBlockMsg(block, 42)
+	require.NoError(t, err)
+	assert.Equal(t, 2, cmpct.TxCount())
+	require.Len(t, cmpct.ShortIDs, 1)
+	assert.Less(t, uint64(cmpct.ShortIDs[0]), uint64(1)<<48)
+	assert.Equal(t, cmpct.ShortID(block.Transactions[1].WitnessHash()), cmpct.ShortIDs[0])
+
+	// A different nonce changes the short ids.
+	other, err := NewCmpctBlockMsg(block, 43)
+	require.NoError(t, err)
+	assert.NotEqual(t, cmpct.ShortIDs, other.ShortIDs)
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, SendMessage(NetworkRegtest, cmpct, buf))
+	header, got, err := ReceiveMessage(NetworkRegtest, buf)
+	require.NoError(t, err)
+	assert.Equal(t, CmpctBlockCommand, header.GetCommand())
+	assert.Equal(t, cmpct, got)
+}
+
+func Test_GetBlockTxn_Encode(t *testing.T) {
+	getBlockTxn, err := NewGetBlockTxnMsg(Hash{0x01}, []uint16{0, 1, 5, 6})
+	require.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, getBlockTxn.Encode(buf))
+	want := strip(`
+	01 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+	00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+	04 00 00 03 00`)
+	assert.Equal(t, want, formatBinary(buf.Bytes()))
+
+	got := &MsgGetBlockTxn{}
+	require.NoError(t, got.Decode(buf))
+	assert.Equal(t, getBlockTxn, got)
+}
+
+func Test_GetBlockTxn_Errors(t *testing.T) {
+	_, err := NewGetBlockTxnMsg(Hash{}, []uint16{3, 3})
+	assert.ErrorContains(t, err, "indexes are not ascending")
+
+	tests := []struct {
+		name    string
+		indexes string
+	}{
+		{name: "overflowing difference", indexes: "01 FE 00 00 01 00"},
+		{name: "overflowing index", indexes: "02 FD FF FF FD 01 00"},
+		{name: "truncated", indexes: "02 00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := append(make([]byte, 32), unformatBinary(tt.indexes)...)
+			assert.Error(t, (&MsgGetBlockTxn{}).Decode(bytes.NewReader(payload)))
+		})
+	}
+}
+
+func Test_BlockTxn_Roundtrip(t *testing.T) {
+	block := testBlock(t)
+	blockTxn := &MsgBlockTxn{BlockHash: block.BlockHash(), Transactions: block.Transactions[1:]}
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, SendMessage(NetworkRegtest, blockTxn, buf))
+	_, got, err := ReceiveMessage(NetworkRegtest, buf)
+	require.NoError(t, err)
+	assert.Equal(t, blockTxn, got)
+}
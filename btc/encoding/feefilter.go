@@ -0,0 +1,39 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// Peers support feefilter from this protocol version (BIP133).
+const FeeFilterVersion = 70013
+
+// MsgFeeFilter asks the peer not to announce transactions paying less than
+// the fee rate, in satoshis per 1000 virtual bytes (BIP133).
+type MsgFeeFilter struct {
+	FeeRate UInt64
+}
+
+func NewFeeFilterMsg(feeRate uint64) (*MsgFeeFilter, error) {
+	return &MsgFeeFilter{FeeRate: UInt64(feeRate)}, nil
+}
+
+func (feeFilter *MsgFeeFilter) GetCommand() Command {
+	return FeeFilterCommand
+}
+
+func (feeFilter *MsgFeeFilter) Encode(writer io.Writer) error {
+	err := encode(writer, step("feerate", &feeFilter.FeeRate))
+	if err != nil {
+		return fmt.Errorf("error encoding feefilter fields: %w", err)
+	}
+	return nil
+}
+
+func (feeFilter *MsgFeeFilter) Decode(reader io.Reader) error {
+	err := decode(reader, step("feerate", &feeFilter.FeeRate))
+	if err != nil {
+		return fmt.Errorf("error decoding feefilter fields: %w", err)
+	}
+	return nil
+}
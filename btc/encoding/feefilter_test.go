@@ -0,0 +1,41 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FeeFilter_Encode(t *testing.T) {
+	feeFilter, err := NewFeeFilterMsg(1000)
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, feeFilter.Encode(buf))
+	assert.Equal(t, "E8 03 00 00 00 00 00 00", formatBinary(buf.Bytes()))
+}
+
+func Test_NegotiationMessages_Roundtrip(t *testing.T) {
+	tests := []struct {
+		msg         Message
+		payloadSize UInt32
+	}{
+		{msg: noErr(t, NewSendHeadersMsg), payloadSize: 0},
+		{msg: noErr(t, NewWTxIDRelayMsg), payloadSize: 0},
+		{msg: noErr(t, func() (*MsgFeeFilter, error) { return NewFeeFilterMsg(1000) }), payloadSize: 8},
+		{msg: noErr(t, func() (*MsgSendCmpct, error) { return NewSendCmpctMsg(true, CmpctBlocksVersion) }), payloadSize: 9},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.msg.GetCommand()), func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			assert.NoError(t, SendMessage(NetworkMainnet, tt.msg, buf))
+			header, got, err := ReceiveMessage(NetworkMainnet, buf)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.msg.GetCommand(), header.GetCommand())
+			assert.Equal(t, tt.payloadSize, header.PayloadSize)
+			assert.Equal(t, tt.msg, got)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// Items added to a loaded filter can't be larger than a script element.
+const MaxFilterAddSize = 520
+
+// MsgFilterAdd adds a single item to the loaded bloom filter (BIP37).
+type MsgFilterAdd struct {
+	Data VarBytes
+}
+
+func NewFilterAddMsg(data []byte) (*MsgFilterAdd, error) {
+	if len(data) > MaxFilterAddSize {
+		return nil, fmt.Errorf("filteradd data is %d bytes, limit is %d", len(data), MaxFilterAddSize)
+	}
+	return &MsgFilterAdd{Data: data}, nil
+}
+
+func (filterAdd *MsgFilterAdd) GetCommand() Command {
+	return FilterAddCommand
+}
+
+func (filterAdd *MsgFilterAdd) Encode(writer io.Writer) error {
+	err := encode(writer, step("data", &filterAdd.Data))
+	if err != nil {
+		return fmt.Errorf("error encoding filteradd fields: %w", err)
+	}
+	return nil
+}
+
+func (filterAdd *MsgFilterAdd) Decode(reader io.Reader) error {
+	err := decode(reader, step("data", &filterAdd.Data))
+	if err != nil {
+		return fmt.Errorf("error decoding filteradd fields: %w", err)
+	}
+	if len(filterAdd.Data) > MaxFilterAddSize {
+		return fmt.Errorf("filteradd data too large: %d bytes", len(filterAdd.Data))
+	}
+	return nil
+}
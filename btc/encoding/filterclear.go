@@ -0,0 +1,27 @@
+package encoding
+
+import (
+	"io"
+)
+
+// MsgFilterClear removes the loaded bloom filter, so the peer relays all
+// transactions again (BIP37).
+type MsgFilterClear struct {
+	// filterclear has no body and contains just a header
+}
+
+func NewFilterClearMsg() (*MsgFilterClear, error) {
+	return &MsgFilterClear{}, nil
+}
+
+func (filterClear *MsgFilterClear) GetCommand() Command {
+	return FilterClearCommand
+}
+
+func (filterClear *MsgFilterClear) Encode(writer io.Writer) error {
+	return nil
+}
+
+func (filterClear *MsgFilterClear) Decode(reader io.Reader) error {
+	return nil
+}
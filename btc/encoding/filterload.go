@@ -0,0 +1,66 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// Limits on filterload from BIP37, Bitcoin Core bans peers going over them.
+const (
+	MaxBloomFilterSize = 36000
+	MaxBloomHashFuncs  = 50
+)
+
+// BloomUpdate tells the peer how to update the filter when an output matches.
+type BloomUpdate = UInt8
+
+const (
+	BloomUpdateNone BloomUpdate = 0
+	// Add the outpoint of every matched output.
+	BloomUpdateAll BloomUpdate = 1
+	// Add the outpoint only for pay-to-pubkey and bare multisig outputs.
+	BloomUpdateP2PubkeyOnly BloomUpdate = 2
+)
+
+// MsgFilterLoad sets a bloom filter on the connection, after which the peer
+// only relays matching transactions and answers filtered block requests with
+// merkleblock (BIP37).
+type MsgFilterLoad struct {
+	Filter    VarBytes
+	HashFuncs UInt32
+	Tweak     UInt32
+	Flags     BloomUpdate
+}
+
+func (filterLoad *MsgFilterLoad) GetCommand() Command {
+	return FilterLoadCommand
+}
+
+func (filterLoad *MsgFilterLoad) Encode(writer io.Writer) error {
+	err := encode(writer,
+		step("filter", &filterLoad.Filter),
+		step("n_hash_funcs", &filterLoad.HashFuncs),
+		step("n_tweak", &filterLoad.Tweak),
+		step("n_flags", &filterLoad.Flags),
+	)
+	if err != nil {
+		return fmt.Errorf("error encoding filterload fields: %w", err)
+	}
+	return nil
+}
+
+func (filterLoad *MsgFilterLoad) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("filter", &filterLoad.Filter),
+		step("n_hash_funcs", &filterLoad.HashFuncs),
+		step("n_tweak", &filterLoad.Tweak),
+		step("n_flags", &filterLoad.Flags),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding filterload fields: %w", err)
+	}
+	if len(filterLoad.Filter) > MaxBloomFilterSize || filterLoad.HashFuncs > MaxBloomHashFuncs {
+		return fmt.Errorf("filterload too large: %d bytes, %d hash functions", len(filterLoad.Filter), filterLoad.HashFuncs)
+	}
+	return nil
+}
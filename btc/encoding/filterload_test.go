@@ -0,0 +1,55 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BloomMessages_Roundtrip(t *testing.T) {
+	tests := []struct {
+		msg         Message
+		payloadSize UInt32
+	}{
+		{msg: &MsgFilterLoad{Filter: VarBytes{0x61, 0x4e, 0x9b}, HashFuncs: 5, Flags: BloomUpdateAll}, payloadSize: 13},
+		{msg: noErr(t, func() (*MsgFilterAdd, error) { return NewFilterAddMsg([]byte{1, 2, 3}) }), payloadSize: 4},
+		{msg: noErr(t, NewFilterClearMsg), payloadSize: 0},
+		{
+			msg: &MsgMerkleBlock{
+				Header:            BlockHeader{Version: 1, MerkleRoot: Hash{1}},
+				TotalTransactions: 3,
+				Hashes:            []Hash{{2}, {3}},
+				Flags:             VarBytes{0x1d},
+			},
+			payloadSize: 80 + 4 + 1 + 64 + 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.msg.GetCommand()), func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			assert.NoError(t, SendMessage(NetworkMainnet, tt.msg, buf))
+			header, got, err := ReceiveMessage(NetworkMainnet, buf)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.msg.GetCommand(), header.GetCommand())
+			assert.Equal(t, tt.payloadSize, header.PayloadSize)
+			assert.Equal(t, tt.msg, got)
+		})
+	}
+}
+
+func Test_BloomMessages_Limits(t *testing.T) {
+	_, err := NewFilterAddMsg(make([]byte, MaxFilterAddSize+1))
+	assert.Error(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	tooMany := &MsgFilterLoad{Filter: VarBytes{0}, HashFuncs: MaxBloomHashFuncs + 1}
+	assert.NoError(t, tooMany.Encode(buf))
+	assert.Error(t, (&MsgFilterLoad{}).Decode(buf))
+
+	buf.Reset()
+	tooLarge := &MsgFilterLoad{Filter: make(VarBytes, MaxBloomFilterSize+1), HashFuncs: 1}
+	assert.NoError(t, tooLarge.Encode(buf))
+	assert.Error(t, (&MsgFilterLoad{}).Decode(buf))
+}
@@ -0,0 +1,25 @@
+package encoding
+
+import (
+	"io"
+)
+
+type MsgGetAddr struct {
+	// getaddr has no body and contains just a header
+}
+
+func NewGetAddrMsg() (*MsgGetAddr, error) {
+	return &MsgGetAddr{}, nil
+}
+
+func (getAddr *MsgGetAddr) GetCommand() Command {
+	return GetAddrCommand
+}
+
+func (getAddr *MsgGetAddr) Encode(writer io.Writer) error {
+	return nil
+}
+
+func (getAddr *MsgGetAddr) Decode(reader io.Reader) error {
+	return nil
+}
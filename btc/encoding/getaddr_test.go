@@ -0,0 +1,24 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GetAddr_Roundtrip(t *testing.T) {
+	msg, err := NewGetAddrMsg()
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+
+	err = SendMessage(NetworkMainnet, msg, buf)
+	assert.NoError(t, err)
+	header, got, err := ReceiveMessage(NetworkMainnet, buf)
+	assert.NoError(t, err)
+
+	assert.Equal(t, GetAddrCommand, header.GetCommand())
+	assert.Equal(t, UInt32(0), header.PayloadSize)
+	assert.Equal(t, msg, got)
+}
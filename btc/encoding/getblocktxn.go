@@ -0,0 +1,66 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgGetBlockTxn asks for the transactions of a compact block we could not
+// find in our pool, by their position in the block (BIP152).
+type MsgGetBlockTxn struct {
+	BlockHash Hash
+	Indexes   []uint16
+}
+
+func NewGetBlockTxnMsg(blockHash Hash, indexes []uint16) (*MsgGetBlockTxn, error) {
+	_, err := differentialIndexes(indexes)
+	if err != nil {
+		return nil, err
+	}
+	return &MsgGetBlockTxn{BlockHash: blockHash, Indexes: indexes}, nil
+}
+
+func (getBlockTxn *MsgGetBlockTxn) GetCommand() Command {
+	return GetBlockTxnCommand
+}
+
+func (getBlockTxn *MsgGetBlockTxn) Encode(writer io.Writer) error {
+	diffs, err := differentialIndexes(getBlockTxn.Indexes)
+	if err != nil {
+		return fmt.Errorf("error encoding getblocktxn indexes: %w", err)
+	}
+	count := VarInt(len(diffs))
+	steps := []*encodeStep{
+		step("block_hash", &getBlockTxn.BlockHash),
+		step("indexes_length", &count),
+	}
+	for i := range diffs {
+		steps = append(steps, step("index", &diffs[i]))
+	}
+	err = encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding getblocktxn fields: %w", err)
+	}
+	return nil
+}
+
+func (getBlockTxn *MsgGetBlockTxn) Decode(reader io.Reader) error {
+	err := (&getBlockTxn.BlockHash).Decode(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding getblocktxn block_hash: %w", err)
+	}
+	count, err := decodeCount(reader, maxBlockTxs, 1)
+	if err != nil {
+		return fmt.Errorf("error decoding getblocktxn indexes_length: %w", err)
+	}
+	getBlockTxn.Indexes = make([]uint16, count)
+	next := 0
+	for i := range getBlockTxn.Indexes {
+		getBlockTxn.Indexes[i], err = decodeDifferentialIndex(reader, next)
+		if err != nil {
+			return fmt.Errorf("error decoding getblocktxn index %d: %w", i, err)
+		}
+		next = int(getBlockTxn.Indexes[i]) + 1
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgGetCFCheckpt asks for the filter headers at every CFCheckptInterval
+// blocks up to StopHash (BIP157).
+type MsgGetCFCheckpt struct {
+	FilterType FilterType
+	StopHash   Hash
+}
+
+func NewGetCFCheckptMsg(filterType FilterType, stopHash Hash) (*MsgGetCFCheckpt, error) {
+	return &MsgGetCFCheckpt{FilterType: filterType, StopHash: stopHash}, nil
+}
+
+func (getCFCheckpt *MsgGetCFCheckpt) GetCommand() Command {
+	return GetCFCheckptCommand
+}
+
+func (getCFCheckpt *MsgGetCFCheckpt) Encode(writer io.Writer) error {
+	err := encode(writer,
+		step("filter_type", &getCFCheckpt.FilterType),
+		step("stop_hash", &getCFCheckpt.StopHash),
+	)
+	if err != nil {
+		return fmt.Errorf("error encoding getcfcheckpt fields: %w", err)
+	}
+	return nil
+}
+
+func (getCFCheckpt *MsgGetCFCheckpt) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("filter_type", &getCFCheckpt.FilterType),
+		step("stop_hash", &getCFCheckpt.StopHash),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding getcfcheckpt fields: %w", err)
+	}
+	return nil
+}
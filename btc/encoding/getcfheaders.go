@@ -0,0 +1,49 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// Peers answer at most 2000 filter hashes per getcfheaders.
+const MaxCFHeadersPerMsg = 2000
+
+// MsgGetCFHeaders asks for the filter hashes of the blocks from StartHeight up
+// to StopHash, answered with a cfheaders message (BIP157).
+type MsgGetCFHeaders struct {
+	FilterType  FilterType
+	StartHeight UInt32
+	StopHash    Hash
+}
+
+func NewGetCFHeadersMsg(filterType FilterType, startHeight uint32, stopHash Hash) (*MsgGetCFHeaders, error) {
+	return &MsgGetCFHeaders{FilterType: filterType, StartHeight: UInt32(startHeight), StopHash: stopHash}, nil
+}
+
+func (getCFHeaders *MsgGetCFHeaders) GetCommand() Command {
+	return GetCFHeadersCommand
+}
+
+func (getCFHeaders *MsgGetCFHeaders) Encode(writer io.Writer) error {
+	err := encode(writer,
+		step("filter_type", &getCFHeaders.FilterType),
+		step("start_height", &getCFHeaders.StartHeight),
+		step("stop_hash", &getCFHeaders.StopHash),
+	)
+	if err != nil {
+		return fmt.Errorf("error encoding getcfheaders fields: %w", err)
+	}
+	return nil
+}
+
+func (getCFHeaders *MsgGetCFHeaders) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("filter_type", &getCFHeaders.FilterType),
+		step("start_height", &getCFHeaders.StartHeight),
+		step("stop_hash", &getCFHeaders.StopHash),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding getcfheaders fields: %w", err)
+	}
+	return nil
+}
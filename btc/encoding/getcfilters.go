@@ -0,0 +1,49 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// Peers answer at most 1000 filters per getcfilters.
+const MaxGetCFiltersSize = 1000
+
+// MsgGetCFilters asks for the filters of the blocks from StartHeight up to
+// StopHash, answered with one cfilter per block (BIP157).
+type MsgGetCFilters struct {
+	FilterType  FilterType
+	StartHeight UInt32
+	StopHash    Hash
+}
+
+func NewGetCFiltersMsg(filterType FilterType, startHeight uint32, stopHash Hash) (*MsgGetCFilters, error) {
+	return &MsgGetCFilters{FilterType: filterType, StartHeight: UInt32(startHeight), StopHash: stopHash}, nil
+}
+
+func (getCFilters *MsgGetCFilters) GetCommand() Command {
+	return GetCFiltersCommand
+}
+
+func (getCFilters *MsgGetCFilters) Encode(writer io.Writer) error {
+	err := encode(writer,
+		step("filter_type", &getCFilters.FilterType),
+		step("start_height", &getCFilters.StartHeight),
+		step("stop_hash", &getCFilters.StopHash),
+	)
+	if err != nil {
+		return fmt.Errorf("error encoding getcfilters fields: %w", err)
+	}
+	return nil
+}
+
+func (getCFilters *MsgGetCFilters) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("filter_type", &getCFilters.FilterType),
+		step("start_height", &getCFilters.StartHeight),
+		step("stop_hash", &getCFilters.StopHash),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding getcfilters fields: %w", err)
+	}
+	return nil
+}
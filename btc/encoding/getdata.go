@@ -0,0 +1,38 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+type MsgGetData struct {
+	Inventory InvList
+}
+
+func NewGetDataMsg(inventory []InvVect) (*MsgGetData, error) {
+	list, err := newInvList(inventory)
+	if err != nil {
+		return nil, err
+	}
+	return &MsgGetData{Inventory: list}, nil
+}
+
+func (getData *MsgGetData) GetCommand() Command {
+	return GetDataCommand
+}
+
+func (getData *MsgGetData) Encode(writer io.Writer) error {
+	err := getData.Inventory.Encode(writer)
+	if err != nil {
+		return fmt.Errorf("error encoding getdata fields: %w", err)
+	}
+	return nil
+}
+
+func (getData *MsgGetData) Decode(reader io.Reader) error {
+	err := getData.Inventory.Decode(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding getdata fields: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// Same as Bitcoin Core's MAX_LOCATOR_SZ.
+const MaxLocatorHashes = 101
+
+type MsgGetHeaders struct {
+	Version  UInt32
+	Locator  []Hash
+	HashStop Hash
+}
+
+func NewGetHeadersMsg(locator []Hash, hashStop Hash) (*MsgGetHeaders, error) {
+	if len(locator) > MaxLocatorHashes {
+		return nil, fmt.Errorf("too many locator hashes: %d, limit is %d", len(locator), MaxLocatorHashes)
+	}
+	return &MsgGetHeaders{
+		Version:  ProtocolVersion,
+		Locator:  locator,
+		HashStop: hashStop,
+	}, nil
+}
+
+func (getHeaders *MsgGetHeaders) GetCommand() Command {
+	return GetHeadersCommand
+}
+
+func (getHeaders *MsgGetHeaders) Encode(writer io.Writer) error {
+	count := VarInt(len(getHeaders.Locator))
+	steps := []*encodeStep{
+		step("version", &getHeaders.Version),
+		step("hash_count", &count),
+	}
+	for i := range getHeaders.Locator {
+		steps = append(steps, step("block_locator_hashes", &getHeaders.Locator[i]))
+	}
+	steps = append(steps, step("hash_stop", &getHeaders.HashStop))
+
+	err := encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding getheaders fields: %w", err)
+	}
+	return nil
+}
+
+func (getHeaders *MsgGetHeaders) Decode(reader io.Reader) error {
+	err := decode(reader, step("version", &getHeaders.Version))
+	if err != nil {
+		return fmt.Errorf("error decoding getheaders fields: %w", err)
+	}
+	count, err := decodeCount(reader, MaxLocatorHashes, hashSize)
+	if err != nil {
+		return fmt.Errorf("error decoding getheaders hash count: %w", err)
+	}
+	getHeaders.Locator = make([]Hash, count)
+	steps := make([]*encodeStep, 0, count+1)
+	for i := range getHeaders.Locator {
+		steps = append(steps, step("block_locator_hashes", &getHeaders.Locator[i]))
+	}
+	steps = append(steps, step("hash_stop", &getHeaders.HashStop))
+
+	err = decode(reader, steps...)
+	if err != nil {
+		return fmt.Errorf("error decoding getheaders fields: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GetHeaders_Encode(t *testing.T) {
+	getHeaders := noErr(t, func() (*MsgGetHeaders, error) {
+		return NewGetHeadersMsg([]Hash{{0x01}}, Hash{0x02})
+	})
+
+	buf := bytes.NewBuffer(nil)
+	err := getHeaders.Encode(buf)
+	assert.NoError(t, err)
+
+	want := strip(`
+	80 11 01 00 01 01 00 00 00 00 00 00 00 00 00 00
+	00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+	00 00 00 00 00 02 00 00 00 00 00 00 00 00 00 00
+	00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+	00 00 00 00 00`)
+	assert.Equal(t, want, formatBinary(buf.Bytes()))
+}
+
+func Test_GetHeaders_Roundtrip(t *testing.T) {
+	getHeaders := noErr(t, func() (*MsgGetHeaders, error) {
+		return NewGetHeadersMsg([]Hash{{0x01}, {0x02}, {0x03}}, Hash{})
+	})
+
+	buf := bytes.NewBuffer(nil)
+	err := SendMessage(NetworkRegtest, getHeaders, buf)
+	assert.NoError(t, err)
+
+	header, got, err := ReceiveMessage(NetworkRegtest, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, GetHeadersCommand, header.GetCommand())
+	assert.Equal(t, getHeaders, got)
+}
+
+func Test_GetHeaders_Limits(t *testing.T) {
+	_, err := NewGetHeadersMsg(make([]Hash, MaxLocatorHashes+1), Hash{})
+	assert.ErrorContains(t, err, "too many locator hashes: 102")
+
+	input := unformatBinary(`7F 11 01 00 66`)
+	err = (&MsgGetHeaders{}).Decode(bytes.NewBuffer(input))
+	assert.ErrorContains(t, err, "too many entries: 102, limit is 101")
+}
@@ -0,0 +1,65 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// Peers send at most 2000 headers per message. A full message means there are
+// more headers to fetch.
+const MaxHeadersResults = 2000
+
+type MsgHeaders struct {
+	Headers []BlockHeader
+}
+
+func NewHeadersMsg(headers []BlockHeader) (*MsgHeaders, error) {
+	if len(headers) > MaxHeadersResults {
+		return nil, fmt.Errorf("too many headers: %d, limit is %d", len(headers), MaxHeadersResults)
+	}
+	return &MsgHeaders{Headers: headers}, nil
+}
+
+func (headers *MsgHeaders) GetCommand() Command {
+	return HeadersCommand
+}
+
+func (headers *MsgHeaders) Encode(writer io.Writer) error {
+	count := VarInt(len(headers.Headers))
+	// Every header is followed by a transaction count that is always zero.
+	txCount := VarInt(0)
+	steps := []*encodeStep{step("count", &count)}
+	for i := range headers.Headers {
+		steps = append(steps,
+			step("headers", &headers.Headers[i]),
+			step("txn_count", &txCount),
+		)
+	}
+	err := encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding headers fields: %w", err)
+	}
+	return nil
+}
+
+func (headers *MsgHeaders) Decode(reader io.Reader) error {
+	count, err := decodeCount(reader, MaxHeadersResults, BlockHeaderSize+1)
+	if err != nil {
+		return fmt.Errorf("error decoding headers count: %w", err)
+	}
+	headers.Headers = make([]BlockHeader, count)
+	for i := range headers.Headers {
+		txCount := VarInt(0)
+		err = decode(reader,
+			step("headers", &headers.Headers[i]),
+			step("txn_count", &txCount),
+		)
+		if err != nil {
+			return fmt.Errorf("error decoding headers fields: %w", err)
+		}
+		if txCount != 0 {
+			return fmt.Errorf("header %d has non-zero transaction count: %d", i, txCount)
+		}
+	}
+	return nil
+}
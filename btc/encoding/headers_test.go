@@ -0,0 +1,40 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Headers_Roundtrip(t *testing.T) {
+	genesis := &BlockHeader{}
+	assert.NoError(t, genesis.Decode(bytes.NewBuffer(genesisHeaderBytes)))
+	next := BlockHeader{Version: 2, PrevBlock: genesis.Hash(), Timestamp: 1231006506, Bits: 0x1d00ffff}
+
+	headers, err := NewHeadersMsg([]BlockHeader{*genesis, next})
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	err = SendMessage(NetworkMainnet, headers, buf)
+	assert.NoError(t, err)
+
+	header, got, err := ReceiveMessage(NetworkMainnet, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, HeadersCommand, header.GetCommand())
+	assert.Equal(t, UInt32(1+2*81), header.PayloadSize)
+	assert.Equal(t, headers, got)
+}
+
+func Test_Headers_Decode_Errors(t *testing.T) {
+	_, err := NewHeadersMsg(make([]BlockHeader, MaxHeadersResults+1))
+	assert.ErrorContains(t, err, "too many headers: 2001")
+
+	input := append([]byte{0x01}, genesisHeaderBytes...)
+	input = append(input, 0x01)
+	err = (&MsgHeaders{}).Decode(bytes.NewBuffer(input))
+	assert.ErrorContains(t, err, "header 0 has non-zero transaction count: 1")
+
+	err = (&MsgHeaders{}).Decode(bytes.NewBuffer(unformatBinary(`FD D1 07`)))
+	assert.ErrorContains(t, err, "too many entries: 2001, limit is 2000")
+}
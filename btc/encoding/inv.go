@@ -0,0 +1,157 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Peers are not allowed to send more than 50000 inventory entries in a single
+// inv, getdata or notfound message.
+const MaxInvEntries = 50000
+
+// Type and hash of an inventory vector.
+const invVectSize = 4 + hashSize
+
+type InvType UInt32
+
+// Set on tx and block inventory types to request the witness serialization.
+const InvWitnessFlag InvType = 1 << 30
+
+const (
+	InvTypeError                InvType = 0
+	InvTypeTx                   InvType = 1
+	InvTypeBlock                InvType = 2
+	InvTypeFilteredBlock        InvType = 3
+	InvTypeCmpctBlock           InvType = 4
+	InvTypeWTx                  InvType = 5
+	InvTypeWitnessTx                    = InvTypeTx | InvWitnessFlag
+	InvTypeWitnessBlock                 = InvTypeBlock | InvWitnessFlag
+	InvTypeFilteredWitnessBlock         = InvTypeFilteredBlock | InvWitnessFlag
+)
+
+func (invType InvType) String() string {
+	switch invType {
+	case InvTypeError:
+		return "ERROR"
+	case InvTypeTx:
+		return "MSG_TX"
+	case InvTypeBlock:
+		return "MSG_BLOCK"
+	case InvTypeFilteredBlock:
+		return "MSG_FILTERED_BLOCK"
+	case InvTypeCmpctBlock:
+		return "MSG_CMPCT_BLOCK"
+	case InvTypeWTx:
+		return "MSG_WTX"
+	case InvTypeWitnessTx:
+		return "MSG_WITNESS_TX"
+	case InvTypeWitnessBlock:
+		return "MSG_WITNESS_BLOCK"
+	case InvTypeFilteredWitnessBlock:
+		return "MSG_FILTERED_WITNESS_BLOCK"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint32(invType))
+	}
+}
+
+func (invType *InvType) Encode(writer io.Writer) error {
+	ui := UInt32(*invType)
+	return (&ui).Encode(writer)
+}
+
+func (invType *InvType) Decode(reader io.Reader) error {
+	ui := UInt32(0)
+	err := (&ui).Decode(reader)
+	if err != nil {
+		return errors.Wrap(err, "inventory type read error")
+	}
+	*invType = InvType(ui)
+	return nil
+}
+
+type InvVect struct {
+	Type InvType
+	Hash Hash
+}
+
+func (inv *InvVect) Encode(writer io.Writer) error {
+	return encode(writer,
+		step("type", &inv.Type),
+		step("hash", &inv.Hash),
+	)
+}
+
+func (inv *InvVect) Decode(reader io.Reader) error {
+	return decode(reader,
+		step("type", &inv.Type),
+		step("hash", &inv.Hash),
+	)
+}
+
+// InvList is the inventory vector list shared by inv, getdata and notfound.
+type InvList []InvVect
+
+func newInvList(inventory []InvVect) (InvList, error) {
+	if len(inventory) > MaxInvEntries {
+		return nil, fmt.Errorf("too many inventory entries: %d, limit is %d", len(inventory), MaxInvEntries)
+	}
+	return InvList(inventory), nil
+}
+
+func (list *InvList) Encode(writer io.Writer) error {
+	count := VarInt(len(*list))
+	steps := []*encodeStep{step("count", &count)}
+	for i := range *list {
+		steps = append(steps, step("inventory", &(*list)[i]))
+	}
+	return encode(writer, steps...)
+}
+
+func (list *InvList) Decode(reader io.Reader) error {
+	count, err := decodeCount(reader, MaxInvEntries, invVectSize)
+	if err != nil {
+		return errors.Wrap(err, "inventory count read error")
+	}
+	*list = make(InvList, count)
+	for i := range *list {
+		err = (*list)[i].Decode(reader)
+		if err != nil {
+			return errors.Wrap(err, "inventory read error")
+		}
+	}
+	return nil
+}
+
+type MsgInv struct {
+	Inventory InvList
+}
+
+func NewInvMsg(inventory []InvVect) (*MsgInv, error) {
+	list, err := newInvList(inventory)
+	if err != nil {
+		return nil, err
+	}
+	return &MsgInv{Inventory: list}, nil
+}
+
+func (inv *MsgInv) GetCommand() Command {
+	return InvCommand
+}
+
+func (inv *MsgInv) Encode(writer io.Writer) error {
+	err := inv.Inventory.Encode(writer)
+	if err != nil {
+		return fmt.Errorf("error encoding inv fields: %w", err)
+	}
+	return nil
+}
+
+func (inv *MsgInv) Decode(reader io.Reader) error {
+	err := inv.Inventory.Decode(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding inv fields: %w", err)
+	}
+	return nil
+}
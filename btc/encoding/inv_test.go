@@ -0,0 +1,87 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Inv_Encode(t *testing.T) {
+	inv := noErr(t, func() (*MsgInv, error) {
+		return NewInvMsg([]InvVect{
+			{Type: InvTypeWitnessTx, Hash: Hash{0x01}},
+		})
+	})
+
+	buf := bytes.NewBuffer(nil)
+	err := inv.Encode(buf)
+	assert.NoError(t, err)
+
+	want := strip(`
+	01 01 00 00 40 01 00 00 00 00 00 00 00 00 00 00
+	00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+	00 00 00 00 00`)
+	assert.Equal(t, want, formatBinary(buf.Bytes()))
+}
+
+func Test_InvMessages_Roundtrip(t *testing.T) {
+	inventory := []InvVect{
+		{Type: InvTypeTx, Hash: Hash{0x01}},
+		{Type: InvTypeBlock, Hash: Hash{0x02}},
+		{Type: InvTypeWitnessBlock, Hash: Hash{0x03}},
+		{Type: InvTypeWTx, Hash: Hash{0x04}},
+	}
+	tests := []struct {
+		name    string
+		command Command
+		msg     Message
+	}{
+		{
+			name:    "inv",
+			command: InvCommand,
+			msg:     noErr(t, func() (*MsgInv, error) { return NewInvMsg(inventory) }),
+		},
+		{
+			name:    "getdata",
+			command: GetDataCommand,
+			msg:     noErr(t, func() (*MsgGetData, error) { return NewGetDataMsg(inventory) }),
+		},
+		{
+			name:    "notfound",
+			command: NotFoundCommand,
+			msg:     noErr(t, func() (*MsgNotFound, error) { return NewNotFoundMsg(inventory) }),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := SendMessage(NetworkRegtest, tt.msg, buf)
+			assert.NoError(t, err)
+
+			header, got, err := ReceiveMessage(NetworkRegtest, buf)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.command, header.GetCommand())
+			assert.Equal(t, UInt32(1+4*36), header.PayloadSize)
+			assert.Equal(t, tt.msg, got)
+		})
+	}
+}
+
+func Test_Inv_Limits(t *testing.T) {
+	_, err := NewInvMsg(make([]InvVect, MaxInvEntries+1))
+	assert.ErrorContains(t, err, "too many inventory entries: 50001")
+	_, err = NewGetDataMsg(make([]InvVect, MaxInvEntries+1))
+	assert.ErrorContains(t, err, "too many inventory entries: 50001")
+
+	// 50001 entries announced, but the body is never read
+	input := unformatBinary(`FE 51 C3 00 00`)
+	err = (&MsgNotFound{}).Decode(bytes.NewBuffer(input))
+	assert.ErrorContains(t, err, "too many entries: 50001, limit is 50000")
+}
+
+func Test_InvType_String(t *testing.T) {
+	assert.Equal(t, "MSG_WITNESS_BLOCK", InvTypeWitnessBlock.String())
+	assert.Equal(t, "MSG_CMPCT_BLOCK", InvTypeCmpctBlock.String())
+	assert.Equal(t, "unknown(42)", InvType(42).String())
+}
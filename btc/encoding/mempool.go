@@ -0,0 +1,27 @@
+package encoding
+
+import (
+	"io"
+)
+
+// MsgMempool asks the peer to announce the transactions in its mempool with
+// inv messages (BIP35).
+type MsgMempool struct {
+	// mempool has no body and contains just a header
+}
+
+func NewMempoolMsg() (*MsgMempool, error) {
+	return &MsgMempool{}, nil
+}
+
+func (mempool *MsgMempool) GetCommand() Command {
+	return MempoolCommand
+}
+
+func (mempool *MsgMempool) Encode(writer io.Writer) error {
+	return nil
+}
+
+func (mempool *MsgMempool) Decode(reader io.Reader) error {
+	return nil
+}
@@ -0,0 +1,65 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgMerkleBlock answers a filtered block request with the block header and
+// a partial merkle tree proving which transactions matched the bloom filter
+// (BIP37). The matched transactions follow as tx messages.
+type MsgMerkleBlock struct {
+	Header            BlockHeader
+	TotalTransactions UInt32
+	Hashes            []Hash
+	// Bits of the depth-first tree traversal, least significant bit first.
+	Flags VarBytes
+}
+
+func (merkleBlock *MsgMerkleBlock) GetCommand() Command {
+	return MerkleBlockCommand
+}
+
+func (merkleBlock *MsgMerkleBlock) Encode(writer io.Writer) error {
+	count := VarInt(len(merkleBlock.Hashes))
+	steps := []*encodeStep{
+		step("block_header", &merkleBlock.Header),
+		step("transaction_count", &merkleBlock.TotalTransactions),
+		step("hash_count", &count),
+	}
+	for i := range merkleBlock.Hashes {
+		steps = append(steps, step("hash", &merkleBlock.Hashes[i]))
+	}
+	steps = append(steps, step("flags", &merkleBlock.Flags))
+	err := encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding merkleblock fields: %w", err)
+	}
+	return nil
+}
+
+func (merkleBlock *MsgMerkleBlock) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("block_header", &merkleBlock.Header),
+		step("transaction_count", &merkleBlock.TotalTransactions),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding merkleblock fields: %w", err)
+	}
+	count, err := decodeCount(reader, maxBlockTxs, hashSize)
+	if err != nil {
+		return fmt.Errorf("error decoding merkleblock hash_count: %w", err)
+	}
+	merkleBlock.Hashes = make([]Hash, count)
+	for i := range merkleBlock.Hashes {
+		err = (&merkleBlock.Hashes[i]).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding merkleblock hash %d: %w", i, err)
+		}
+	}
+	err = decode(reader, step("flags", &merkleBlock.Flags))
+	if err != nil {
+		return fmt.Errorf("error decoding merkleblock fields: %w", err)
+	}
+	return nil
+}
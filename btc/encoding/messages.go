@@ -2,38 +2,102 @@ package encoding
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"fmt"
 	"io"
+
+	"github.com/pkg/errors"
 )
 
 type Header struct {
-	Magic       [4]byte // MainNet: [4]byte{0xF9, 0xBE, 0xB4, 0xD9}, Regtest: [4]byte{0xFA, 0xBF, 0xB5, 0xDA}
+	Magic       [4]byte // See Network.Magic
 	Command     [12]byte
 	PayloadSize UInt32
 	Checksum    [4]byte
 }
 
-type Network uint
-
-const (
-	NetworkMainnet Network = iota
-	NetworkTestnet3
-	NetworkRegtest
-)
-
 type Command string
 
 const (
 	VersionCommand Command = "version"
 	VerackCommand  Command = "verack"
+	PingCommand    Command = "ping"
+	PongCommand    Command = "pong"
+	RejectCommand  Command = "reject"
+
+	GetAddrCommand    Command = "getaddr"
+	AddrCommand       Command = "addr"
+	SendAddrV2Command Command = "sendaddrv2"
+	AddrV2Command     Command = "addrv2"
+
+	InvCommand      Command = "inv"
+	GetDataCommand  Command = "getdata"
+	NotFoundCommand Command = "notfound"
+
+	GetHeadersCommand Command = "getheaders"
+	HeadersCommand    Command = "headers"
+
+	TxCommand    Command = "tx"
+	BlockCommand Command = "block"
+
+	SendHeadersCommand Command = "sendheaders"
+	FeeFilterCommand   Command = "feefilter"
+	WTxIDRelayCommand  Command = "wtxidrelay"
+	SendCmpctCommand   Command = "sendcmpct"
+
+	CmpctBlockCommand  Command = "cmpctblock"
+	GetBlockTxnCommand Command = "getblocktxn"
+	BlockTxnCommand    Command = "blocktxn"
+
+	GetCFiltersCommand  Command = "getcfilters"
+	CFilterCommand      Command = "cfilter"
+	GetCFHeadersCommand Command = "getcfheaders"
+	CFHeadersCommand    Command = "cfheaders"
+	GetCFCheckptCommand Command = "getcfcheckpt"
+	CFCheckptCommand    Command = "cfcheckpt"
+
+	FilterLoadCommand  Command = "filterload"
+	FilterAddCommand   Command = "filteradd"
+	FilterClearCommand Command = "filterclear"
+	MerkleBlockCommand Command = "merkleblock"
+
+	MempoolCommand Command = "mempool"
 )
 
 const (
-	ProtocolVersion = 70015
-	UserAgent       = "/MemeClient:0.0.1/"
+	ProtocolVersion = 70016
+	UserAgent       = "/" + ClientName + ":" + ClientVersion + "/"
+
+	// Same limit as Bitcoin Core's MAX_SIZE.
+	DefaultMaxPayloadSize = 32 * 1024 * 1024
+)
+
+var (
+	ErrBadChecksum      = errors.New("bad checksum")
+	ErrWrongMagic       = errors.New("wrong network magic")
+	ErrOversizedPayload = errors.New("oversized payload")
+	ErrMalformedPayload = errors.New("malformed payload")
+	// The message ended before the payload did.
+	ErrPayloadUnderRead = errors.New("payload has trailing bytes")
+	// The message needs more bytes than the payload has.
+	ErrPayloadOverRead = errors.New("payload too short for message")
 )
 
+// PayloadError is returned for a frame that was read in full but whose
+// payload is bad. The payload is kept for logging and re-verification.
+type PayloadError struct {
+	Header  *Header
+	Payload []byte
+	Err     error
+}
+
+func (e *PayloadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
 type Message interface {
 	Encodable
 
@@ -41,16 +105,9 @@ type Message interface {
 }
 
 func NewHeader(network Network, command Command, payload []byte) (*Header, error) {
-	var magic [4]byte
-	switch network {
-	case NetworkMainnet:
-		magic = [4]byte{0xF9, 0xBE, 0xB4, 0xD9}
-	case NetworkTestnet3:
-		magic = [4]byte{0x0B, 0x11, 0x09, 0x07}
-	case NetworkRegtest:
-		magic = [4]byte{0xFA, 0xBF, 0xB5, 0xDA}
-	default:
-		return nil, fmt.Errorf("unknown network: %d", network)
+	magic, err := network.Magic()
+	if err != nil {
+		return nil, err
 	}
 
 	commandBytes := [12]byte{}
@@ -111,39 +168,108 @@ func SendMessage(network Network, message Message, writer io.Writer) error {
 	return nil
 }
 
-func createMessage(header *Header) (Message, error) {
-	switch header.GetCommand() {
-	case VersionCommand:
-		return &MsgVersion{}, nil
-	case VerackCommand:
-		return &MsgVerack{}, nil
-	default:
-		return NewRawMsg(header)
+// Receiver reads messages from the network and validates their headers
+// before decoding the payload.
+type Receiver struct {
+	Network        Network
+	MaxPayloadSize uint32
+	// Picks the message type for each command. DefaultRegistry when nil.
+	Registry *Registry
+	// The protocol version negotiated with the peer, for version specific
+	// message types. Zero until it is known.
+	ProtocolVersion uint32
+}
+
+func NewReceiver(network Network) *Receiver {
+	return &Receiver{
+		Network:        network,
+		MaxPayloadSize: DefaultMaxPayloadSize,
+		Registry:       DefaultRegistry,
 	}
 }
 
-func ReceiveMessage(reader io.Reader) (*Header, Message, error) {
+// Receives a single message using the default receiver settings for the network.
+func ReceiveMessage(network Network, reader io.Reader) (*Header, Message, error) {
+	return NewReceiver(network).Receive(reader)
+}
+
+// Receive reads the next message. The header is returned together with the
+// error if the frame was read in full, but the payload failed validation, so
+// callers can tell which command the peer sent.
+func (r *Receiver) Receive(reader io.Reader) (*Header, Message, error) {
 	header := &Header{}
 	err := header.Decode(reader)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error decoding header: %w", err)
 	}
+	err = r.validateHeader(header)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	msg, err := createMessage(header)
+	payload := make([]byte, header.PayloadSize)
+	_, err = io.ReadFull(reader, payload)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating message: %w", err)
+		return nil, nil, fmt.Errorf("error reading payload: %w", err)
 	}
-	err = msg.Decode(reader)
+	if checksum := calculateChecksum(payload); checksum != header.Checksum {
+		err = fmt.Errorf("%w: %s header checksum %x, payload checksum %x",
+			ErrBadChecksum, header.GetCommand(), header.Checksum, checksum)
+		return header, nil, &PayloadError{Header: header, Payload: payload, Err: err}
+	}
+
+	msg, err := r.decodePayload(header, payload)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error decoding message: %w", err)
+		return header, nil, &PayloadError{Header: header, Payload: payload, Err: err}
 	}
 	return header, msg, nil
 }
 
+// Decodes the message from the payload alone, so a message that is shorter or
+// longer than its frame can't desync the stream. Both are reported as
+// malformed payloads.
+func (r *Receiver) decodePayload(header *Header, payload []byte) (Message, error) {
+	registry := r.Registry
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	msg, err := registry.Create(header, r.Network, r.ProtocolVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error creating message: %w", err)
+	}
+	reader := bytes.NewReader(payload)
+	err = msg.Decode(reader)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("%w: %w: error decoding %s message: %w", ErrMalformedPayload, ErrPayloadOverRead, header.GetCommand(), err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: error decoding %s message: %w", ErrMalformedPayload, header.GetCommand(), err)
+	}
+	if reader.Len() > 0 {
+		return nil, fmt.Errorf("%w: %w: %s message used %d of %d bytes",
+			ErrMalformedPayload, ErrPayloadUnderRead, header.GetCommand(), len(payload)-reader.Len(), len(payload))
+	}
+	return msg, nil
+}
+
+func (r *Receiver) validateHeader(header *Header) error {
+	magic, err := r.Network.Magic()
+	if err != nil {
+		return err
+	}
+	if header.Magic != magic {
+		return fmt.Errorf("%w: got %x, expected %x", ErrWrongMagic, header.Magic, magic)
+	}
+	if uint32(header.PayloadSize) > r.MaxPayloadSize {
+		return fmt.Errorf("%w: %s payload is %d bytes, limit is %d",
+			ErrOversizedPayload, header.GetCommand(), header.PayloadSize, r.MaxPayloadSize)
+	}
+	return nil
+}
+
 func calculateChecksum(payload []byte) [4]byte {
-	firstSHA := sha256.Sum256(payload)
-	secondSHA := sha256.Sum256(firstSHA[:])
+	hash := DoubleSHA256(payload)
 	var checksum [4]byte
-	copy(checksum[:], secondSHA[:4])
+	copy(checksum[:], hash[:4])
 	return checksum
 }
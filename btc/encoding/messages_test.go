@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_Header_Encode(t *testing.T) {
@@ -53,6 +54,26 @@ func Test_Header_Encode(t *testing.T) {
 			0A 00 00 00 6E D5 BA D9`,
 			),
 		},
+		{
+			name: "signet",
+			header: noErr(t, func() (*Header, error) {
+				return NewHeader(NetworkSignet, VersionCommand, payload)
+			}),
+			want: strip(`
+			0A 03 CF 40 76 65 72 73 69 6F 6E 00 00 00 00 00
+			0A 00 00 00 6E D5 BA D9`,
+			),
+		},
+		{
+			name: "testnet4",
+			header: noErr(t, func() (*Header, error) {
+				return NewHeader(NetworkTestnet4, VersionCommand, payload)
+			}),
+			want: strip(`
+			1C 16 3F 28 76 65 72 73 69 6F 6E 00 00 00 00 00
+			0A 00 00 00 6E D5 BA D9`,
+			),
+		},
 	}
 
 	for _, tt := range tests {
@@ -121,6 +142,157 @@ func Test_Header_Decode(t *testing.T) {
 	}
 }
 
+func Test_Receiver_Validation(t *testing.T) {
+	ping := func() []byte {
+		buf := bytes.NewBuffer(nil)
+		err := SendMessage(NetworkRegtest, &MsgPing{Nonce: 42}, buf)
+		assert.NoError(t, err)
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name           string
+		input          []byte
+		maxPayloadSize uint32
+		wantErr        error
+		wantHeader     bool
+	}{
+		{
+			name:       "valid",
+			input:      ping(),
+			wantHeader: true,
+		},
+		{
+			name: "wrong magic",
+			input: func() []byte {
+				b := ping()
+				copy(b, []byte{0xF9, 0xBE, 0xB4, 0xD9})
+				return b
+			}(),
+			wantErr: ErrWrongMagic,
+		},
+		{
+			name: "bad checksum",
+			input: func() []byte {
+				b := ping()
+				b[len(b)-1]++
+				return b
+			}(),
+			wantErr:    ErrBadChecksum,
+			wantHeader: true,
+		},
+		{
+			name:           "oversized payload",
+			input:          ping(),
+			maxPayloadSize: 7,
+			wantErr:        ErrOversizedPayload,
+		},
+		{
+			name: "payload size over default limit",
+			input: func() []byte {
+				b := ping()
+				le.PutUint32(b[16:20], DefaultMaxPayloadSize+1)
+				return b
+			}(),
+			wantErr: ErrOversizedPayload,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := NewReceiver(NetworkRegtest)
+			if tt.maxPayloadSize > 0 {
+				receiver.MaxPayloadSize = tt.maxPayloadSize
+			}
+
+			header, msg, err := receiver.Receive(bytes.NewBuffer(tt.input))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, msg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, &MsgPing{Nonce: 42}, msg)
+			}
+			if tt.wantHeader {
+				assert.Equal(t, PingCommand, header.GetCommand())
+			} else {
+				assert.Nil(t, header)
+			}
+		})
+	}
+}
+
+// A ping frame with the given payload and a matching checksum.
+func pingFrame(payload []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	magic, _ := NetworkRegtest.Magic()
+	header := &Header{Magic: magic, PayloadSize: UInt32(len(payload)), Checksum: calculateChecksum(payload)}
+	copy(header.Command[:], PingCommand)
+	_ = header.Encode(buf)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func Test_Receiver_PayloadBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		wantErr error
+	}{
+		{name: "under-read", payload: []byte{42, 0, 0, 0, 0, 0, 0, 0, 0xFF}, wantErr: ErrPayloadUnderRead},
+		{name: "over-read", payload: []byte{42, 0, 0, 0}, wantErr: ErrPayloadOverRead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := bytes.NewBuffer(pingFrame(tt.payload))
+			assert.NoError(t, SendMessage(NetworkRegtest, &MsgPing{Nonce: 7}, stream))
+
+			header, msg, err := ReceiveMessage(NetworkRegtest, stream)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.ErrorIs(t, err, ErrMalformedPayload)
+			assert.Nil(t, msg)
+			assert.Equal(t, PingCommand, header.GetCommand())
+
+			var payloadErr *PayloadError
+			require.ErrorAs(t, err, &payloadErr)
+			assert.Equal(t, tt.payload, payloadErr.Payload)
+
+			// The next frame is still in sync.
+			_, msg, err = ReceiveMessage(NetworkRegtest, stream)
+			assert.NoError(t, err)
+			assert.Equal(t, &MsgPing{Nonce: 7}, msg)
+		})
+	}
+}
+
+func Test_Receiver_LengthsBoundedByPayload(t *testing.T) {
+	hugeVarInt := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}
+	txIn := append([]byte{1, 0, 0, 0, 1}, make([]byte, 36)...)
+	tests := []struct {
+		name    string
+		command Command
+		payload []byte
+		wantErr error
+	}{
+		{name: "huge var_str", command: RejectCommand, payload: hugeVarInt, wantErr: ErrMalformedPayload},
+		{name: "var_str", command: RejectCommand, payload: []byte{2, 't', 'x', 0x10, 0x6F, 'x'}, wantErr: ErrPayloadOverRead},
+		{name: "huge var_bytes", command: TxCommand, payload: append(txIn, hugeVarInt...), wantErr: ErrMalformedPayload},
+		{name: "var_bytes", command: TxCommand, payload: append(txIn, 0xFD, 0xFF, 0xFF), wantErr: ErrPayloadOverRead},
+		{name: "count", command: InvCommand, payload: []byte{0xFD, 0x50, 0xC3, 0, 0, 0, 0}, wantErr: ErrPayloadOverRead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := frame(t, NetworkRegtest, tt.command, tt.payload)
+
+			header, msg, err := ReceiveMessage(NetworkRegtest, stream)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.ErrorIs(t, err, ErrMalformedPayload)
+			assert.Nil(t, msg)
+			assert.Equal(t, tt.command, header.GetCommand())
+		})
+	}
+}
+
 func noErr[T any](t *testing.T, f func() (T, error)) T {
 	t.Helper()
 
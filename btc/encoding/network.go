@@ -0,0 +1,67 @@
+package encoding
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Network uint
+
+const (
+	NetworkMainnet Network = iota
+	NetworkTestnet3
+	NetworkRegtest
+	NetworkSignet
+	NetworkTestnet4
+)
+
+type networkParams struct {
+	name  string
+	magic [4]byte
+	port  uint16
+}
+
+var networks = map[Network]networkParams{
+	NetworkMainnet:  {name: "mainnet", magic: [4]byte{0xF9, 0xBE, 0xB4, 0xD9}, port: 8333},
+	NetworkTestnet3: {name: "testnet3", magic: [4]byte{0x0B, 0x11, 0x09, 0x07}, port: 18333},
+	NetworkRegtest:  {name: "regtest", magic: [4]byte{0xFA, 0xBF, 0xB5, 0xDA}, port: 18444},
+	// Magic of the default signet. Custom signets derive theirs from the challenge script.
+	NetworkSignet:   {name: "signet", magic: [4]byte{0x0A, 0x03, 0xCF, 0x40}, port: 38333},
+	NetworkTestnet4: {name: "testnet4", magic: [4]byte{0x1C, 0x16, 0x3F, 0x28}, port: 48333},
+}
+
+func ParseNetwork(name string) (Network, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for network, params := range networks {
+		if params.name == name {
+			return network, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown network: %q", name)
+}
+
+func (network Network) String() string {
+	params, ok := networks[network]
+	if !ok {
+		return fmt.Sprintf("unknown(%d)", uint(network))
+	}
+	return params.name
+}
+
+func (network Network) Magic() ([4]byte, error) {
+	params, ok := networks[network]
+	if !ok {
+		return [4]byte{}, fmt.Errorf("unknown network: %d", network)
+	}
+	return params.magic, nil
+}
+
+// DefaultPort returns the port nodes on the network listen on unless
+// configured otherwise.
+func (network Network) DefaultPort() (uint16, error) {
+	params, ok := networks[network]
+	if !ok {
+		return 0, fmt.Errorf("unknown network: %d", network)
+	}
+	return params.port, nil
+}
@@ -0,0 +1,50 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseNetwork(t *testing.T) {
+	tests := []struct {
+		name     string
+		want     Network
+		wantPort uint16
+		wantErr  string
+	}{
+		{name: "mainnet", want: NetworkMainnet, wantPort: 8333},
+		{name: "testnet3", want: NetworkTestnet3, wantPort: 18333},
+		{name: "testnet4", want: NetworkTestnet4, wantPort: 48333},
+		{name: "signet", want: NetworkSignet, wantPort: 38333},
+		{name: " Regtest ", want: NetworkRegtest, wantPort: 18444},
+		{name: "litecoin", wantErr: `unknown network: "litecoin"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNetwork(tt.name)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			port, err := got.DefaultPort()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantPort, port)
+		})
+	}
+}
+
+func Test_Network_Unknown(t *testing.T) {
+	network := Network(42)
+	assert.Equal(t, "unknown(42)", network.String())
+
+	_, err := network.Magic()
+	assert.EqualError(t, err, "unknown network: 42")
+	_, err = network.DefaultPort()
+	assert.EqualError(t, err, "unknown network: 42")
+	_, err = NewHeader(network, VersionCommand, nil)
+	assert.EqualError(t, err, "unknown network: 42")
+}
@@ -0,0 +1,38 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+type MsgNotFound struct {
+	Inventory InvList
+}
+
+func NewNotFoundMsg(inventory []InvVect) (*MsgNotFound, error) {
+	list, err := newInvList(inventory)
+	if err != nil {
+		return nil, err
+	}
+	return &MsgNotFound{Inventory: list}, nil
+}
+
+func (notFound *MsgNotFound) GetCommand() Command {
+	return NotFoundCommand
+}
+
+func (notFound *MsgNotFound) Encode(writer io.Writer) error {
+	err := notFound.Inventory.Encode(writer)
+	if err != nil {
+		return fmt.Errorf("error encoding notfound fields: %w", err)
+	}
+	return nil
+}
+
+func (notFound *MsgNotFound) Decode(reader io.Reader) error {
+	err := notFound.Inventory.Decode(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding notfound fields: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+type MsgPing struct {
+	Nonce UInt64
+}
+
+func NewPingMsg(nonce uint64) (*MsgPing, error) {
+	return &MsgPing{Nonce: UInt64(nonce)}, nil
+}
+
+func (ping *MsgPing) GetCommand() Command {
+	return PingCommand
+}
+
+func (ping *MsgPing) Encode(writer io.Writer) error {
+	err := encode(writer, step("nonce", &ping.Nonce))
+	if err != nil {
+		return fmt.Errorf("error encoding ping fields: %w", err)
+	}
+	return nil
+}
+
+func (ping *MsgPing) Decode(reader io.Reader) error {
+	err := decode(reader, step("nonce", &ping.Nonce))
+	if err != nil {
+		return fmt.Errorf("error decoding ping fields: %w", err)
+	}
+	return nil
+}
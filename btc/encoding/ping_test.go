@@ -0,0 +1,36 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Ping_Send(t *testing.T) {
+	ping, err := NewPingMsg(0x6517E68C5DB32E3B)
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	err = SendMessage(NetworkRegtest, ping, buf)
+	assert.NoError(t, err)
+
+	want := strip(`
+	FA BF B5 DA 70 69 6E 67 00 00 00 00 00 00 00 00
+	08 00 00 00 4B 86 68 8E 3B 2E B3 5D 8C E6 17 65`)
+	assert.Equal(t, want, formatBinary(buf.Bytes()))
+}
+
+func Test_Ping_Roundtrip(t *testing.T) {
+	ping, err := NewPingMsg(0x6517E68C5DB32E3B)
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	err = SendMessage(NetworkMainnet, ping, buf)
+	assert.NoError(t, err)
+	header, got, err := ReceiveMessage(NetworkMainnet, buf)
+	assert.NoError(t, err)
+
+	assert.Equal(t, PingCommand, header.GetCommand())
+	assert.Equal(t, ping, got)
+}
@@ -0,0 +1,34 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+type MsgPong struct {
+	Nonce UInt64
+}
+
+func NewPongMsg(nonce uint64) (*MsgPong, error) {
+	return &MsgPong{Nonce: UInt64(nonce)}, nil
+}
+
+func (pong *MsgPong) GetCommand() Command {
+	return PongCommand
+}
+
+func (pong *MsgPong) Encode(writer io.Writer) error {
+	err := encode(writer, step("nonce", &pong.Nonce))
+	if err != nil {
+		return fmt.Errorf("error encoding pong fields: %w", err)
+	}
+	return nil
+}
+
+func (pong *MsgPong) Decode(reader io.Reader) error {
+	err := decode(reader, step("nonce", &pong.Nonce))
+	if err != nil {
+		return fmt.Errorf("error decoding pong fields: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Pong_Roundtrip(t *testing.T) {
+	pong, err := NewPongMsg(0x6517E68C5DB32E3B)
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	err = SendMessage(NetworkMainnet, pong, buf)
+	assert.NoError(t, err)
+	header, got, err := ReceiveMessage(NetworkMainnet, buf)
+	assert.NoError(t, err)
+
+	assert.Equal(t, PongCommand, header.GetCommand())
+	assert.Equal(t, pong, got)
+}
@@ -1,10 +1,13 @@
 package encoding
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 
 	"github.com/pkg/errors"
 )
@@ -148,6 +151,56 @@ func (b RawBytes) Decode(reader io.Reader) error {
 	return errors.Wrap(err, "raw bytes read error")
 }
 
+const hashSize = 32
+
+// Hash is a 32 byte hash (usually double SHA-256) in the byte order used on
+// the wire.
+type Hash [hashSize]byte
+
+func (h *Hash) Encode(writer io.Writer) error {
+	return errors.Wrap(RawBytes(h[:]).Encode(writer), "hash write error")
+}
+
+func (h *Hash) Decode(reader io.Reader) error {
+	return errors.Wrap(RawBytes(h[:]).Decode(reader), "hash read error")
+}
+
+// NewHashFromString parses a hash in the reversed hex format produced by
+// Hash.String.
+func NewHashFromString(s string) (Hash, error) {
+	hash := Hash{}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return hash, fmt.Errorf("invalid hash %q: %w", s, err)
+	}
+	if len(b) != len(hash) {
+		return hash, fmt.Errorf("invalid hash %q: expected %d bytes, got %d", s, len(hash), len(b))
+	}
+	copy(hash[:], b)
+	return hash.reverse(), nil
+}
+
+// DoubleSHA256 hashes the data twice with SHA-256, the way block and
+// transaction hashes and message checksums are computed.
+func DoubleSHA256(data []byte) Hash {
+	first := sha256.Sum256(data)
+	return sha256.Sum256(first[:])
+}
+
+// String returns the hash hex encoded in reverse byte order, the way
+// Bitcoin Core and block explorers display it.
+func (h Hash) String() string {
+	reversed := h.reverse()
+	return hex.EncodeToString(reversed[:])
+}
+
+func (h Hash) reverse() Hash {
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	return h
+}
+
 type UInt8 uint8
 
 func (ui *UInt8) Encode(writer io.Writer) error {
@@ -265,13 +318,15 @@ func (vs *VarStr) Encode(writer io.Writer) error {
 }
 
 func (vs *VarStr) Decode(reader io.Reader) error {
-	s := string(*vs)
-	vi := VarInt(len(s))
-	err := (&vi).Decode(reader)
+	return vs.decode(reader, DefaultMaxPayloadSize)
+}
+
+func (vs *VarStr) decode(reader io.Reader, limit uint64) error {
+	length, err := decodeLength(reader, limit)
 	if err != nil {
 		return errors.Wrap(err, "var_str length read error")
 	}
-	buf := make([]byte, uint64(vi))
+	buf := make([]byte, length)
 	err = RawBytes(buf).Decode(reader)
 	if err != nil {
 		return errors.Wrap(err, "var_str contents read error")
@@ -280,38 +335,87 @@ func (vs *VarStr) Decode(reader io.Reader) error {
 	return nil
 }
 
+// limitedVarStr decodes a VarStr field that has a protocol length limit, like
+// the user agent, and rejects longer strings before allocating them.
+type limitedVarStr struct {
+	str   *VarStr
+	limit uint64
+}
+
+func (ls limitedVarStr) Encode(writer io.Writer) error {
+	return ls.str.Encode(writer)
+}
+
+func (ls limitedVarStr) Decode(reader io.Reader) error {
+	return ls.str.decode(reader, ls.limit)
+}
+
+// VarBytes is a byte array prefixed with its varint length, used for scripts
+// and witness items. The length can't exceed what is left of the payload.
+type VarBytes []byte
+
+func (vb *VarBytes) Encode(writer io.Writer) error {
+	vi := VarInt(len(*vb))
+	return encode(
+		writer,
+		step("var_bytes_length", &vi),
+		step("var_bytes_data", RawBytes(*vb)),
+	)
+}
+
+func (vb *VarBytes) Decode(reader io.Reader) error {
+	length, err := decodeLength(reader, DefaultMaxPayloadSize)
+	if err != nil {
+		return errors.Wrap(err, "var_bytes length read error")
+	}
+	buf := make([]byte, length)
+	err = RawBytes(buf).Decode(reader)
+	if err != nil {
+		return errors.Wrap(err, "var_bytes contents read error")
+	}
+	*vb = buf
+	return nil
+}
+
 type NetworkAddress struct {
-	Time     UInt32
 	Services UInt64
 	IP       IP
 	Port     PortNumber
 }
 
 func NewIP4Address(services Services, addr string) (*NetworkAddress, error) {
-	resolved, err := net.ResolveTCPAddr("tcp4", addr)
+	return newNetworkAddress("tcp4", services, addr)
+}
+
+// NewNetworkAddress resolves both IPv4 and IPv6 addresses. IPv4 addresses are
+// stored in their IPv6-mapped form.
+func NewNetworkAddress(services Services, addr string) (*NetworkAddress, error) {
+	return newNetworkAddress("tcp", services, addr)
+}
+
+func newNetworkAddress(network string, services Services, addr string) (*NetworkAddress, error) {
+	resolved, err := net.ResolveTCPAddr(network, addr)
 	if err != nil {
 		return nil, fmt.Errorf("invalid address %s: %w", addr, err)
 	}
 	return &NetworkAddress{
-		Time:     UInt32(0),
 		Services: UInt64(services),
 		IP:       IP(resolved.IP),
 		Port:     PortNumber(resolved.Port),
 	}, nil
 }
 
+// String returns the address in host:port form.
+func (addr *NetworkAddress) String() string {
+	return net.JoinHostPort(net.IP(addr.IP).String(), strconv.Itoa(int(addr.Port)))
+}
+
 func (addr *NetworkAddress) Encode(writer io.Writer) error {
-	steps := []*encodeStep{
-		step("time", &addr.Time),
+	return encode(writer,
 		step("services", &addr.Services),
 		step("ip", &addr.IP),
 		step("port", &addr.Port),
-	}
-	// Address timestamp is not used and not sent in version messages
-	if addr.Time > 0 {
-		return encode(writer, steps...)
-	}
-	return encode(writer, steps[1:]...)
+	)
 }
 
 func (addr *NetworkAddress) Decode(reader io.Reader) error {
@@ -321,3 +425,73 @@ func (addr *NetworkAddress) Decode(reader io.Reader) error {
 		step("port", &addr.Port),
 	)
 }
+
+// TimedNetworkAddress is the network address format used in addr messages.
+// Version messages use the plain NetworkAddress without the timestamp.
+type TimedNetworkAddress struct {
+	Time UInt32
+	NetworkAddress
+}
+
+func (addr *TimedNetworkAddress) Encode(writer io.Writer) error {
+	return encode(writer,
+		step("time", &addr.Time),
+		step("address", &addr.NetworkAddress),
+	)
+}
+
+func (addr *TimedNetworkAddress) Decode(reader io.Reader) error {
+	return decode(reader,
+		step("time", &addr.Time),
+		step("address", &addr.NetworkAddress),
+	)
+}
+
+// Reads a list element count and makes sure it doesn't go over the limit, so
+// we don't allocate huge lists because of a malicious count. Every element
+// takes at least minSize bytes, so the count also has to fit in what is left
+// of the payload.
+func decodeCount(reader io.Reader, limit uint64, minSize uint64) (int, error) {
+	count := VarInt(0)
+	err := (&count).Decode(reader)
+	if err != nil {
+		return 0, errors.Wrap(err, "count read error")
+	}
+	if uint64(count) > limit {
+		return 0, fmt.Errorf("too many entries: %d, limit is %d", count, limit)
+	}
+	return int(count), checkRemaining(reader, uint64(count), minSize)
+}
+
+// Reads the length of a byte string, which can't be longer than the limit or
+// what is left of the payload.
+func decodeLength(reader io.Reader, limit uint64) (int, error) {
+	length := VarInt(0)
+	err := (&length).Decode(reader)
+	if err != nil {
+		return 0, errors.Wrap(err, "length read error")
+	}
+	if uint64(length) > limit {
+		return 0, fmt.Errorf("too long: %d bytes, limit is %d", length, limit)
+	}
+	return int(length), checkRemaining(reader, uint64(length), 1)
+}
+
+func checkRemaining(reader io.Reader, count uint64, minSize uint64) error {
+	remaining, ok := remainingBytes(reader)
+	if ok && count > remaining/minSize {
+		return fmt.Errorf("%w: need at least %d bytes, %d left",
+			io.ErrUnexpectedEOF, count*minSize, remaining)
+	}
+	return nil
+}
+
+// The payload is decoded from a bytes.Reader, which knows how much is left.
+// Other readers are only bounded by the limits of each field.
+func remainingBytes(reader io.Reader) (uint64, bool) {
+	lenReader, ok := reader.(interface{ Len() int })
+	if !ok {
+		return 0, false
+	}
+	return uint64(lenReader.Len()), true
+}
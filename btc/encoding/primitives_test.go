@@ -78,7 +78,6 @@ func Test_VarStr_Encode(t *testing.T) {
 }
 
 func Test_NetworkAddress_Encode(t *testing.T) {
-	testTime := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
 	tests := []struct {
 		name string
 		addr *NetworkAddress
@@ -94,18 +93,13 @@ func Test_NetworkAddress_Encode(t *testing.T) {
 			00 00 FF FF 0A 00 00 01 20 8D`),
 		},
 		{
-			name: "IPv4 with time",
+			name: "IPv6",
 			addr: noErr(t, func() (*NetworkAddress, error) {
-				a, err := NewIP4Address(1, "10.0.0.1:8333")
-				if err != nil {
-					return nil, err
-				}
-				a.Time = UInt32(testTime.Unix())
-				return a, nil
+				return NewNetworkAddress(1, "[2001:db8::1]:8333")
 			}),
 			want: strip(`
-			00 F9 09 66 01 00 00 00 00 00 00 00 00 00 00 00
-			00 00 00 00 00 00 FF FF 0A 00 00 01 20 8D`),
+			01 00 00 00 00 00 00 00 20 01 0D B8 00 00 00 00
+			00 00 00 00 00 00 00 01 20 8D`),
 		},
 	}
 	for _, tt := range tests {
@@ -120,6 +114,29 @@ func Test_NetworkAddress_Encode(t *testing.T) {
 	}
 }
 
+func Test_TimedNetworkAddress_Roundtrip(t *testing.T) {
+	testTime := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	addr := &TimedNetworkAddress{
+		Time: UInt32(testTime.Unix()),
+		NetworkAddress: *noErr(t, func() (*NetworkAddress, error) {
+			return NewIP4Address(1, "10.0.0.1:8333")
+		}),
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := addr.Encode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, strip(`
+	00 F9 09 66 01 00 00 00 00 00 00 00 00 00 00 00
+	00 00 00 00 00 00 FF FF 0A 00 00 01 20 8D`), formatBinary(buf.Bytes()))
+
+	got := &TimedNetworkAddress{}
+	err = got.Decode(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, addr.Time, got.Time)
+	assert.Equal(t, "10.0.0.1:8333", got.String())
+}
+
 func Test_NetworkAddress_Decode(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -143,10 +160,15 @@ func Test_NetworkAddress_Decode(t *testing.T) {
 			err := got.Decode(buf)
 
 			assert.NoError(t, err)
-			assert.Equal(t, tt.want.Time, got.Time)
 			assert.Equal(t, tt.want.Services, got.Services)
 			assert.Equal(t, tt.want.IP, got.IP)
 			assert.Equal(t, tt.want.Port, got.Port)
 		})
 	}
 }
+
+func Test_Hash_String(t *testing.T) {
+	hash := Hash{0x6F, 0xE2, 0x8C, 0x0A}
+	want := strings.Repeat("0", 56) + "0a8ce26f"
+	assert.Equal(t, want, hash.String())
+}
@@ -0,0 +1,196 @@
+package encoding
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidCommand = errors.New("invalid command")
+
+// MessageFactory creates an empty message for a payload to be decoded into.
+type MessageFactory func() Message
+
+type versionFactory struct {
+	minVersion uint32
+	factory    MessageFactory
+}
+
+// Registry maps commands to the message types their payloads are decoded
+// into. Applications can add their own messages, including experimental
+// commands, or replace the standard ones for a network or from a protocol
+// version on. Overriding the handshake messages breaks the client, which
+// relies on their types. Commands without a message are read as MsgRaw.
+type Registry struct {
+	mu       sync.RWMutex
+	messages map[Command]MessageFactory
+	networks map[Network]map[Command]MessageFactory
+	// Sorted by descending minimum version.
+	versions map[Command][]versionFactory
+}
+
+// DefaultRegistry knows the standard messages. It is used by ReceiveMessage
+// and by new receivers.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns a registry with the standard messages.
+func NewRegistry() *Registry {
+	r := NewEmptyRegistry()
+	for command, factory := range standardMessages() {
+		r.messages[command] = factory
+	}
+	return r
+}
+
+// NewEmptyRegistry returns a registry without any messages, every payload is
+// read as MsgRaw.
+func NewEmptyRegistry() *Registry {
+	return &Registry{
+		messages: map[Command]MessageFactory{},
+		networks: map[Network]map[Command]MessageFactory{},
+		versions: map[Command][]versionFactory{},
+	}
+}
+
+func standardMessages() map[Command]MessageFactory {
+	return map[Command]MessageFactory{
+		VersionCommand:      func() Message { return &MsgVersion{} },
+		VerackCommand:       func() Message { return &MsgVerack{} },
+		PingCommand:         func() Message { return &MsgPing{} },
+		PongCommand:         func() Message { return &MsgPong{} },
+		RejectCommand:       func() Message { return &MsgReject{} },
+		GetAddrCommand:      func() Message { return &MsgGetAddr{} },
+		AddrCommand:         func() Message { return &MsgAddr{} },
+		SendAddrV2Command:   func() Message { return &MsgSendAddrV2{} },
+		AddrV2Command:       func() Message { return &MsgAddrV2{} },
+		InvCommand:          func() Message { return &MsgInv{} },
+		GetDataCommand:      func() Message { return &MsgGetData{} },
+		NotFoundCommand:     func() Message { return &MsgNotFound{} },
+		GetHeadersCommand:   func() Message { return &MsgGetHeaders{} },
+		HeadersCommand:      func() Message { return &MsgHeaders{} },
+		TxCommand:           func() Message { return &MsgTx{} },
+		BlockCommand:        func() Message { return &MsgBlock{} },
+		SendHeadersCommand:  func() Message { return &MsgSendHeaders{} },
+		FeeFilterCommand:    func() Message { return &MsgFeeFilter{} },
+		WTxIDRelayCommand:   func() Message { return &MsgWTxIDRelay{} },
+		SendCmpctCommand:    func() Message { return &MsgSendCmpct{} },
+		CmpctBlockCommand:   func() Message { return &MsgCmpctBlock{} },
+		GetBlockTxnCommand:  func() Message { return &MsgGetBlockTxn{} },
+		BlockTxnCommand:     func() Message { return &MsgBlockTxn{} },
+		GetCFiltersCommand:  func() Message { return &MsgGetCFilters{} },
+		CFilterCommand:      func() Message { return &MsgCFilter{} },
+		GetCFHeadersCommand: func() Message { return &MsgGetCFHeaders{} },
+		CFHeadersCommand:    func() Message { return &MsgCFHeaders{} },
+		GetCFCheckptCommand: func() Message { return &MsgGetCFCheckpt{} },
+		CFCheckptCommand:    func() Message { return &MsgCFCheckpt{} },
+		FilterLoadCommand:   func() Message { return &MsgFilterLoad{} },
+		FilterAddCommand:    func() Message { return &MsgFilterAdd{} },
+		FilterClearCommand:  func() Message { return &MsgFilterClear{} },
+		MerkleBlockCommand:  func() Message { return &MsgMerkleBlock{} },
+		MempoolCommand:      func() Message { return &MsgMempool{} },
+	}
+}
+
+// Register sets the message type of a command, replacing the previous one.
+func (r *Registry) Register(command Command, factory MessageFactory) error {
+	err := validateCommand(command)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages[command] = factory
+	return nil
+}
+
+// RegisterForNetwork sets the message type of a command on one network only.
+// It takes precedence over the other registrations.
+func (r *Registry) RegisterForNetwork(network Network, command Command, factory MessageFactory) error {
+	err := validateCommand(command)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.networks[network] == nil {
+		r.networks[network] = map[Command]MessageFactory{}
+	}
+	r.networks[network][command] = factory
+	return nil
+}
+
+// RegisterForVersion sets the message type of a command for peers with a
+// negotiated protocol version of at least minVersion. The registration with
+// the highest minimum version the peer meets wins.
+func (r *Registry) RegisterForVersion(minVersion uint32, command Command, factory MessageFactory) error {
+	err := validateCommand(command)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	versions := r.versions[command]
+	versions = append(versions, versionFactory{minVersion: minVersion, factory: factory})
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].minVersion > versions[j].minVersion
+	})
+	r.versions[command] = versions
+	return nil
+}
+
+// Unregister removes every registration of the command, so it is read as
+// MsgRaw.
+func (r *Registry) Unregister(command Command) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.messages, command)
+	delete(r.versions, command)
+	for _, messages := range r.networks {
+		delete(messages, command)
+	}
+}
+
+// Create returns an empty message for the header's command on the network at
+// the protocol version, zero if it is not known yet.
+func (r *Registry) Create(header *Header, network Network, version uint32) (Message, error) {
+	factory := r.lookup(header.GetCommand(), network, version)
+	if factory == nil {
+		return NewRawMsg(header)
+	}
+	msg := factory()
+	if msg == nil {
+		return nil, fmt.Errorf("no message created for command %s", header.GetCommand())
+	}
+	return msg, nil
+}
+
+func (r *Registry) lookup(command Command, network Network, version uint32) MessageFactory {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if factory, ok := r.networks[network][command]; ok {
+		return factory
+	}
+	if version > 0 {
+		for _, v := range r.versions[command] {
+			if version >= v.minVersion {
+				return v.factory
+			}
+		}
+	}
+	return r.messages[command]
+}
+
+// Commands have to fit the 12 byte header field and are padded with NUL.
+func validateCommand(command Command) error {
+	if len(command) == 0 || len(command) > 12 {
+		return fmt.Errorf("%w: %q must have 1 to 12 characters", ErrInvalidCommand, command)
+	}
+	for _, c := range []byte(command) {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Errorf("%w: %q has non printable characters", ErrInvalidCommand, command)
+		}
+	}
+	return nil
+}
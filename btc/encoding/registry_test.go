@@ -0,0 +1,125 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// An experimental message carrying a single number.
+type msgExperimental struct {
+	Value UInt32
+}
+
+func (msg *msgExperimental) GetCommand() Command {
+	return "experimental"
+}
+
+func (msg *msgExperimental) Encode(writer io.Writer) error {
+	return msg.Value.Encode(writer)
+}
+
+func (msg *msgExperimental) Decode(reader io.Reader) error {
+	return (&msg.Value).Decode(reader)
+}
+
+// A different ping type to tell the registrations apart.
+type msgLegacyPing struct {
+	MsgPing
+}
+
+func testHeader(t *testing.T, command Command) *Header {
+	t.Helper()
+	header, err := NewHeader(NetworkRegtest, command, nil)
+	require.NoError(t, err)
+	return header
+}
+
+func Test_Registry_Standard(t *testing.T) {
+	registry := NewRegistry()
+	msg, err := registry.Create(testHeader(t, PingCommand), NetworkRegtest, 0)
+	require.NoError(t, err)
+	assert.IsType(t, &MsgPing{}, msg)
+
+	msg, err = registry.Create(testHeader(t, "unknown"), NetworkRegtest, 0)
+	require.NoError(t, err)
+	assert.IsType(t, &MsgRaw{}, msg)
+
+	registry.Unregister(PingCommand)
+	msg, err = registry.Create(testHeader(t, PingCommand), NetworkRegtest, 0)
+	require.NoError(t, err)
+	assert.IsType(t, &MsgRaw{}, msg)
+
+	msg, err = NewEmptyRegistry().Create(testHeader(t, VersionCommand), NetworkRegtest, 0)
+	require.NoError(t, err)
+	assert.IsType(t, &MsgRaw{}, msg)
+}
+
+func Test_Registry_Overrides(t *testing.T) {
+	registry := NewRegistry()
+	legacy := func() Message { return &msgLegacyPing{} }
+	experimental := func() Message { return &msgExperimental{} }
+	require.NoError(t, registry.RegisterForVersion(60001, PingCommand, experimental))
+	require.NoError(t, registry.RegisterForVersion(70016, PingCommand, legacy))
+	require.NoError(t, registry.RegisterForNetwork(NetworkTestnet3, PingCommand, legacy))
+
+	tests := []struct {
+		name    string
+		network Network
+		version uint32
+		want    Message
+	}{
+		{name: "unknown version", network: NetworkRegtest, version: 0, want: &MsgPing{}},
+		{name: "old version", network: NetworkRegtest, version: 60000, want: &MsgPing{}},
+		{name: "lower override", network: NetworkRegtest, version: 70015, want: &msgExperimental{}},
+		{name: "higher override", network: NetworkRegtest, version: 70016, want: &msgLegacyPing{}},
+		{name: "network override", network: NetworkTestnet3, version: 0, want: &msgLegacyPing{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := registry.Create(testHeader(t, PingCommand), tt.network, tt.version)
+			require.NoError(t, err)
+			assert.IsType(t, tt.want, msg)
+		})
+	}
+}
+
+func Test_Registry_InvalidCommand(t *testing.T) {
+	registry := NewRegistry()
+	factory := func() Message { return &msgExperimental{} }
+	assert.ErrorIs(t, registry.Register("", factory), ErrInvalidCommand)
+	assert.ErrorIs(t, registry.Register("thirteen_char", factory), ErrInvalidCommand)
+	assert.ErrorIs(t, registry.RegisterForNetwork(NetworkRegtest, "bad\x00", factory), ErrInvalidCommand)
+	assert.ErrorIs(t, registry.RegisterForVersion(1, "bad\n", factory), ErrInvalidCommand)
+}
+
+func Test_Receiver_CustomMessage(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, SendMessage(NetworkRegtest, &msgExperimental{Value: 7}, buf))
+	raw := bytes.Clone(buf.Bytes())
+
+	// Not registered in the default registry.
+	_, msg, err := ReceiveMessage(NetworkRegtest, bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.IsType(t, &MsgRaw{}, msg)
+
+	receiver := NewReceiver(NetworkRegtest)
+	receiver.Registry = NewRegistry()
+	require.NoError(t, receiver.Registry.Register("experimental", func() Message { return &msgExperimental{} }))
+	_, msg, err = receiver.Receive(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, &msgExperimental{Value: 7}, msg)
+}
+
+func Test_Receiver_ZeroValueRegistry(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, SendMessage(NetworkRegtest, &MsgPing{Nonce: 7}, buf))
+
+	receiver := &Receiver{Network: NetworkRegtest, MaxPayloadSize: DefaultMaxPayloadSize}
+	_, msg, err := receiver.Receive(buf)
+	require.NoError(t, err)
+	assert.Equal(t, &MsgPing{Nonce: 7}, msg)
+}
@@ -0,0 +1,113 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Reject messages were added in protocol version 70002. Peers with older
+// versions don't understand them.
+const RejectVersion = 70002
+
+// Bitcoin Core limits the rejected command to the size of a header command
+// and the reason to 111 bytes.
+const (
+	maxRejectMessageLength = 12
+	MaxRejectReasonLength  = 111
+)
+
+type RejectCode UInt8
+
+const (
+	RejectMalformed       RejectCode = 0x01
+	RejectInvalid         RejectCode = 0x10
+	RejectObsolete        RejectCode = 0x11
+	RejectDuplicate       RejectCode = 0x12
+	RejectNonstandard     RejectCode = 0x40
+	RejectDust            RejectCode = 0x41
+	RejectInsufficientFee RejectCode = 0x42
+	RejectCheckpoint      RejectCode = 0x43
+)
+
+func (code *RejectCode) Encode(writer io.Writer) error {
+	ui := UInt8(*code)
+	return (&ui).Encode(writer)
+}
+
+func (code *RejectCode) Decode(reader io.Reader) error {
+	ui := UInt8(0)
+	err := (&ui).Decode(reader)
+	if err != nil {
+		return errors.Wrap(err, "reject code read error")
+	}
+	*code = RejectCode(ui)
+	return nil
+}
+
+type MsgReject struct {
+	Message VarStr
+	Code    RejectCode
+	Reason  VarStr
+	// Hash of the rejected transaction or block. Not present for other messages.
+	Hash *Hash
+}
+
+// NewRejectMsg creates a reject message. Longer reasons are cut to the length
+// peers accept.
+func NewRejectMsg(command Command, code RejectCode, reason string, hash *Hash) (*MsgReject, error) {
+	if len(reason) > MaxRejectReasonLength {
+		reason = reason[:MaxRejectReasonLength]
+	}
+	return &MsgReject{
+		Message: VarStr(command),
+		Code:    code,
+		Reason:  VarStr(reason),
+		Hash:    hash,
+	}, nil
+}
+
+func (reject *MsgReject) GetCommand() Command {
+	return RejectCommand
+}
+
+func (reject *MsgReject) Encode(writer io.Writer) error {
+	steps := []*encodeStep{
+		step("message", &reject.Message),
+		step("ccode", &reject.Code),
+		step("reason", &reject.Reason),
+	}
+	if reject.Hash != nil {
+		steps = append(steps, step("data", reject.Hash))
+	}
+	err := encode(writer, steps...)
+	if err != nil {
+		return fmt.Errorf("error encoding reject fields: %w", err)
+	}
+	return nil
+}
+
+func (reject *MsgReject) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("message", limitedVarStr{str: &reject.Message, limit: maxRejectMessageLength}),
+		step("ccode", &reject.Code),
+		step("reason", limitedVarStr{str: &reject.Reason, limit: MaxRejectReasonLength}),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding reject fields: %w", err)
+	}
+
+	// The optional hash is the only thing left in the payload if present.
+	hash := Hash{}
+	_, err = io.ReadFull(reader, hash[:])
+	switch {
+	case errors.Is(err, io.EOF):
+		reject.Hash = nil
+	case err != nil:
+		return fmt.Errorf("error decoding reject data: %w", err)
+	default:
+		reject.Hash = &hash
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package encoding
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Reject_Encode(t *testing.T) {
+	tests := []struct {
+		name   string
+		reject *MsgReject
+		want   string
+	}{
+		{
+			name: "without hash",
+			reject: noErr(t, func() (*MsgReject, error) {
+				return NewRejectMsg(VersionCommand, RejectDuplicate, "Duplicate version message", nil)
+			}),
+			want: strip(`
+			07 76 65 72 73 69 6F 6E 12 19 44 75 70 6C 69 63
+			61 74 65 20 76 65 72 73 69 6F 6E 20 6D 65 73 73
+			61 67 65`),
+		},
+		{
+			name: "with hash",
+			reject: noErr(t, func() (*MsgReject, error) {
+				hash := Hash{0x01, 0x02}
+				return NewRejectMsg("tx", RejectDust, "dust", &hash)
+			}),
+			want: strip(`
+			02 74 78 41 04 64 75 73 74 01 02 00 00 00 00 00
+			00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+			00 00 00 00 00 00 00 00 00`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := tt.reject.Encode(buf)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, formatBinary(buf.Bytes()))
+		})
+	}
+}
+
+func Test_Reject_Roundtrip(t *testing.T) {
+	hash := Hash{0xAA, 0xBB}
+	tests := []struct {
+		name   string
+		reject *MsgReject
+	}{
+		{
+			name: "without hash",
+			reject: noErr(t, func() (*MsgReject, error) {
+				return NewRejectMsg(PingCommand, RejectMalformed, "bad checksum", nil)
+			}),
+		},
+		{
+			name: "with hash",
+			reject: noErr(t, func() (*MsgReject, error) {
+				return NewRejectMsg("block", RejectInvalid, "bad-txnmrklroot", &hash)
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := SendMessage(NetworkRegtest, tt.reject, buf)
+			assert.NoError(t, err)
+
+			header, got, err := ReceiveMessage(NetworkRegtest, buf)
+			assert.NoError(t, err)
+			assert.Equal(t, RejectCommand, header.GetCommand())
+			assert.Equal(t, tt.reject, got)
+		})
+	}
+}
+
+func Test_Reject_Decode_Truncated(t *testing.T) {
+	input := unformatBinary(`02 74 78 41 04 64 75 73 74 01 02 03`)
+	err := (&MsgReject{}).Decode(bytes.NewBuffer(input))
+	assert.ErrorContains(t, err, "error decoding reject data")
+}
+
+func Test_Reject_Decode_Limits(t *testing.T) {
+	long := func(n int) VarStr { return VarStr(strings.Repeat("x", n)) }
+	tests := []struct {
+		name    string
+		reject  *MsgReject
+		wantErr bool
+	}{
+		{name: "at limits", reject: &MsgReject{Message: long(12), Reason: long(MaxRejectReasonLength)}},
+		{name: "long message", reject: &MsgReject{Message: long(13)}, wantErr: true},
+		{name: "long reason", reject: &MsgReject{Message: "tx", Reason: long(MaxRejectReasonLength + 1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			require.NoError(t, tt.reject.Encode(buf))
+
+			err := (&MsgReject{}).Decode(buf)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "too long")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_NewRejectMsg_TruncatesReason(t *testing.T) {
+	reject, err := NewRejectMsg(TxCommand, RejectInvalid, strings.Repeat("x", 200), nil)
+	require.NoError(t, err)
+	assert.Len(t, reject.Reason, MaxRejectReasonLength)
+}
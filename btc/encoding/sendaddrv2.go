@@ -0,0 +1,27 @@
+package encoding
+
+import (
+	"io"
+)
+
+// MsgSendAddrV2 signals support for addrv2 messages (BIP155). It has to be
+// sent after version and before verack.
+type MsgSendAddrV2 struct {
+	// sendaddrv2 has no body and contains just a header
+}
+
+func NewSendAddrV2Msg() (*MsgSendAddrV2, error) {
+	return &MsgSendAddrV2{}, nil
+}
+
+func (sendAddrV2 *MsgSendAddrV2) GetCommand() Command {
+	return SendAddrV2Command
+}
+
+func (sendAddrV2 *MsgSendAddrV2) Encode(writer io.Writer) error {
+	return nil
+}
+
+func (sendAddrV2 *MsgSendAddrV2) Decode(reader io.Reader) error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// Peers support compact blocks from this protocol version (BIP152).
+	ShortIDsBlocksVersion = 70014
+	// Version 2 compact blocks use wtxids, the only version still in use.
+	CmpctBlocksVersion = 2
+)
+
+// MsgSendCmpct announces support for compact blocks of a version (BIP152).
+// With Announce set, the peer may send new blocks as cmpctblock messages
+// without an inv first.
+type MsgSendCmpct struct {
+	Announce UInt8
+	Version  UInt64
+}
+
+func NewSendCmpctMsg(announce bool, version uint64) (*MsgSendCmpct, error) {
+	msg := &MsgSendCmpct{Version: UInt64(version)}
+	if announce {
+		msg.Announce = 1
+	}
+	return msg, nil
+}
+
+func (sendCmpct *MsgSendCmpct) GetCommand() Command {
+	return SendCmpctCommand
+}
+
+func (sendCmpct *MsgSendCmpct) Encode(writer io.Writer) error {
+	err := encode(writer,
+		step("announce", &sendCmpct.Announce),
+		step("version", &sendCmpct.Version),
+	)
+	if err != nil {
+		return fmt.Errorf("error encoding sendcmpct fields: %w", err)
+	}
+	return nil
+}
+
+func (sendCmpct *MsgSendCmpct) Decode(reader io.Reader) error {
+	err := decode(reader,
+		step("announce", &sendCmpct.Announce),
+		step("version", &sendCmpct.Version),
+	)
+	if err != nil {
+		return fmt.Errorf("error decoding sendcmpct fields: %w", err)
+	}
+	return nil
+}
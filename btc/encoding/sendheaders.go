@@ -0,0 +1,30 @@
+package encoding
+
+import (
+	"io"
+)
+
+// Peers support sendheaders from this protocol version (BIP130).
+const SendHeadersVersion = 70012
+
+// MsgSendHeaders asks the peer to announce new blocks with headers instead of
+// inv messages (BIP130).
+type MsgSendHeaders struct {
+	// sendheaders has no body and contains just a header
+}
+
+func NewSendHeadersMsg() (*MsgSendHeaders, error) {
+	return &MsgSendHeaders{}, nil
+}
+
+func (sendHeaders *MsgSendHeaders) GetCommand() Command {
+	return SendHeadersCommand
+}
+
+func (sendHeaders *MsgSendHeaders) Encode(writer io.Writer) error {
+	return nil
+}
+
+func (sendHeaders *MsgSendHeaders) Decode(reader io.Reader) error {
+	return nil
+}
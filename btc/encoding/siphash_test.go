@@ -0,0 +1,29 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SipHash24(t *testing.T) {
+	// Vectors from the SipHash paper: key 00..0f, message 00..(n-1).
+	k0, k1 := uint64(0x0706050403020100), uint64(0x0f0e0d0c0b0a0908)
+	message := make([]byte, 16)
+	for i := range message {
+		message[i] = byte(i)
+	}
+
+	tests := []struct {
+		length int
+		want   uint64
+	}{
+		{length: 0, want: 0x726fdb47dd0e0e31},
+		{length: 1, want: 0x74f839c593dc67fd},
+		{length: 8, want: 0x93f5f5799a932462},
+		{length: 15, want: 0xa129ca6149be45e5},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, SipHash24(k0, k1, message[:tt.length]), "length %d", tt.length)
+	}
+}
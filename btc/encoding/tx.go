@@ -0,0 +1,286 @@
+package encoding
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// BIP141 limits blocks to 4M weight units. Non-witness bytes weigh 4 units.
+	MaxBlockWeight     = 4_000_000
+	WitnessScaleFactor = 4
+
+	// Smallest possible input: outpoint, empty script and sequence.
+	minTxInSize = 41
+	// Smallest possible output: value and empty script.
+	minTxOutSize = 9
+	// Smallest serialization we can decode: version, both counts and lock
+	// time.
+	minTxEncodedSize = 4 + 1 + 1 + 4
+
+	maxTxIns  = MaxBlockWeight / WitnessScaleFactor / minTxInSize
+	maxTxOuts = MaxBlockWeight / WitnessScaleFactor / minTxOutSize
+	// Every witness item takes at least its one byte length, so the count is
+	// bounded by what is left of the payload rather than by the block size.
+	maxWitnessItems = DefaultMaxPayloadSize
+)
+
+// BIP144 marks witness serialization with a zero byte where the input count
+// would be, followed by a flag.
+const (
+	witnessMarker = 0x00
+	witnessFlag   = 0x01
+)
+
+type OutPoint struct {
+	Hash  Hash
+	Index UInt32
+}
+
+func (op *OutPoint) Encode(writer io.Writer) error {
+	return encode(writer,
+		step("hash", &op.Hash),
+		step("index", &op.Index),
+	)
+}
+
+func (op *OutPoint) Decode(reader io.Reader) error {
+	return decode(reader,
+		step("hash", &op.Hash),
+		step("index", &op.Index),
+	)
+}
+
+// TxWitness is the witness stack of a single input.
+type TxWitness []VarBytes
+
+func (witness *TxWitness) Encode(writer io.Writer) error {
+	count := VarInt(len(*witness))
+	steps := []*encodeStep{step("count", &count)}
+	for i := range *witness {
+		steps = append(steps, step("item", &(*witness)[i]))
+	}
+	return encode(writer, steps...)
+}
+
+func (witness *TxWitness) Decode(reader io.Reader) error {
+	count, err := decodeCount(reader, maxWitnessItems, 1)
+	if err != nil {
+		return fmt.Errorf("error decoding witness count: %w", err)
+	}
+	*witness = make(TxWitness, count)
+	for i := range *witness {
+		err = (&(*witness)[i]).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding witness item %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// TxIn is a transaction input. The witness is not part of the input
+// serialization, MsgTx encodes it separately after the outputs.
+type TxIn struct {
+	PreviousOutPoint OutPoint
+	SignatureScript  VarBytes
+	Sequence         UInt32
+	Witness          TxWitness
+}
+
+func (in *TxIn) Encode(writer io.Writer) error {
+	return encode(writer,
+		step("previous_output", &in.PreviousOutPoint),
+		step("signature_script", &in.SignatureScript),
+		step("sequence", &in.Sequence),
+	)
+}
+
+func (in *TxIn) Decode(reader io.Reader) error {
+	return decode(reader,
+		step("previous_output", &in.PreviousOutPoint),
+		step("signature_script", &in.SignatureScript),
+		step("sequence", &in.Sequence),
+	)
+}
+
+type TxOut struct {
+	Value    UInt64
+	PkScript VarBytes
+}
+
+func (out *TxOut) Encode(writer io.Writer) error {
+	return encode(writer,
+		step("value", &out.Value),
+		step("pk_script", &out.PkScript),
+	)
+}
+
+func (out *TxOut) Decode(reader io.Reader) error {
+	return decode(reader,
+		step("value", &out.Value),
+		step("pk_script", &out.PkScript),
+	)
+}
+
+type MsgTx struct {
+	Version  UInt32
+	TxIn     []TxIn
+	TxOut    []TxOut
+	LockTime UInt32
+}
+
+func (tx *MsgTx) GetCommand() Command {
+	return TxCommand
+}
+
+// HasWitness reports whether any of the inputs carries witness data.
+func (tx *MsgTx) HasWitness() bool {
+	for i := range tx.TxIn {
+		if len(tx.TxIn[i].Witness) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// StripWitness returns a copy of the transaction without witness data, which
+// encodes to the legacy serialization peers get for MSG_TX (BIP144).
+func (tx *MsgTx) StripWitness() *MsgTx {
+	stripped := *tx
+	stripped.TxIn = make([]TxIn, len(tx.TxIn))
+	for i, in := range tx.TxIn {
+		in.Witness = nil
+		stripped.TxIn[i] = in
+	}
+	return &stripped
+}
+
+// IsCoinbase reports whether the transaction is a coinbase: a single input
+// spending the null outpoint.
+func (tx *MsgTx) IsCoinbase() bool {
+	return len(tx.TxIn) == 1 && tx.TxIn[0].PreviousOutPoint.Hash == Hash{} &&
+		tx.TxIn[0].PreviousOutPoint.Index == 0xffffffff
+}
+
+// TxHash returns the txid: the hash of the serialization without witness data.
+func (tx *MsgTx) TxHash() Hash {
+	buf := bytes.NewBuffer(nil)
+	// Writing to a bytes.Buffer can't fail.
+	_ = tx.encode(buf, false)
+	return DoubleSHA256(buf.Bytes())
+}
+
+// WitnessHash returns the wtxid: the hash of the BIP144 serialization. It is
+// the same as the txid for transactions without witness data.
+func (tx *MsgTx) WitnessHash() Hash {
+	buf := bytes.NewBuffer(nil)
+	_ = tx.encode(buf, tx.HasWitness())
+	return DoubleSHA256(buf.Bytes())
+}
+
+// Encode writes the witness serialization if the transaction has witness
+// data and the legacy one otherwise.
+func (tx *MsgTx) Encode(writer io.Writer) error {
+	err := tx.encode(writer, tx.HasWitness())
+	if err != nil {
+		return fmt.Errorf("error encoding tx fields: %w", err)
+	}
+	return nil
+}
+
+func (tx *MsgTx) encode(writer io.Writer, witness bool) error {
+	steps := []*encodeStep{step("version", &tx.Version)}
+	if witness {
+		marker, flag := UInt8(witnessMarker), UInt8(witnessFlag)
+		steps = append(steps, step("marker", &marker), step("flag", &flag))
+	}
+
+	inCount := VarInt(len(tx.TxIn))
+	steps = append(steps, step("tx_in_count", &inCount))
+	for i := range tx.TxIn {
+		steps = append(steps, step("tx_in", &tx.TxIn[i]))
+	}
+	outCount := VarInt(len(tx.TxOut))
+	steps = append(steps, step("tx_out_count", &outCount))
+	for i := range tx.TxOut {
+		steps = append(steps, step("tx_out", &tx.TxOut[i]))
+	}
+	if witness {
+		for i := range tx.TxIn {
+			steps = append(steps, step("witness", &tx.TxIn[i].Witness))
+		}
+	}
+	steps = append(steps, step("lock_time", &tx.LockTime))
+	return encode(writer, steps...)
+}
+
+//nolint:funlen,cyclop // follows the serialization format
+func (tx *MsgTx) Decode(reader io.Reader) error {
+	err := (&tx.Version).Decode(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding tx version: %w", err)
+	}
+
+	// Like Bitcoin Core, we read a zero input count as the segwit marker.
+	inCount, err := decodeCount(reader, maxTxIns, minTxInSize)
+	if err != nil {
+		return fmt.Errorf("error decoding tx_in count: %w", err)
+	}
+	witness := false
+	if inCount == witnessMarker {
+		flag := UInt8(0)
+		err = (&flag).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding tx flag: %w", err)
+		}
+		if flag != witnessFlag {
+			return fmt.Errorf("unknown tx flag: %d", flag)
+		}
+		witness = true
+		inCount, err = decodeCount(reader, maxTxIns, minTxInSize)
+		if err != nil {
+			return fmt.Errorf("error decoding tx_in count: %w", err)
+		}
+	}
+
+	tx.TxIn = make([]TxIn, inCount)
+	for i := range tx.TxIn {
+		err = (&tx.TxIn[i]).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding tx_in %d: %w", i, err)
+		}
+	}
+	outCount, err := decodeCount(reader, maxTxOuts, minTxOutSize)
+	if err != nil {
+		return fmt.Errorf("error decoding tx_out count: %w", err)
+	}
+	tx.TxOut = make([]TxOut, outCount)
+	for i := range tx.TxOut {
+		err = (&tx.TxOut[i]).Decode(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding tx_out %d: %w", i, err)
+		}
+	}
+
+	if witness {
+		for i := range tx.TxIn {
+			err = (&tx.TxIn[i].Witness).Decode(reader)
+			if err != nil {
+				return fmt.Errorf("error decoding witness of tx_in %d: %w", i, err)
+			}
+		}
+		// The marker has to be omitted when there is nothing to mark.
+		if !tx.HasWitness() {
+			return errors.New("superfluous witness record")
+		}
+	}
+
+	err = (&tx.LockTime).Decode(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding tx lock_time: %w", err)
+	}
+	return nil
+}
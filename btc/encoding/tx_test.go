@@ -0,0 +1,131 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Coinbase of the mainnet genesis block.
+const genesisCoinbaseHex = "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff" +
+	"4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e20" +
+	"6272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a010000" +
+	"00434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f3" +
+	"5504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+
+// Native P2WPKH example from BIP143, one legacy and one segwit input.
+const segwitTxHex = "01000000000102fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000049" +
+	"4830450221008b9d1dc26ba6a9cb62127b02742fa9d754cd3bebf337f7a55d114c8e5cdd30be022040529b194b" +
+	"a3f9281a99f2b1c0a19c0489bc22ede944ccf4ecbab4cc618ef3ed01eeffffffef51e1b804cc89d182d279655c" +
+	"3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37d" +
+	"f378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0" +
+	"167faa815988ac000247304402203609e17b84f6a7d30c80bfa610b5b4542f32a8a0d5447a12fb1366d7f01cc4" +
+	"4a0220573a954c4518331561406f90300e8f3358f51928d43c212a8caed02de67eebee0121025476c2e8318836" +
+	"8da1ff3e292e7acafcdb3566bb0ad253f62fc70f07aeee635711000000"
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func Test_Tx_DecodeLegacy(t *testing.T) {
+	raw := mustHex(t, genesisCoinbaseHex)
+	tx := &MsgTx{}
+	require.NoError(t, tx.Decode(bytes.NewReader(raw)))
+
+	assert.Equal(t, UInt32(1), tx.Version)
+	require.Len(t, tx.TxIn, 1)
+	require.Len(t, tx.TxOut, 1)
+	assert.True(t, tx.IsCoinbase())
+	assert.False(t, tx.HasWitness())
+	assert.Equal(t, UInt64(5_000_000_000), tx.TxOut[0].Value)
+	assert.Len(t, tx.TxOut[0].PkScript, 67)
+	assert.Equal(t, "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b", tx.TxHash().String())
+	assert.Equal(t, tx.TxHash(), tx.WitnessHash())
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, tx.Encode(buf))
+	assert.Equal(t, raw, buf.Bytes())
+}
+
+func Test_Tx_DecodeSegwit(t *testing.T) {
+	raw := mustHex(t, segwitTxHex)
+	tx := &MsgTx{}
+	require.NoError(t, tx.Decode(bytes.NewReader(raw)))
+
+	require.Len(t, tx.TxIn, 2)
+	require.Len(t, tx.TxOut, 2)
+	assert.True(t, tx.HasWitness())
+	assert.False(t, tx.IsCoinbase())
+	assert.Empty(t, tx.TxIn[0].Witness)
+	require.Len(t, tx.TxIn[1].Witness, 2)
+	assert.Len(t, tx.TxIn[1].Witness[0], 71)
+	assert.Len(t, tx.TxIn[1].Witness[1], 33)
+	assert.Equal(t, UInt32(0x11), tx.LockTime)
+
+	assert.Equal(t, "e8151a2af31c368a35053ddd4bdb285a8595c769a3ad83e0fa02314a602d4609", tx.TxHash().String())
+	assert.Equal(t, "c36c38370907df2324d9ce9d149d191192f338b37665a82e78e76a12c909b762", tx.WitnessHash().String())
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, tx.Encode(buf))
+	assert.Equal(t, raw, buf.Bytes())
+
+	stripped := tx.StripWitness()
+	assert.False(t, stripped.HasWitness())
+	assert.Equal(t, tx.TxHash(), stripped.WitnessHash())
+	assert.True(t, tx.HasWitness(), "the original keeps its witness")
+}
+
+func Test_Tx_DecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			name: "unknown flag",
+			raw:  "01000000" + "0002",
+			want: "unknown tx flag: 2",
+		},
+		{
+			name: "superfluous witness",
+			// One input, no outputs and an empty witness stack.
+			raw:  "01000000" + "0001" + "01" + hex.EncodeToString(make([]byte, 36)) + "00" + "ffffffff" + "00" + "00" + "00000000",
+			want: "superfluous witness record",
+		},
+		{
+			name: "too many inputs",
+			raw:  "01000000" + "feffffff00",
+			want: "too many entries",
+		},
+		{
+			name: "witness count over payload",
+			// One input, no outputs and a stack of 4M items.
+			raw:  "01000000" + "0001" + "01" + hex.EncodeToString(make([]byte, 36)) + "00" + "ffffffff" + "00" + "fe00093d00" + "00000000",
+			want: "need at least 4000000 bytes, 4 left",
+		},
+		{
+			name: "script over payload",
+			raw:  "01000000" + "01" + hex.EncodeToString(make([]byte, 36)) + "fe00000002" + "ffffffff",
+			want: "need at least 33554432 bytes, 4 left",
+		},
+		{
+			name: "truncated",
+			raw:  genesisCoinbaseHex[:100],
+			want: "error decoding tx_in 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &MsgTx{}
+			err := tx.Decode(bytes.NewReader(mustHex(t, tt.raw)))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package encoding
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ClientName    = "MemeClient"
+	ClientVersion = "0.0.1"
+
+	// Bitcoin Core drops peers with longer user agents.
+	MaxUserAgentLength = 256
+)
+
+var ErrInvalidUserAgent = errors.New("invalid user agent")
+
+// Characters Bitcoin Core allows in user agent comments.
+const safeUserAgentChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 .,;-_/:?@()"
+
+// BuildUserAgent formats a BIP14 user agent, e.g. "/Name:1.0(comment; other)/".
+// Names and versions can't contain the separators, comments are limited to
+// the characters Bitcoin Core accepts.
+func BuildUserAgent(name, version string, comments ...string) (string, error) {
+	for _, part := range []string{name, version} {
+		if part == "" || strings.ContainsAny(part, "/:();") || !isSafeUserAgent(part) {
+			return "", fmt.Errorf("%w: bad name or version %q", ErrInvalidUserAgent, part)
+		}
+	}
+	for _, comment := range comments {
+		if !isSafeUserAgent(comment) {
+			return "", fmt.Errorf("%w: bad comment %q", ErrInvalidUserAgent, comment)
+		}
+	}
+
+	userAgent := "/" + name + ":" + version
+	if len(comments) > 0 {
+		userAgent += "(" + strings.Join(comments, "; ") + ")"
+	}
+	userAgent += "/"
+	if len(userAgent) > MaxUserAgentLength {
+		return "", fmt.Errorf("%w: %d bytes, limit is %d", ErrInvalidUserAgent, len(userAgent), MaxUserAgentLength)
+	}
+	return userAgent, nil
+}
+
+func isSafeUserAgent(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune(safeUserAgentChars, r) {
+			return false
+		}
+	}
+	return true
+}
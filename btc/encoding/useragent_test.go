@@ -0,0 +1,38 @@
+package encoding
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BuildUserAgent(t *testing.T) {
+	tests := []struct {
+		name     string
+		agent    string
+		version  string
+		comments []string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default", agent: ClientName, version: ClientVersion, want: UserAgent},
+		{name: "BIP14 example", agent: "Satoshi", version: "5.64", comments: []string{"Linux", "Ubuntu 12.04"}, want: "/Satoshi:5.64(Linux; Ubuntu 12.04)/"},
+		{name: "empty name", agent: "", version: "1.0", wantErr: true},
+		{name: "separator in name", agent: "Bad/Name", version: "1.0", wantErr: true},
+		{name: "separator in version", agent: "Name", version: "1:0", wantErr: true},
+		{name: "unsafe comment", agent: "Name", version: "1.0", comments: []string{"<script>"}, wantErr: true},
+		{name: "too long", agent: "Name", version: "1.0", comments: []string{strings.Repeat("a", MaxUserAgentLength)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildUserAgent(tt.agent, tt.version, tt.comments...)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidUserAgent)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -15,7 +15,7 @@ func Test_Verack_Roundtrip(t *testing.T) {
 
 	err = SendMessage(NetworkMainnet, verack, buf)
 	assert.NoError(t, err)
-	header, got, err := ReceiveMessage(buf)
+	header, got, err := ReceiveMessage(NetworkMainnet, buf)
 	assert.NoError(t, err)
 
 	assert.Equal(t, VerackCommand, header.GetCommand())
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"io"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 type MsgVersion struct {
-	Version     UInt32 // 70015
+	Version     UInt32 // 70016
 	Services    Services
 	Timestamp   UInt64
 	AddrRecv    NetworkAddress
@@ -16,8 +18,17 @@ type MsgVersion struct {
 	UserAgent   VarStr
 	StartHeight UInt32
 	Relay       UInt8
+
+	// Trailing data we don't know how to parse.
+	Extra []byte
 }
 
+// Versions before 106 end the message after addr_recv.
+const AddrFromVersion = 106
+
+// Index of addr_recv in the decoding steps, the last field every version has.
+const addrRecvStep = 3
+
 func NewVersionMsg(
 	timestamp time.Time,
 	services Services,
@@ -45,37 +56,78 @@ func (version *MsgVersion) GetCommand() Command {
 }
 
 func (version *MsgVersion) Encode(writer io.Writer) error {
-	err := encode(writer,
-		step("version", &version.Version),
-		step("services", &version.Services),
-		step("timestamp", &version.Timestamp),
-		step("addr_recv", &version.AddrRecv),
-		step("addr_from", &version.AddrFrom),
-		step("nonce", &version.Nonce),
-		step("user_agent", &version.UserAgent),
-		step("start_height", &version.StartHeight),
-		step("relay", &version.Relay),
-	)
+	err := encode(writer, version.steps()...)
 	if err != nil {
 		return fmt.Errorf("error encoding version fields: %w", err)
 	}
+	_, err = writer.Write(version.Extra)
+	if err != nil {
+		return fmt.Errorf("error encoding version extra data: %w", err)
+	}
 	return nil
 }
 
 func (version *MsgVersion) Decode(reader io.Reader) error {
-	err := decode(reader,
+	err := (&version.Version).Decode(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding version fields: %w", err)
+	}
+	steps := version.steps()
+	err = decode(reader, steps[1:min(len(steps), addrRecvStep+1)]...)
+	if err != nil {
+		return fmt.Errorf("error decoding version fields: %w", err)
+	}
+
+	// Like Bitcoin Core, we accept messages that end early after addr_recv.
+	// Each of addr_from with nonce, user_agent, start_height and relay is
+	// only read if there is data left. Relay came with BIP37 in 70001, but
+	// Bitcoin Core accepts versions without it from any peer.
+	if version.Version >= AddrFromVersion {
+		optional := steps[addrRecvStep+1:]
+		groups := [][]*encodeStep{optional[:2], optional[2:3], optional[3:4], optional[4:]}
+		for _, group := range groups {
+			err = decode(reader, group[0])
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err == nil {
+				err = decode(reader, group[1:]...)
+			}
+			if err != nil {
+				return fmt.Errorf("error decoding version fields: %w", err)
+			}
+		}
+	}
+
+	// Newer versions may add fields, keep them so the message re-encodes as
+	// it was received.
+	extra, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding version extra data: %w", err)
+	}
+	if len(extra) > 0 {
+		version.Extra = extra
+	}
+	return nil
+}
+
+// The fields present at the advertised protocol version. Like Bitcoin Core,
+// we always send relay to newer peers.
+func (version *MsgVersion) steps() []*encodeStep {
+	steps := []*encodeStep{
 		step("version", &version.Version),
 		step("services", &version.Services),
 		step("timestamp", &version.Timestamp),
 		step("addr_recv", &version.AddrRecv),
-		step("addr_from", &version.AddrFrom),
-		step("nonce", &version.Nonce),
-		step("user_agent", &version.UserAgent),
-		step("start_height", &version.StartHeight),
-		step("relay", &version.Relay),
-	)
-	if err != nil {
-		return fmt.Errorf("error decoding version fields: %w", err)
 	}
-	return nil
+	if version.Version >= AddrFromVersion {
+		steps = append(steps,
+			step("addr_from", &version.AddrFrom),
+			step("nonce", &version.Nonce),
+			step("user_agent", limitedVarStr{str: &version.UserAgent, limit: MaxUserAgentLength}),
+			step("start_height", &version.StartHeight),
+			step("relay", &version.Relay),
+		)
+	}
+	return steps
 }
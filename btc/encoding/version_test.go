@@ -2,10 +2,12 @@ package encoding
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const docsUserAgent = "/Satoshi:0.7.2/"
@@ -155,7 +157,7 @@ func Test_Version_Receive(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			buf := bytes.NewBuffer(tt.input)
-			header, got, err := ReceiveMessage(buf)
+			header, got, err := ReceiveMessage(NetworkMainnet, buf)
 			assert.NoError(t, err)
 
 			assert.Equal(t, VersionCommand, header.GetCommand())
@@ -163,3 +165,170 @@ func Test_Version_Receive(t *testing.T) {
 		})
 	}
 }
+
+func Test_Version_DecodeByProtocolVersion(t *testing.T) {
+	addr := noErr(t, func() (*NetworkAddress, error) {
+		return NewIP4Address(ServicesNodeNetwork, "10.0.0.1:8333")
+	})
+	full := noErr(t, func() (*MsgVersion, error) {
+		return NewVersionMsg(time.Unix(0x50D0B211, 0), ServicesNodeNetwork, addr, addr, 0x6517E68C5DB32E3B, 100)
+	})
+	encoded := bytes.NewBuffer(nil)
+	assert.NoError(t, full.Encode(encoded))
+	// version, services, timestamp and addr_recv.
+	const addrRecvEnd = 4 + 8 + 8 + 26
+	// addr_from and nonce.
+	const nonceEnd = addrRecvEnd + 26 + 8
+
+	tests := []struct {
+		name    string
+		version UInt32
+		payload []byte
+		want    func(v *MsgVersion)
+		wantErr bool
+	}{
+		{
+			name:    "before addr_from",
+			version: 105,
+			payload: encoded.Bytes()[:addrRecvEnd],
+			want: func(v *MsgVersion) {
+				v.AddrFrom = NetworkAddress{}
+				v.Nonce = 0
+				v.UserAgent = ""
+				v.StartHeight = 0
+			},
+		},
+		{
+			name:    "before addr_from with trailing data",
+			version: 105,
+			payload: encoded.Bytes(),
+			want: func(v *MsgVersion) {
+				v.Extra = encoded.Bytes()[addrRecvEnd:]
+				v.AddrFrom = NetworkAddress{}
+				v.Nonce = 0
+				v.UserAgent = ""
+				v.StartHeight = 0
+			},
+		},
+		{
+			name:    "without relay",
+			version: 60002,
+			payload: encoded.Bytes()[:encoded.Len()-1],
+			want:    func(*MsgVersion) {},
+		},
+		{
+			name:    "after addr_recv",
+			version: ProtocolVersion,
+			payload: encoded.Bytes()[:addrRecvEnd],
+			want: func(v *MsgVersion) {
+				v.AddrFrom = NetworkAddress{}
+				v.Nonce = 0
+				v.UserAgent = ""
+				v.StartHeight = 0
+				v.Relay = 0
+			},
+		},
+		{
+			name:    "after nonce",
+			version: ProtocolVersion,
+			payload: encoded.Bytes()[:nonceEnd],
+			want: func(v *MsgVersion) {
+				v.UserAgent = ""
+				v.StartHeight = 0
+			},
+		},
+		{
+			name:    "after user_agent",
+			version: ProtocolVersion,
+			payload: encoded.Bytes()[:encoded.Len()-5],
+			want: func(v *MsgVersion) {
+				v.StartHeight = 0
+			},
+		},
+		{
+			name:    "truncated nonce",
+			version: ProtocolVersion,
+			payload: encoded.Bytes()[:nonceEnd-1],
+			wantErr: true,
+		},
+		{
+			name:    "with trailing data",
+			version: ProtocolVersion,
+			payload: append(bytes.Clone(encoded.Bytes()), 0xAA, 0xBB),
+			want: func(v *MsgVersion) {
+				v.Extra = []byte{0xAA, 0xBB}
+			},
+		},
+		{
+			name:    "truncated start_height",
+			version: ProtocolVersion,
+			payload: encoded.Bytes()[:encoded.Len()-3],
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := bytes.Clone(tt.payload)
+			le.PutUint32(payload, uint32(tt.version))
+
+			got := &MsgVersion{}
+			err := got.Decode(bytes.NewReader(payload))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			want := *full
+			want.Version = tt.version
+			tt.want(&want)
+			assert.Equal(t, &want, got)
+
+			// Fields we don't understand survive a round trip.
+			if want.Extra != nil {
+				buf := bytes.NewBuffer(nil)
+				assert.NoError(t, got.Encode(buf))
+				assert.Equal(t, payload, buf.Bytes())
+			}
+		})
+	}
+}
+
+func Test_Version_DecodeUserAgentLimit(t *testing.T) {
+	addr := noErr(t, func() (*NetworkAddress, error) {
+		return NewIP4Address(ServicesNodeNetwork, "10.0.0.1:8333")
+	})
+	// version through nonce.
+	const userAgentStart = 4 + 8 + 8 + 26 + 26 + 8
+
+	tests := []struct {
+		name      string
+		userAgent []byte
+		wantErr   bool
+	}{
+		{name: "at limit", userAgent: []byte{0xFD, 0x00, 0x01}},
+		{name: "over limit", userAgent: []byte{0xFD, 0x01, 0x01}, wantErr: true},
+		{name: "huge", userAgent: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version := noErr(t, func() (*MsgVersion, error) {
+				return NewVersionMsg(time.Unix(0x50D0B211, 0), ServicesNodeNetwork, addr, addr, 1, 100)
+			})
+			version.UserAgent = VarStr(strings.Repeat("x", MaxUserAgentLength))
+			encoded := bytes.NewBuffer(nil)
+			require.NoError(t, version.Encode(encoded))
+			payload := append(bytes.Clone(encoded.Bytes()[:userAgentStart]), tt.userAgent...)
+			payload = append(payload, encoded.Bytes()[userAgentStart+3:]...)
+
+			_, got, err := ReceiveMessage(NetworkRegtest, frame(t, NetworkRegtest, VersionCommand, payload))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrMalformedPayload)
+				assert.ErrorContains(t, err, "too long")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, version, got)
+		})
+	}
+}
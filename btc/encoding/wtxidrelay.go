@@ -0,0 +1,30 @@
+package encoding
+
+import (
+	"io"
+)
+
+// Peers support wtxidrelay from this protocol version (BIP339).
+const WTxIDRelayVersion = 70016
+
+// MsgWTxIDRelay signals that we announce and request transactions by wtxid
+// (BIP339). It has to be sent after version and before verack.
+type MsgWTxIDRelay struct {
+	// wtxidrelay has no body and contains just a header
+}
+
+func NewWTxIDRelayMsg() (*MsgWTxIDRelay, error) {
+	return &MsgWTxIDRelay{}, nil
+}
+
+func (wtxidRelay *MsgWTxIDRelay) GetCommand() Command {
+	return WTxIDRelayCommand
+}
+
+func (wtxidRelay *MsgWTxIDRelay) Encode(writer io.Writer) error {
+	return nil
+}
+
+func (wtxidRelay *MsgWTxIDRelay) Decode(reader io.Reader) error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package filters
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Requester sends a request to the peer and waits for the answer, see
+// client.BTCClient.Request.
+type Requester interface {
+	Request(ctx context.Context, msg encoding.Message) (encoding.Message, error)
+}
+
+// Supported reports whether a peer with these services serves filters.
+func Supported(services encoding.Services) bool {
+	return services&encoding.ServicesNodeCompactFilters != 0
+}
+
+// Client downloads and verifies basic filters from a peer that signals
+// NODE_COMPACT_FILTERS (BIP157). Light wallets fetch the checkpoints, then
+// the filter headers between them, and finally the filters of the blocks
+// they want to scan.
+type Client struct {
+	peer Requester
+}
+
+func NewClient(peer Requester) *Client {
+	return &Client{peer: peer}
+}
+
+// Checkpoints returns the filter headers at every 1000 blocks up to stopHash.
+func (c *Client) Checkpoints(ctx context.Context, stopHash encoding.Hash) ([]encoding.Hash, error) {
+	getCFCheckpt, err := encoding.NewGetCFCheckptMsg(encoding.FilterTypeBasic, stopHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create getcfcheckpt message")
+	}
+	response, err := c.peer.Request(ctx, getCFCheckpt)
+	if err != nil {
+		return nil, fmt.Errorf("failed requesting filter checkpoints: %w", err)
+	}
+	cfCheckpt, ok := response.(*encoding.MsgCFCheckpt)
+	if !ok {
+		return nil, fmt.Errorf("unexpected getcfcheckpt response: %s", response.GetCommand())
+	}
+	return cfCheckpt.FilterHeaders, nil
+}
+
+// Headers requests the filter headers from startHeight up to stopHash, at
+// most 2000, and verifies them against prevHeader, the trusted header at
+// startHeight-1 (zero for the genesis block), and the checkpoints.
+func (c *Client) Headers(ctx context.Context, startHeight uint32, stopHash, prevHeader encoding.Hash, checkpoints []encoding.Hash) (*HeaderRange, error) {
+	getCFHeaders, err := encoding.NewGetCFHeadersMsg(encoding.FilterTypeBasic, startHeight, stopHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create getcfheaders message")
+	}
+	response, err := c.peer.Request(ctx, getCFHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("failed requesting filter headers from %d: %w", startHeight, err)
+	}
+	cfHeaders, ok := response.(*encoding.MsgCFHeaders)
+	if !ok {
+		return nil, fmt.Errorf("unexpected getcfheaders response: %s", response.GetCommand())
+	}
+	return VerifyHeaders(cfHeaders, startHeight, prevHeader, checkpoints)
+}
+
+// Filter requests the basic filter of the block at height and checks it
+// against the filter hash from a verified header range.
+func (c *Client) Filter(ctx context.Context, height uint32, blockHash, filterHash encoding.Hash) (*Filter, error) {
+	getCFilters, err := encoding.NewGetCFiltersMsg(encoding.FilterTypeBasic, height, blockHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create getcfilters message")
+	}
+	response, err := c.peer.Request(ctx, getCFilters)
+	if err != nil {
+		return nil, fmt.Errorf("failed requesting filter of %s: %w", blockHash, err)
+	}
+	cfilter, ok := response.(*encoding.MsgCFilter)
+	if !ok {
+		return nil, fmt.Errorf("unexpected getcfilters response: %s", response.GetCommand())
+	}
+	if hash := FilterHash(cfilter.Filter); hash != filterHash {
+		return nil, fmt.Errorf("%w: block %s filter hash is %s, expected %s", ErrFilterMismatch, blockHash, hash, filterHash)
+	}
+	return NewBasicFilter(blockHash, cfilter.Filter)
+}
@@ -0,0 +1,97 @@
+package filters
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Answers requests from a list of canned responses and records them.
+type fakePeer struct {
+	responses []encoding.Message
+	requests  []encoding.Message
+}
+
+func (p *fakePeer) Request(_ context.Context, msg encoding.Message) (encoding.Message, error) {
+	p.requests = append(p.requests, msg)
+	if len(p.responses) == 0 {
+		return nil, context.DeadlineExceeded
+	}
+	response := p.responses[0]
+	p.responses = p.responses[1:]
+	return response, nil
+}
+
+// Filters and headers for a chain of count blocks.
+func testChain(count int) (filters [][]byte, filterHashes, headers []encoding.Hash) {
+	var prev encoding.Hash
+	for i := range count {
+		blockHash := encoding.Hash{byte(i), byte(i >> 8)}
+		filter := BuildFilter(BasicP, BasicM, blockHash, [][]byte{{byte(i)}, {0x51}})
+		filters = append(filters, filter)
+		filterHashes = append(filterHashes, FilterHash(filter))
+		prev = FilterHeader(FilterHash(filter), prev)
+		headers = append(headers, prev)
+	}
+	return filters, filterHashes, headers
+}
+
+func Test_Client_Sync(t *testing.T) {
+	filters, filterHashes, headers := testChain(2001)
+	stop := encoding.Hash{0xd1, 0x07}
+	peer := &fakePeer{responses: []encoding.Message{
+		&encoding.MsgCFCheckpt{StopHash: stop, FilterHeaders: []encoding.Hash{headers[1000], headers[2000]}},
+		&encoding.MsgCFHeaders{StopHash: stop, FilterHashes: filterHashes},
+		&encoding.MsgCFilter{BlockHash: encoding.Hash{0xe8, 0x03}, Filter: filters[1000]},
+	}}
+	client := NewClient(peer)
+	ctx := context.Background()
+
+	checkpoints, err := client.Checkpoints(ctx, stop)
+	require.NoError(t, err)
+	assert.Len(t, checkpoints, 2)
+
+	headerRange, err := client.Headers(ctx, 0, stop, encoding.Hash{}, checkpoints)
+	require.NoError(t, err)
+	assert.Equal(t, headers[2000], headerRange.Last())
+	filterHash, ok := headerRange.FilterHash(1000)
+	require.True(t, ok)
+
+	filter, err := client.Filter(ctx, 1000, encoding.Hash{0xe8, 0x03}, filterHash)
+	require.NoError(t, err)
+	match, err := filter.Match([]byte{0xe8})
+	require.NoError(t, err)
+	assert.True(t, match)
+
+	assert.Equal(t, &encoding.MsgGetCFCheckpt{StopHash: stop}, peer.requests[0])
+	assert.Equal(t, &encoding.MsgGetCFHeaders{StopHash: stop}, peer.requests[1])
+	assert.Equal(t, &encoding.MsgGetCFilters{StartHeight: 1000, StopHash: encoding.Hash{0xe8, 0x03}}, peer.requests[2])
+}
+
+func Test_VerifyHeaders_Mismatch(t *testing.T) {
+	_, filterHashes, headers := testChain(1500)
+	cfHeaders := &encoding.MsgCFHeaders{FilterHashes: filterHashes}
+
+	_, err := VerifyHeaders(cfHeaders, 0, encoding.Hash{}, []encoding.Hash{headers[999]})
+	assert.ErrorIs(t, err, ErrCheckpointMismatch)
+
+	_, err = VerifyHeaders(cfHeaders, 0, encoding.Hash{1}, nil)
+	assert.ErrorIs(t, err, ErrCheckpointMismatch)
+
+	// Checkpoints past the range aren't checked.
+	headerRange, err := VerifyHeaders(cfHeaders, 0, encoding.Hash{}, []encoding.Hash{headers[1000], {1}})
+	require.NoError(t, err)
+	assert.Equal(t, headers, headerRange.Headers)
+}
+
+func Test_Client_Filter_Mismatch(t *testing.T) {
+	peer := &fakePeer{responses: []encoding.Message{
+		&encoding.MsgCFilter{BlockHash: encoding.Hash{1}, Filter: encoding.VarBytes{0x00}},
+	}}
+	_, err := NewClient(peer).Filter(context.Background(), 1, encoding.Hash{1}, encoding.Hash{2})
+	assert.ErrorIs(t, err, ErrFilterMismatch)
+}
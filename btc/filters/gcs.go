@@ -0,0 +1,219 @@
+package filters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"slices"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Parameters of the BIP158 basic filter.
+const (
+	BasicP = 19
+	BasicM = 784931
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter is a Golomb-coded set (BIP158). Items are hashed with SipHash into
+// the range [0, N*M) and the sorted values are stored as Golomb-Rice coded
+// differences.
+type Filter struct {
+	n      uint64
+	p      uint8
+	m      uint64
+	k0, k1 uint64
+	// The coded values without the leading N.
+	data []byte
+}
+
+// The SipHash key is the first 16 bytes of the block hash.
+func filterKey(blockHash encoding.Hash) (uint64, uint64) {
+	return binary.LittleEndian.Uint64(blockHash[0:8]), binary.LittleEndian.Uint64(blockHash[8:16])
+}
+
+// NewFilter parses a serialized filter: the number of items as a CompactSize
+// followed by the coded values.
+func NewFilter(p uint8, m uint64, blockHash encoding.Hash, raw []byte) (*Filter, error) {
+	reader := bytes.NewReader(raw)
+	var n encoding.VarInt
+	err := n.Decode(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad item count: %w", ErrInvalidFilter, err)
+	}
+	data := raw[len(raw)-reader.Len():]
+	// Each item takes at least p+1 bits.
+	if uint64(n) > uint64(len(data))*8/(uint64(p)+1) {
+		return nil, fmt.Errorf("%w: %d items don't fit in %d bytes", ErrInvalidFilter, n, len(data))
+	}
+	k0, k1 := filterKey(blockHash)
+	return &Filter{n: uint64(n), p: p, m: m, k0: k0, k1: k1, data: data}, nil
+}
+
+// NewBasicFilter parses the basic filter of the block.
+func NewBasicFilter(blockHash encoding.Hash, raw []byte) (*Filter, error) {
+	return NewFilter(BasicP, BasicM, blockHash, raw)
+}
+
+// BuildFilter creates the serialized filter of the items, e.g. the output
+// scripts of a block for the basic filter.
+func BuildFilter(p uint8, m uint64, blockHash encoding.Hash, items [][]byte) []byte {
+	k0, k1 := filterKey(blockHash)
+	unique := map[string]bool{}
+	for _, item := range items {
+		unique[string(item)] = true
+	}
+	n := uint64(len(unique))
+	values := make([]uint64, 0, n)
+	for item := range unique {
+		values = append(values, hashToRange(k0, k1, n*m, []byte(item)))
+	}
+	slices.Sort(values)
+
+	buf := &bytes.Buffer{}
+	count := encoding.VarInt(n)
+	_ = count.Encode(buf)
+	writer := bitWriter{buf: buf}
+	var last uint64
+	for _, value := range values {
+		delta := value - last
+		last = value
+		for range delta >> p {
+			writer.writeBit(1)
+		}
+		writer.writeBit(0)
+		writer.writeBits(delta, p)
+	}
+	writer.flush()
+	return buf.Bytes()
+}
+
+// N returns the number of items in the filter.
+func (f *Filter) N() uint64 {
+	return f.n
+}
+
+// Match reports whether the item may be in the filter. False positives
+// happen with probability 1/M.
+func (f *Filter) Match(item []byte) (bool, error) {
+	return f.MatchAny([][]byte{item})
+}
+
+// MatchAny reports whether any of the items may be in the filter, walking the
+// filter once for all of them.
+func (f *Filter) MatchAny(items [][]byte) (bool, error) {
+	if f.n == 0 || len(items) == 0 {
+		return false, nil
+	}
+	targets := make([]uint64, len(items))
+	for i, item := range items {
+		targets[i] = hashToRange(f.k0, f.k1, f.n*f.m, item)
+	}
+	slices.Sort(targets)
+
+	reader := bitReader{data: f.data}
+	var value uint64
+	for range f.n {
+		delta, err := f.readValue(&reader)
+		if err != nil {
+			return false, err
+		}
+		value += delta
+		for len(targets) > 0 && targets[0] < value {
+			targets = targets[1:]
+		}
+		if len(targets) == 0 {
+			return false, nil
+		}
+		if targets[0] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *Filter) readValue(reader *bitReader) (uint64, error) {
+	var quotient uint64
+	for {
+		bit, err := reader.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 0 {
+			break
+		}
+		quotient++
+	}
+	remainder, err := reader.readBits(f.p)
+	if err != nil {
+		return 0, err
+	}
+	return quotient<<f.p | remainder, nil
+}
+
+// Maps the SipHash of the item uniformly to [0, f) with a 128 bit multiply
+// instead of a modulo.
+func hashToRange(k0, k1, f uint64, item []byte) uint64 {
+	hi, _ := bits.Mul64(encoding.SipHash24(k0, k1, item), f)
+	return hi
+}
+
+// Bits are written most significant first.
+type bitWriter struct {
+	buf     *bytes.Buffer
+	current byte
+	used    uint8
+}
+
+func (w *bitWriter) writeBit(bit uint64) {
+	w.current = w.current<<1 | byte(bit&1)
+	w.used++
+	if w.used == 8 {
+		w.buf.WriteByte(w.current)
+		w.current, w.used = 0, 0
+	}
+}
+
+func (w *bitWriter) writeBits(value uint64, count uint8) {
+	for i := int(count) - 1; i >= 0; i-- {
+		w.writeBit(value >> i)
+	}
+}
+
+func (w *bitWriter) flush() {
+	if w.used > 0 {
+		w.buf.WriteByte(w.current << (8 - w.used))
+		w.current, w.used = 0, 0
+	}
+}
+
+type bitReader struct {
+	data []byte
+	pos  uint64
+}
+
+func (r *bitReader) readBit() (uint64, error) {
+	if r.pos >= uint64(len(r.data))*8 {
+		return 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidFilter)
+	}
+	bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+	r.pos++
+	return uint64(bit), nil
+}
+
+func (r *bitReader) readBits(count uint8) (uint64, error) {
+	var value uint64
+	for range count {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<1 | bit
+	}
+	return value, nil
+}
@@ -0,0 +1,91 @@
+package filters
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// The output script of the genesis coinbase, the only item of the genesis
+// block basic filter.
+const genesisPkScript = "4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac"
+
+func mustHash(t *testing.T, s string) encoding.Hash {
+	t.Helper()
+	hash, err := encoding.NewHashFromString(s)
+	require.NoError(t, err)
+	return hash
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// Testnet3 genesis block from the BIP158 test vectors.
+func Test_BasicFilter_TestVector(t *testing.T) {
+	blockHash := mustHash(t, "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943")
+	pkScript := mustHex(t, genesisPkScript)
+
+	raw := BuildFilter(BasicP, BasicM, blockHash, [][]byte{pkScript})
+	assert.Equal(t, "019dfca8", hex.EncodeToString(raw))
+
+	header := FilterHeader(FilterHash(raw), encoding.Hash{})
+	assert.Equal(t, "21584579b7eb08997773e5aeff3a7f932700042d0ed2a6129012b7d7ae81b750", header.String())
+
+	filter, err := NewBasicFilter(blockHash, raw)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), filter.N())
+	match, err := filter.Match(pkScript)
+	require.NoError(t, err)
+	assert.True(t, match)
+	match, err = filter.Match([]byte{0x51})
+	require.NoError(t, err)
+	assert.False(t, match)
+}
+
+func Test_Filter_MatchAny(t *testing.T) {
+	blockHash := encoding.Hash{1, 2, 3}
+	var items [][]byte
+	for i := range 100 {
+		items = append(items, []byte(fmt.Sprintf("script %d", i)))
+	}
+	filter, err := NewBasicFilter(blockHash, BuildFilter(BasicP, BasicM, blockHash, items))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), filter.N())
+
+	for _, item := range items {
+		match, err := filter.Match(item)
+		require.NoError(t, err)
+		assert.True(t, match, string(item))
+	}
+
+	match, err := filter.MatchAny([][]byte{[]byte("other"), []byte("script 42")})
+	require.NoError(t, err)
+	assert.True(t, match)
+	match, err = filter.MatchAny([][]byte{[]byte("other"), []byte("another")})
+	require.NoError(t, err)
+	assert.False(t, match)
+}
+
+func Test_Filter_Invalid(t *testing.T) {
+	_, err := NewBasicFilter(encoding.Hash{}, nil)
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+
+	// Claims more items than the data can hold.
+	_, err = NewBasicFilter(encoding.Hash{}, []byte{0x05, 0xff})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+
+	// A quotient that runs past the end.
+	filter, err := NewBasicFilter(encoding.Hash{}, []byte{0x01, 0xff, 0xff, 0xff})
+	require.NoError(t, err)
+	_, err = filter.Match([]byte{1})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
@@ -0,0 +1,79 @@
+package filters
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+var (
+	ErrFilterMismatch     = errors.New("filter does not match its filter hash")
+	ErrCheckpointMismatch = errors.New("filter headers don't match checkpoint")
+)
+
+// FilterHash returns the double SHA-256 of a serialized filter.
+func FilterHash(filter []byte) encoding.Hash {
+	return encoding.DoubleSHA256(filter)
+}
+
+// FilterHeader commits to a filter and all filters before it:
+// double SHA-256 of the filter hash and the previous filter header.
+func FilterHeader(filterHash, prevHeader encoding.Hash) encoding.Hash {
+	return encoding.DoubleSHA256(append(filterHash[:], prevHeader[:]...))
+}
+
+// HeaderRange is a verified run of filter headers starting at StartHeight.
+type HeaderRange struct {
+	StartHeight  uint32
+	FilterHashes []encoding.Hash
+	Headers      []encoding.Hash
+}
+
+// FilterHash returns the filter hash of the block at height, if it is in the
+// range.
+func (r *HeaderRange) FilterHash(height uint32) (encoding.Hash, bool) {
+	if height < r.StartHeight || height-r.StartHeight >= uint32(len(r.FilterHashes)) {
+		return encoding.Hash{}, false
+	}
+	return r.FilterHashes[height-r.StartHeight], true
+}
+
+// Last returns the header of the last block in the range, the previous header
+// of the next range.
+func (r *HeaderRange) Last() encoding.Hash {
+	if len(r.Headers) == 0 {
+		return encoding.Hash{}
+	}
+	return r.Headers[len(r.Headers)-1]
+}
+
+// VerifyHeaders computes the filter headers of a cfheaders message starting
+// at startHeight and checks them against the previous header we already
+// trust and the cfcheckpt headers, of which checkpoints[i] is at height
+// (i+1)*CFCheckptInterval.
+func VerifyHeaders(cfHeaders *encoding.MsgCFHeaders, startHeight uint32, prevHeader encoding.Hash, checkpoints []encoding.Hash) (*HeaderRange, error) {
+	if cfHeaders.PreviousFilterHeader != prevHeader {
+		return nil, fmt.Errorf("%w: previous header at height %d is %s, expected %s",
+			ErrCheckpointMismatch, startHeight, cfHeaders.PreviousFilterHeader, prevHeader)
+	}
+
+	headers := make([]encoding.Hash, len(cfHeaders.FilterHashes))
+	prev := prevHeader
+	for i, filterHash := range cfHeaders.FilterHashes {
+		headers[i] = FilterHeader(filterHash, prev)
+		prev = headers[i]
+
+		height := startHeight + uint32(i)
+		if height == 0 || height%encoding.CFCheckptInterval != 0 {
+			continue
+		}
+		index := int(height/encoding.CFCheckptInterval) - 1
+		if index < len(checkpoints) && checkpoints[index] != headers[i] {
+			return nil, fmt.Errorf("%w: header at height %d is %s, checkpoint is %s",
+				ErrCheckpointMismatch, height, headers[i], checkpoints[index])
+		}
+	}
+	return &HeaderRange{StartHeight: startHeight, FilterHashes: cfHeaders.FilterHashes, Headers: headers}, nil
+}
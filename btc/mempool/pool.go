@@ -0,0 +1,125 @@
+package mempool
+
+import (
+	"container/list"
+	"sync"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+type entry struct {
+	tx    *encoding.MsgTx
+	txid  encoding.Hash
+	wtxid encoding.Hash
+}
+
+// Pool is a bounded in-memory set of unconfirmed transactions, looked up by
+// txid or wtxid. When it is full the oldest transaction is evicted. It is
+// safe for concurrent use and can serve compact block reconstruction.
+type Pool struct {
+	mu      sync.RWMutex
+	maxSize int
+	byTxid  map[encoding.Hash]*list.Element
+	byWtxid map[encoding.Hash]*list.Element
+	// Oldest first.
+	order *list.List
+}
+
+func NewPool(maxSize int) *Pool {
+	return &Pool{
+		maxSize: max(maxSize, 1),
+		byTxid:  map[encoding.Hash]*list.Element{},
+		byWtxid: map[encoding.Hash]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Add stores the transaction, evicting the oldest ones if the pool is full.
+// It returns false if the transaction is already in the pool.
+func (p *Pool) Add(tx *encoding.MsgTx) bool {
+	txid := tx.TxHash()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.byTxid[txid]; ok {
+		return false
+	}
+	for p.order.Len() >= p.maxSize {
+		p.remove(p.order.Front())
+	}
+	element := p.order.PushBack(&entry{tx: tx, txid: txid, wtxid: tx.WitnessHash()})
+	p.byTxid[txid] = element
+	p.byWtxid[element.Value.(*entry).wtxid] = element
+	return true
+}
+
+// Get looks a transaction up by txid.
+func (p *Pool) Get(txid encoding.Hash) (*encoding.MsgTx, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	element, ok := p.byTxid[txid]
+	if !ok {
+		return nil, false
+	}
+	return element.Value.(*entry).tx, true
+}
+
+// GetByWitnessHash looks a transaction up by wtxid.
+func (p *Pool) GetByWitnessHash(wtxid encoding.Hash) (*encoding.MsgTx, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	element, ok := p.byWtxid[wtxid]
+	if !ok {
+		return nil, false
+	}
+	return element.Value.(*entry).tx, true
+}
+
+// Remove drops the transaction with the txid, reporting whether it was there.
+func (p *Pool) Remove(txid encoding.Hash) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	element, ok := p.byTxid[txid]
+	if ok {
+		p.remove(element)
+	}
+	return ok
+}
+
+// RemoveBlock drops the transactions confirmed by the block and returns how
+// many were in the pool.
+func (p *Pool) RemoveBlock(block *encoding.MsgBlock) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	removed := 0
+	for i := range block.Transactions {
+		element, ok := p.byTxid[block.Transactions[i].TxHash()]
+		if ok {
+			p.remove(element)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (p *Pool) remove(element *list.Element) {
+	e := p.order.Remove(element).(*entry)
+	delete(p.byTxid, e.txid)
+	delete(p.byWtxid, e.wtxid)
+}
+
+func (p *Pool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.order.Len()
+}
+
+// Transactions returns the pooled transactions, oldest first.
+func (p *Pool) Transactions() []*encoding.MsgTx {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	txs := make([]*encoding.MsgTx, 0, p.order.Len())
+	for element := p.order.Front(); element != nil; element = element.Next() {
+		txs = append(txs, element.Value.(*entry).tx)
+	}
+	return txs
+}
@@ -0,0 +1,84 @@
+package mempool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+func testTx(i int, witness bool) *encoding.MsgTx {
+	tx := &encoding.MsgTx{
+		Version: 2,
+		TxIn: []encoding.TxIn{{
+			PreviousOutPoint: encoding.OutPoint{Hash: encoding.Hash{byte(i), byte(i >> 8)}},
+			Sequence:         0xffffffff,
+		}},
+		TxOut: []encoding.TxOut{{Value: encoding.UInt64(i), PkScript: encoding.VarBytes{0x51}}},
+	}
+	if witness {
+		tx.TxIn[0].Witness = encoding.TxWitness{{1, 2, 3}}
+	}
+	return tx
+}
+
+func Test_Pool_AddGet(t *testing.T) {
+	pool := NewPool(10)
+	tx := testTx(1, true)
+	require.NotEqual(t, tx.TxHash(), tx.WitnessHash())
+
+	assert.True(t, pool.Add(tx))
+	assert.False(t, pool.Add(tx))
+	assert.Equal(t, 1, pool.Len())
+
+	got, ok := pool.Get(tx.TxHash())
+	assert.True(t, ok)
+	assert.Same(t, tx, got)
+	got, ok = pool.GetByWitnessHash(tx.WitnessHash())
+	assert.True(t, ok)
+	assert.Same(t, tx, got)
+	_, ok = pool.GetByWitnessHash(tx.TxHash())
+	assert.False(t, ok)
+
+	assert.True(t, pool.Remove(tx.TxHash()))
+	assert.False(t, pool.Remove(tx.TxHash()))
+	_, ok = pool.GetByWitnessHash(tx.WitnessHash())
+	assert.False(t, ok)
+	assert.Equal(t, 0, pool.Len())
+}
+
+func Test_Pool_Eviction(t *testing.T) {
+	pool := NewPool(3)
+	for i := range 5 {
+		pool.Add(testTx(i, i%2 == 0))
+	}
+	assert.Equal(t, 3, pool.Len())
+
+	for i := range 5 {
+		_, ok := pool.Get(testTx(i, i%2 == 0).TxHash())
+		assert.Equal(t, i >= 2, ok, "tx %d", i)
+	}
+	_, ok := pool.GetByWitnessHash(testTx(0, true).WitnessHash())
+	assert.False(t, ok)
+
+	txs := pool.Transactions()
+	require.Len(t, txs, 3)
+	assert.Equal(t, testTx(2, true).TxHash(), txs[0].TxHash())
+}
+
+func Test_Pool_RemoveBlock(t *testing.T) {
+	pool := NewPool(10)
+	for i := range 4 {
+		pool.Add(testTx(i, false))
+	}
+	block := &encoding.MsgBlock{Transactions: []encoding.MsgTx{*testTx(1, false), *testTx(3, false), *testTx(9, false)}}
+
+	assert.Equal(t, 2, pool.RemoveBlock(block))
+	assert.Equal(t, 2, pool.Len())
+	_, ok := pool.Get(testTx(1, false).TxHash())
+	assert.False(t, ok)
+	_, ok = pool.Get(testTx(2, false).TxHash())
+	assert.True(t, ok)
+}
@@ -0,0 +1,179 @@
+package mempool
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+var ErrMempoolNotServed = errors.New("peer does not serve its mempool")
+
+// Sender queues a message for a peer, see client.BTCClient.Send.
+type Sender interface {
+	Send(ctx context.Context, msg encoding.Message) error
+}
+
+// Watcher fills a Pool with the unconfirmed transactions peers announce. It
+// is fed the messages received from the peers: inv announcements are
+// answered with getdata for the transactions we haven't seen, the tx answers
+// go into the pool and blocks remove the transactions they confirm.
+type Watcher struct {
+	log  *slog.Logger
+	pool *Pool
+	// How long to wait for a requested transaction before asking again.
+	requestTimeout time.Duration
+	now            func() time.Time
+
+	mu sync.Mutex
+	// Announced txids and wtxids we asked for and when.
+	requested map[encoding.Hash]time.Time
+	// The same requests oldest first, so expiring them doesn't scan the map.
+	// Answered ones stay until they would have expired.
+	requestOrder []request
+}
+
+type request struct {
+	hash encoding.Hash
+	at   time.Time
+}
+
+func NewWatcher(log *slog.Logger, pool *Pool, requestTimeout time.Duration) *Watcher {
+	return &Watcher{
+		log:            log,
+		pool:           pool,
+		requestTimeout: requestTimeout,
+		now:            time.Now,
+		requested:      map[encoding.Hash]time.Time{},
+	}
+}
+
+func (w *Watcher) Pool() *Pool {
+	return w.pool
+}
+
+// RequestMempool asks the peer to announce all transactions in its mempool.
+// Bitcoin Core disconnects peers sending mempool unless it serves bloom
+// filters, so we only ask peers signaling NODE_BLOOM.
+func (w *Watcher) RequestMempool(ctx context.Context, peer Sender, services encoding.Services) error {
+	if services&encoding.ServicesNodeBloom == 0 {
+		return ErrMempoolNotServed
+	}
+	mempool, err := encoding.NewMempoolMsg()
+	if err != nil {
+		return errors.Wrap(err, "failed to create mempool message")
+	}
+	return peer.Send(ctx, mempool)
+}
+
+// HandleMessage updates the pool from a message the peer sent.
+func (w *Watcher) HandleMessage(ctx context.Context, peer Sender, msg encoding.Message) error {
+	switch msg := msg.(type) {
+	case *encoding.MsgInv:
+		return w.fetch(ctx, peer, msg.Inventory)
+	case *encoding.MsgTx:
+		w.addTx(msg)
+	case *encoding.MsgNotFound:
+		w.mu.Lock()
+		for _, vect := range msg.Inventory {
+			delete(w.requested, vect.Hash)
+		}
+		w.mu.Unlock()
+	case *encoding.MsgBlock:
+		w.RemoveBlock(msg)
+	}
+	return nil
+}
+
+// RemoveBlock drops the transactions confirmed by the block, e.g. one
+// reconstructed from a compact block.
+func (w *Watcher) RemoveBlock(block *encoding.MsgBlock) {
+	removed := w.pool.RemoveBlock(block)
+	w.log.Debug("removed confirmed transactions from pool", "hash", block.BlockHash().String(),
+		"removed", removed, "pool_size", w.pool.Len())
+}
+
+func (w *Watcher) addTx(tx *encoding.MsgTx) {
+	txid, wtxid := tx.TxHash(), tx.WitnessHash()
+	w.mu.Lock()
+	delete(w.requested, txid)
+	delete(w.requested, wtxid)
+	w.mu.Unlock()
+	if w.pool.Add(tx) {
+		w.log.Debug("added transaction to pool", "txid", txid.String(), "pool_size", w.pool.Len())
+	}
+}
+
+// Requests the announced transactions that are neither in the pool nor
+// already requested.
+func (w *Watcher) fetch(ctx context.Context, peer Sender, inventory []encoding.InvVect) error {
+	now := w.now()
+	var wanted []encoding.InvVect
+	w.mu.Lock()
+	w.expireRequests(now)
+	for _, vect := range inventory {
+		var getData encoding.InvVect
+		switch vect.Type &^ encoding.InvWitnessFlag {
+		case encoding.InvTypeTx:
+			if _, ok := w.pool.Get(vect.Hash); ok {
+				continue
+			}
+			// Ask for the witness too, BIP144.
+			getData = encoding.InvVect{Type: encoding.InvTypeWitnessTx, Hash: vect.Hash}
+		case encoding.InvTypeWTx:
+			if _, ok := w.pool.GetByWitnessHash(vect.Hash); ok {
+				continue
+			}
+			getData = encoding.InvVect{Type: encoding.InvTypeWTx, Hash: vect.Hash}
+		default:
+			continue
+		}
+		if _, ok := w.requested[vect.Hash]; ok {
+			continue
+		}
+		w.requested[vect.Hash] = now
+		if w.requestTimeout > 0 {
+			w.requestOrder = append(w.requestOrder, request{hash: vect.Hash, at: now})
+		}
+		wanted = append(wanted, getData)
+	}
+	w.mu.Unlock()
+
+	for start := 0; start < len(wanted); start += encoding.MaxInvEntries {
+		batch := wanted[start:min(start+encoding.MaxInvEntries, len(wanted))]
+		getData, err := encoding.NewGetDataMsg(batch)
+		if err != nil {
+			return errors.Wrap(err, "failed to create getdata message")
+		}
+		err = peer.Send(ctx, getData)
+		if err != nil {
+			return fmt.Errorf("failed requesting %d transactions: %w", len(batch), err)
+		}
+	}
+	return nil
+}
+
+// Forgets requests the peer never answered so the next announcement asks
+// again. A zero timeout keeps them until they are answered.
+func (w *Watcher) expireRequests(now time.Time) {
+	if w.requestTimeout <= 0 {
+		return
+	}
+	expired := 0
+	for _, r := range w.requestOrder {
+		if now.Sub(r.at) <= w.requestTimeout {
+			break
+		}
+		// Unless it was answered and requested again since.
+		if at, ok := w.requested[r.hash]; ok && at.Equal(r.at) {
+			delete(w.requested, r.hash)
+		}
+		expired++
+	}
+	w.requestOrder = w.requestOrder[expired:]
+}
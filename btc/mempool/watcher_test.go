@@ -0,0 +1,91 @@
+package mempool
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// Records the messages sent to it.
+type fakePeer struct {
+	sent []encoding.Message
+}
+
+func (p *fakePeer) Send(_ context.Context, msg encoding.Message) error {
+	p.sent = append(p.sent, msg)
+	return nil
+}
+
+func Test_Watcher_RequestMempool(t *testing.T) {
+	watcher := NewWatcher(slog.Default(), NewPool(10), time.Minute)
+	peer := &fakePeer{}
+
+	err := watcher.RequestMempool(context.Background(), peer, encoding.ServicesNodeNetwork)
+	assert.ErrorIs(t, err, ErrMempoolNotServed)
+	assert.Empty(t, peer.sent)
+
+	err = watcher.RequestMempool(context.Background(), peer, encoding.ServicesNodeNetwork|encoding.ServicesNodeBloom)
+	require.NoError(t, err)
+	assert.Equal(t, []encoding.Message{&encoding.MsgMempool{}}, peer.sent)
+}
+
+func Test_Watcher_FollowsAnnouncements(t *testing.T) {
+	ctx := context.Background()
+	watcher := NewWatcher(slog.Default(), NewPool(10), time.Minute)
+	peer := &fakePeer{}
+	known, byTxid, byWtxid := testTx(1, false), testTx(2, false), testTx(3, true)
+	watcher.Pool().Add(known)
+
+	inv := &encoding.MsgInv{Inventory: []encoding.InvVect{
+		{Type: encoding.InvTypeTx, Hash: known.TxHash()},
+		{Type: encoding.InvTypeTx, Hash: byTxid.TxHash()},
+		{Type: encoding.InvTypeWTx, Hash: byWtxid.WitnessHash()},
+		{Type: encoding.InvTypeBlock, Hash: encoding.Hash{1}},
+	}}
+	require.NoError(t, watcher.HandleMessage(ctx, peer, inv))
+	require.Len(t, peer.sent, 1)
+	assert.Equal(t, &encoding.MsgGetData{Inventory: []encoding.InvVect{
+		{Type: encoding.InvTypeWitnessTx, Hash: byTxid.TxHash()},
+		{Type: encoding.InvTypeWTx, Hash: byWtxid.WitnessHash()},
+	}}, peer.sent[0])
+
+	// Announcements from other peers don't trigger another request.
+	require.NoError(t, watcher.HandleMessage(ctx, peer, inv))
+	assert.Len(t, peer.sent, 1)
+
+	require.NoError(t, watcher.HandleMessage(ctx, peer, byTxid))
+	require.NoError(t, watcher.HandleMessage(ctx, peer, byWtxid))
+	assert.Equal(t, 3, watcher.Pool().Len())
+
+	block := &encoding.MsgBlock{Transactions: []encoding.MsgTx{*known, *byWtxid}}
+	require.NoError(t, watcher.HandleMessage(ctx, peer, block))
+	assert.Equal(t, 1, watcher.Pool().Len())
+	_, ok := watcher.Pool().Get(byTxid.TxHash())
+	assert.True(t, ok)
+}
+
+func Test_Watcher_RequestsAgain(t *testing.T) {
+	ctx := context.Background()
+	watcher := NewWatcher(slog.Default(), NewPool(10), time.Minute)
+	peer := &fakePeer{}
+	inv := &encoding.MsgInv{Inventory: []encoding.InvVect{{Type: encoding.InvTypeTx, Hash: encoding.Hash{1}}}}
+
+	require.NoError(t, watcher.HandleMessage(ctx, peer, inv))
+	require.NoError(t, watcher.HandleMessage(ctx, peer, &encoding.MsgNotFound{Inventory: inv.Inventory}))
+	require.NoError(t, watcher.HandleMessage(ctx, peer, inv))
+	assert.Len(t, peer.sent, 2)
+
+	// Unanswered requests expire.
+	watcher.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	require.NoError(t, watcher.HandleMessage(ctx, peer, inv))
+	assert.Len(t, peer.sent, 3)
+	require.NoError(t, watcher.HandleMessage(ctx, peer, inv))
+	assert.Len(t, peer.sent, 3, "the new request doesn't expire with the old one")
+	assert.Len(t, watcher.requestOrder, 1)
+}
@@ -0,0 +1,105 @@
+package peers
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"deshev.com/bitcoin-handshake/config"
+)
+
+// CircuitState is the circuit breaker state of a peer address. After too
+// many failed attempts in a row the circuit opens and we leave the address
+// alone for a cooldown. Then it goes half open and a single attempt decides
+// whether it closes again or stays open for another cooldown.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// Reconnect policy of a single address: exponential backoff with jitter
+// between attempts and a circuit breaker on top.
+type backoff struct {
+	minDelay    time.Duration
+	maxDelay    time.Duration
+	jitter      float64
+	maxAttempts int
+	cooldown    time.Duration
+
+	failures int
+	state    CircuitState
+	next     time.Time
+}
+
+func newBackoff(cfg *config.Config) *backoff {
+	return &backoff{
+		minDelay:    cfg.ReconnectMinDelay,
+		maxDelay:    cfg.ReconnectMaxDelay,
+		jitter:      cfg.ReconnectJitter,
+		maxAttempts: cfg.ReconnectMaxAttempts,
+		cooldown:    cfg.CircuitBreakerCooldown,
+	}
+}
+
+// Reports whether we can dial the address now. An open circuit goes half
+// open once its cooldown is over.
+func (b *backoff) ready(now time.Time) bool {
+	if now.Before(b.next) {
+		return false
+	}
+	if b.state == CircuitOpen {
+		b.state = CircuitHalfOpen
+	}
+	return true
+}
+
+func (b *backoff) success() {
+	b.failures = 0
+	b.state = CircuitClosed
+	b.next = time.Time{}
+}
+
+// Records a failed attempt and returns how long to wait before the next one.
+// A zero max attempts never opens the circuit.
+func (b *backoff) failure(now time.Time) time.Duration {
+	b.failures++
+	if b.state == CircuitHalfOpen || (b.maxAttempts > 0 && b.failures >= b.maxAttempts) {
+		b.state = CircuitOpen
+		b.next = now.Add(b.cooldown)
+		return b.cooldown
+	}
+	delay := b.delay(b.failures)
+	b.next = now.Add(delay)
+	return delay
+}
+
+// Doubles the delay with every attempt up to the max delay and spreads it
+// by the jitter fraction in both directions.
+func (b *backoff) delay(attempt int) time.Duration {
+	delay := b.minDelay
+	for i := 1; i < attempt && delay < b.maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, b.maxDelay)
+	if b.jitter > 0 {
+		spread := (rand.Float64()*2 - 1) * b.jitter //nolint:gosec // not a crypto random
+		delay += time.Duration(spread * float64(delay))
+	}
+	return delay
+}
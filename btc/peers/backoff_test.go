@@ -0,0 +1,71 @@
+package peers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Backoff_Delay(t *testing.T) {
+	b := &backoff{minDelay: time.Second, maxDelay: 5 * time.Second}
+
+	var delays []time.Duration
+	for attempt := 1; attempt <= 5; attempt++ {
+		delays = append(delays, b.delay(attempt))
+	}
+	assert.Equal(t, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second,
+	}, delays)
+	assert.Equal(t, 5*time.Second, b.delay(1000))
+}
+
+func Test_Backoff_Jitter(t *testing.T) {
+	b := &backoff{minDelay: time.Second, maxDelay: time.Minute, jitter: 0.2}
+	for range 100 {
+		delay := b.delay(2)
+		assert.GreaterOrEqual(t, delay, 1600*time.Millisecond)
+		assert.LessOrEqual(t, delay, 2400*time.Millisecond)
+	}
+}
+
+func Test_Backoff_Circuit(t *testing.T) {
+	b := &backoff{minDelay: time.Second, maxDelay: time.Minute, maxAttempts: 3, cooldown: 10 * time.Minute}
+	now := time.Now()
+
+	assert.True(t, b.ready(now))
+	assert.Equal(t, time.Second, b.failure(now))
+	assert.False(t, b.ready(now))
+	assert.True(t, b.ready(now.Add(time.Second)))
+	assert.Equal(t, 2*time.Second, b.failure(now))
+	assert.Equal(t, CircuitClosed, b.state)
+
+	// The third failure in a row opens the circuit for the cooldown.
+	assert.Equal(t, 10*time.Minute, b.failure(now))
+	assert.Equal(t, CircuitOpen, b.state)
+	assert.False(t, b.ready(now.Add(5*time.Minute)))
+	assert.Equal(t, CircuitOpen, b.state)
+
+	assert.True(t, b.ready(now.Add(10*time.Minute)))
+	assert.Equal(t, CircuitHalfOpen, b.state)
+
+	// A failed trial opens it right away, a good one closes it.
+	now = now.Add(10 * time.Minute)
+	assert.Equal(t, 10*time.Minute, b.failure(now))
+	assert.Equal(t, CircuitOpen, b.state)
+	assert.True(t, b.ready(now.Add(10*time.Minute)))
+	b.success()
+	assert.Equal(t, CircuitClosed, b.state)
+	assert.Zero(t, b.failures)
+	assert.True(t, b.ready(now))
+}
+
+func Test_Backoff_Unlimited(t *testing.T) {
+	b := &backoff{minDelay: time.Second, maxDelay: time.Minute}
+	now := time.Now()
+	for range 100 {
+		b.failure(now)
+	}
+	assert.Equal(t, CircuitClosed, b.state)
+	assert.Equal(t, time.Minute, b.failure(now))
+}
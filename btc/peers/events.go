@@ -0,0 +1,63 @@
+package peers
+
+import (
+	"fmt"
+	"time"
+)
+
+type EventType int
+
+const (
+	EventConnecting EventType = iota
+	EventConnected
+	EventDisconnected
+	EventRetryScheduled
+	EventCircuitOpen
+	EventCircuitHalfOpen
+	EventCircuitClosed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnecting:
+		return "connecting"
+	case EventConnected:
+		return "connected"
+	case EventDisconnected:
+		return "disconnected"
+	case EventRetryScheduled:
+		return "retry_scheduled"
+	case EventCircuitOpen:
+		return "circuit_open"
+	case EventCircuitHalfOpen:
+		return "circuit_half_open"
+	case EventCircuitClosed:
+		return "circuit_closed"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(t))
+	}
+}
+
+// Event reports connection attempts and their outcome for a peer address.
+// Peer is zero for events that don't belong to a connected peer.
+type Event struct {
+	Type    EventType
+	Peer    PeerID
+	Address string
+	// Consecutive failed attempts for the address.
+	Attempt int
+	// Wait before the next attempt, set for retries and open circuits.
+	Delay time.Duration
+	Err   error
+}
+
+const eventBufferSize = 100
+
+// Events are dropped when nobody keeps up with them, so a slow consumer
+// can't stall reconnects.
+func (m *Manager) emit(event Event) {
+	select {
+	case m.events <- event:
+	default:
+	}
+}
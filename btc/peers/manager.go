@@ -0,0 +1,437 @@
+package peers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/client"
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+var ErrDuplicatePeer = errors.New("already connected to this node")
+
+const messageBufferSize = 100
+
+// How long we sleep when no address is waiting for a retry.
+const idleInterval = time.Minute
+
+type PeerID uint64
+
+// Message is a message received from one of the managed peers.
+type Message struct {
+	Peer    PeerID
+	Message encoding.Message
+}
+
+type peer struct {
+	id      PeerID
+	address string
+	client  *client.BTCClient
+	// Inbound peers come from the server and have no reconnect policy.
+	inbound bool
+}
+
+// Manager keeps up to a target number of outbound peers connected, picking
+// addresses from a fixed list and replacing peers that fail. Failed addresses
+// are retried with backoff. Inbound peers accepted elsewhere can join with
+// RunInbound. Messages from all peers are multiplexed into one channel.
+type Manager struct {
+	ctx     context.Context
+	log     *slog.Logger
+	cfg     *config.Config
+	network encoding.Network
+
+	addresses []string
+	target    int
+
+	// PeerSetup, if set, is called for every new client before it connects.
+	PeerSetup func(peer *client.BTCClient)
+
+	mu        sync.RWMutex
+	nextID    PeerID
+	peers     map[PeerID]*peer
+	connected map[string]PeerID
+	backoffs  map[string]*backoff
+	// Addresses that lead to the same node as another address, which we
+	// don't dial while that one is connected.
+	aliases map[string]string
+	// Set once we stop, no peers can join after that.
+	stopped bool
+
+	messageC chan Message
+	events   chan Event
+	peerDone chan struct{}
+	wg       sync.WaitGroup
+}
+
+func New(ctx context.Context, log *slog.Logger, cfg *config.Config, network encoding.Network) *Manager {
+	addresses := cfg.BTCNodeAddresses
+	if len(addresses) == 0 {
+		addresses = []string{cfg.BTCNodeAddress}
+	}
+	return &Manager{
+		ctx:       ctx,
+		log:       log,
+		cfg:       cfg,
+		network:   network,
+		addresses: addresses,
+		target:    cfg.TargetOutboundPeers,
+		peers:     map[PeerID]*peer{},
+		connected: map[string]PeerID{},
+		backoffs:  map[string]*backoff{},
+		aliases:   map[string]string{},
+		messageC:  make(chan Message, messageBufferSize),
+		events:    make(chan Event, eventBufferSize),
+		peerDone:  make(chan struct{}, 1),
+	}
+}
+
+// Start connects to the peers in the background. The returned channel, like
+// the events channel, is closed once the context is canceled and all peers
+// have disconnected.
+func (m *Manager) Start() (<-chan Message, error) {
+	addresses := make([]string, 0, len(m.addresses))
+	seen := map[string]bool{}
+	for _, address := range m.addresses {
+		normalized, err := client.AddressWithPort(address, m.network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer address %s: %w", address, err)
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			addresses = append(addresses, normalized)
+			m.backoffs[normalized] = newBackoff(m.cfg)
+		}
+	}
+	m.addresses = addresses
+
+	go m.run()
+	return m.messageC, nil
+}
+
+// Events reports reconnect attempts and circuit breaker changes.
+func (m *Manager) Events() <-chan Event {
+	return m.events
+}
+
+// Circuit returns the circuit breaker state of a peer address.
+func (m *Manager) Circuit(address string) CircuitState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.backoffs[address]
+	if !ok {
+		return CircuitClosed
+	}
+	return b.state
+}
+
+// Peer returns the client of a connected peer or nil if it is gone.
+func (m *Manager) Peer(id PeerID) *client.BTCClient {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.peers[id]
+	if !ok {
+		return nil
+	}
+	return p.client
+}
+
+// Peers returns the IDs of the connected peers.
+func (m *Manager) Peers() []PeerID {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make([]PeerID, 0, len(m.peers))
+	for id := range m.peers {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Tops up the peers whenever a peer goes away and when the next retry is due.
+func (m *Manager) run() {
+	timer := time.NewTimer(idleInterval)
+	defer timer.Stop()
+
+	for {
+		m.fill()
+		timer.Reset(m.nextRetry())
+		select {
+		case <-m.ctx.Done():
+			m.mu.Lock()
+			m.stopped = true
+			m.mu.Unlock()
+			m.wg.Wait()
+			close(m.messageC)
+			close(m.events)
+			return
+		case <-timer.C:
+		case <-m.peerDone:
+		}
+	}
+}
+
+// Time until the earliest scheduled retry of an address we are not
+// connected to.
+func (m *Manager) nextRetry() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	wait := idleInterval
+	now := time.Now()
+	for address, b := range m.backoffs {
+		if _, ok := m.connected[address]; ok || m.aliasConnected(address) {
+			continue
+		}
+		wait = min(wait, max(b.next.Sub(now), 0))
+	}
+	return wait
+}
+
+func (m *Manager) fill() {
+	for m.ctx.Err() == nil && m.count() < m.target {
+		address, ok := m.nextAddress()
+		if !ok {
+			return
+		}
+		m.connect(address)
+	}
+}
+
+// Counts the outbound peers, inbound ones don't take up our slots.
+func (m *Manager) count() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	count := 0
+	for _, p := range m.peers {
+		if !p.inbound {
+			count++
+		}
+	}
+	return count
+}
+
+// Picks the first address we are not connected to and whose backoff is
+// over.
+func (m *Manager) nextAddress() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, address := range m.addresses {
+		if _, ok := m.connected[address]; ok || m.aliasConnected(address) {
+			continue
+		}
+		b := m.backoffs[address]
+		wasOpen := b.state == CircuitOpen
+		if !b.ready(now) {
+			continue
+		}
+		if wasOpen {
+			m.emit(Event{Type: EventCircuitHalfOpen, Address: address, Attempt: b.failures})
+		}
+		return address, true
+	}
+	return "", false
+}
+
+// Reports whether the address is an alias of a connected peer. Callers hold
+// the lock.
+func (m *Manager) aliasConnected(address string) bool {
+	other, ok := m.aliases[address]
+	if !ok {
+		return false
+	}
+	_, connected := m.connected[other]
+	return connected
+}
+
+func (m *Manager) connect(address string) {
+	m.mu.Lock()
+	m.nextID++
+	id := m.nextID
+	m.mu.Unlock()
+
+	cfg := *m.cfg
+	cfg.BTCNodeAddress = address
+	log := m.log.With("peer_id", id, "peer", address)
+	c := client.New(m.ctx, log, &cfg, m.network)
+	if m.PeerSetup != nil {
+		m.PeerSetup(c)
+	}
+
+	m.emit(Event{Type: EventConnecting, Peer: id, Address: address})
+	messageC, err := c.Connect()
+	if err != nil {
+		log.Error("failed connecting to peer", "error", err)
+		// Releases the client context and anything waiting on it.
+		c.Disconnect(err)
+		m.recordFailure(0, address, err)
+		return
+	}
+
+	p := &peer{id: id, address: address, client: c}
+	m.mu.Lock()
+	m.peers[id] = p
+	m.connected[address] = id
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.runPeer(p, messageC)
+}
+
+// RunInbound adds a peer accepted by the server, so its messages are tagged
+// and multiplexed like those of the outbound peers. It returns once the peer
+// disconnects.
+func (m *Manager) RunInbound(c *client.BTCClient, messageC <-chan encoding.Message) PeerID {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		c.Disconnect(m.ctx.Err())
+		return 0
+	}
+	m.nextID++
+	p := &peer{id: m.nextID, address: c.Address(), client: c, inbound: true}
+	m.peers[p.id] = p
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	m.log.Info("inbound peer connected", "peer_id", p.id, "peer", p.address)
+	m.runPeer(p, messageC)
+	return p.id
+}
+
+// Forwards the peer messages until it disconnects.
+func (m *Manager) runPeer(p *peer, messageC <-chan encoding.Message) {
+	defer m.wg.Done()
+	defer m.removePeer(p)
+
+	established := p.client.Established()
+	for {
+		select {
+		case <-established:
+			established = nil
+			if !p.inbound {
+				m.recordSuccess(p)
+			}
+			m.checkDuplicate(p)
+		case msg, ok := <-messageC:
+			if !ok {
+				return
+			}
+			select {
+			case m.messageC <- Message{Peer: p.id, Message: msg}:
+			case <-m.ctx.Done():
+			}
+		}
+	}
+}
+
+// Different addresses can lead to the same node. We recognize it by the
+// nonce in its version message and keep the connection we opened first, or
+// our outbound connection if the node also connected to us. Handshakes can
+// finish in any order, so the check runs for every peer that completes one.
+// The address of a dropped outbound peer becomes an alias of the kept one, so
+// we don't dial the same node again through it.
+func (m *Manager) checkDuplicate(p *peer) {
+	nonce := p.client.Peer().RemoteVersion().Nonce
+	// Versions before 106 don't carry a nonce.
+	if nonce == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	var kept, dropped *peer
+	for _, other := range m.peers {
+		if other.id == p.id {
+			continue
+		}
+		version := other.client.Peer().RemoteVersion()
+		if version == nil || version.Nonce != nonce {
+			continue
+		}
+		kept, dropped = p, other
+		if preferred(other, p) {
+			kept, dropped = other, p
+		}
+		break
+	}
+	// Inbound peers have no address we would dial again.
+	if dropped != nil && !dropped.inbound {
+		m.aliases[dropped.address] = kept.address
+	}
+	m.mu.Unlock()
+
+	if dropped != nil {
+		dropped.client.Disconnect(fmt.Errorf("%w: peer %d at %s", ErrDuplicatePeer, kept.id, kept.address))
+	}
+}
+
+// Outbound peers win over inbound ones, then the one opened first.
+func preferred(a, b *peer) bool {
+	if a.inbound != b.inbound {
+		return !a.inbound
+	}
+	return a.id < b.id
+}
+
+func (m *Manager) removePeer(p *peer) {
+	reason := p.client.Err()
+	m.log.Info("peer disconnected", "peer_id", p.id, "peer", p.address, "reason", reason)
+	m.emit(Event{Type: EventDisconnected, Peer: p.id, Address: p.address, Err: reason})
+
+	m.mu.Lock()
+	delete(m.peers, p.id)
+	if !p.inbound {
+		delete(m.connected, p.address)
+	}
+	m.mu.Unlock()
+	// A duplicate isn't a failure of the address, retrying it would only
+	// lead to the same node again.
+	switch {
+	case p.inbound:
+	case errors.Is(reason, ErrDuplicatePeer):
+		m.log.Info("not redialing alias of a connected peer", "peer", p.address)
+	default:
+		m.recordFailure(p.id, p.address, reason)
+	}
+
+	select {
+	case m.peerDone <- struct{}{}:
+	default:
+	}
+}
+
+// A completed handshake resets the backoff of the address.
+func (m *Manager) recordSuccess(p *peer) {
+	m.mu.Lock()
+	b := m.backoffs[p.address]
+	wasHalfOpen := b.state == CircuitHalfOpen
+	b.success()
+	m.mu.Unlock()
+
+	m.emit(Event{Type: EventConnected, Peer: p.id, Address: p.address})
+	if wasHalfOpen {
+		m.emit(Event{Type: EventCircuitClosed, Peer: p.id, Address: p.address})
+	}
+}
+
+// Schedules the next attempt for an address that failed to connect or lost
+// its peer.
+func (m *Manager) recordFailure(id PeerID, address string, reason error) {
+	m.mu.Lock()
+	b := m.backoffs[address]
+	delay := b.failure(time.Now())
+	event := Event{Type: EventRetryScheduled, Peer: id, Address: address, Attempt: b.failures, Delay: delay, Err: reason}
+	state := b.state
+	if state == CircuitOpen {
+		event.Type = EventCircuitOpen
+	}
+	m.mu.Unlock()
+
+	m.log.Info("scheduled peer reconnect", "peer", address, "attempt", event.Attempt, "delay", delay, "circuit", state.String())
+	m.emit(event)
+}
@@ -0,0 +1,367 @@
+package peers
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/client"
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+// Starts a node that completes the handshake with the given version nonce and
+// sends a getaddr. With closeAfter it drops every connection after the
+// handshake instead.
+func startFakeNode(t *testing.T, nonce uint64, closeAfter bool) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeNode(conn, nonce, closeAfter)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveFakeNode(conn net.Conn, nonce uint64, closeAfter bool) {
+	defer conn.Close()
+	_, _, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+	if err != nil {
+		return
+	}
+	addr, err := encoding.NewIP4Address(encoding.ServicesNone, "0.0.0.0:0")
+	if err != nil {
+		return
+	}
+	version, err := encoding.NewVersionMsg(time.Now(), encoding.ServicesNone, addr, addr, nonce, 1)
+	if err != nil {
+		return
+	}
+	for _, msg := range []encoding.Message{version, &encoding.MsgVerack{}} {
+		if encoding.SendMessage(encoding.NetworkRegtest, msg, conn) != nil {
+			return
+		}
+	}
+	if closeAfter {
+		// Wait for our verack, so the handshake completes on both ends.
+		for {
+			_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+			if err != nil || msg.GetCommand() == encoding.VerackCommand {
+				return
+			}
+		}
+	}
+	if encoding.SendMessage(encoding.NetworkRegtest, &encoding.MsgGetAddr{}, conn) != nil {
+		return
+	}
+	for {
+		_, _, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func startManager(t *testing.T, addresses []string, target int) (*Manager, <-chan Message) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := &config.Config{
+		BTCNodeAddresses:    addresses,
+		TargetOutboundPeers: target,
+		ReconnectMinDelay:   time.Hour,
+		ReconnectMaxDelay:   time.Hour,
+	}
+	m := New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	messageC, err := m.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cancel()
+		for range messageC {
+		}
+	})
+	return m, messageC
+}
+
+func receive(t *testing.T, messageC <-chan Message) Message {
+	t.Helper()
+	select {
+	case msg := <-messageC:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message from peers")
+		return Message{}
+	}
+}
+
+func Test_Manager_MultiplexesPeers(t *testing.T) {
+	addresses := []string{startFakeNode(t, 1, false), startFakeNode(t, 2, false)}
+	m, messageC := startManager(t, addresses, 2)
+
+	first := receive(t, messageC)
+	second := receive(t, messageC)
+
+	assert.Equal(t, encoding.GetAddrCommand, first.Message.GetCommand())
+	assert.Equal(t, encoding.GetAddrCommand, second.Message.GetCommand())
+	assert.NotEqual(t, first.Peer, second.Peer)
+	assert.ElementsMatch(t, []PeerID{first.Peer, second.Peer}, m.Peers())
+	assert.NotNil(t, m.Peer(first.Peer))
+}
+
+func Test_Manager_DeduplicatesAddresses(t *testing.T) {
+	address := startFakeNode(t, 1, false)
+	m, messageC := startManager(t, []string{address, address}, 2)
+
+	receive(t, messageC)
+	assert.Len(t, m.Peers(), 1)
+	assert.Equal(t, []string{address}, m.addresses)
+}
+
+func Test_Manager_DeduplicatesNonce(t *testing.T) {
+	// Two addresses leading to the same node.
+	addresses := []string{startFakeNode(t, 7, false), startFakeNode(t, 7, false)}
+	m, messageC := startManager(t, addresses, 2)
+
+	receive(t, messageC)
+	// The connection opened first is kept.
+	assert.Eventually(t, func() bool {
+		peers := m.Peers()
+		return len(peers) == 1 && peers[0] == 1
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func Test_Manager_DoesNotRedialDuplicate(t *testing.T) {
+	addresses := []string{startFakeNode(t, 7, false), startFakeNode(t, 7, false)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := &config.Config{
+		BTCNodeAddresses:    addresses,
+		TargetOutboundPeers: 2,
+		ReconnectMinDelay:   10 * time.Millisecond,
+		ReconnectMaxDelay:   10 * time.Millisecond,
+	}
+	m := New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	_, err := m.Start()
+	require.NoError(t, err)
+
+	events := waitForEvent(t, m, EventDisconnected)
+	assert.ErrorIs(t, events[len(events)-1].Err, ErrDuplicatePeer)
+	dropped := events[len(events)-1].Address
+
+	// The alias is not dialed again while the node is connected through the
+	// other address.
+	timeout := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case event := <-m.Events():
+			assert.NotEqual(t, dropped, event.Address, "unexpected %s event", event.Type)
+		case <-timeout:
+			assert.Len(t, m.Peers(), 1)
+			return
+		}
+	}
+}
+
+// Connects a fake node to us with the given version nonce. It sends a getaddr
+// after the handshake.
+func connectInbound(t *testing.T, m *Manager, nonce uint64) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		c := client.New(m.ctx, slog.Default(), &config.Config{}, encoding.NetworkRegtest)
+		messageC, err := c.Accept(conn)
+		if err != nil {
+			return
+		}
+		m.RunInbound(c, messageC)
+	}()
+	remote, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { remote.Close() })
+
+	addr, err := encoding.NewIP4Address(encoding.ServicesNone, "0.0.0.0:0")
+	require.NoError(t, err)
+	version, err := encoding.NewVersionMsg(time.Now(), encoding.ServicesNone, addr, addr, nonce, 1)
+	require.NoError(t, err)
+	go func() {
+		if encoding.SendMessage(encoding.NetworkRegtest, version, remote) != nil {
+			return
+		}
+		for {
+			_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, remote)
+			if err != nil {
+				return
+			}
+			if msg.GetCommand() != encoding.VerackCommand {
+				continue
+			}
+			for _, msg := range []encoding.Message{&encoding.MsgVerack{}, &encoding.MsgGetAddr{}} {
+				if encoding.SendMessage(encoding.NetworkRegtest, msg, remote) != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+func Test_Manager_RunsInboundPeers(t *testing.T) {
+	m, messageC := startManager(t, []string{startFakeNode(t, 1, false)}, 1)
+	outbound := receive(t, messageC)
+
+	connectInbound(t, m, 2)
+	inbound := receive(t, messageC)
+
+	assert.Equal(t, encoding.GetAddrCommand, inbound.Message.GetCommand())
+	assert.NotEqual(t, outbound.Peer, inbound.Peer)
+	assert.ElementsMatch(t, []PeerID{outbound.Peer, inbound.Peer}, m.Peers())
+	require.NotNil(t, m.Peer(inbound.Peer))
+	assert.True(t, m.Peer(inbound.Peer).Inbound())
+	// Inbound peers don't count against the outbound target.
+	assert.Equal(t, 1, m.count())
+}
+
+func Test_Manager_DropsDuplicateInbound(t *testing.T) {
+	m, messageC := startManager(t, []string{startFakeNode(t, 7, false)}, 1)
+	outbound := receive(t, messageC)
+
+	// The node connects back to us, we keep our own connection.
+	connectInbound(t, m, 7)
+	assert.Eventually(t, func() bool {
+		peers := m.Peers()
+		return len(peers) == 1 && peers[0] == outbound.Peer
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func Test_Manager_ReplacesFailedPeer(t *testing.T) {
+	failing := startFakeNode(t, 1, true)
+	healthy := startFakeNode(t, 2, false)
+	m, messageC := startManager(t, []string{failing, healthy}, 1)
+
+	// The failing node is dialed first, the message comes from its replacement.
+	msg := receive(t, messageC)
+
+	assert.Equal(t, PeerID(2), msg.Peer)
+	peer := m.Peer(msg.Peer)
+	require.NotNil(t, peer)
+	assert.Equal(t, healthy, peer.Address())
+	assert.Equal(t, []PeerID{msg.Peer}, m.Peers())
+}
+
+func Test_Manager_Stop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := &config.Config{BTCNodeAddress: startFakeNode(t, 1, false), TargetOutboundPeers: 1}
+	m := New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	messageC, err := m.Start()
+	require.NoError(t, err)
+	receive(t, messageC)
+
+	cancel()
+	for range messageC {
+	}
+	assert.Empty(t, m.Peers())
+}
+
+// Collects events until one of the given type shows up.
+func waitForEvent(t *testing.T, m *Manager, eventType EventType) []Event {
+	t.Helper()
+	var events []Event
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-m.Events():
+			events = append(events, event)
+			if event.Type == eventType {
+				return events
+			}
+		case <-timeout:
+			t.Fatalf("no %s event, got %v", eventType, events)
+			return nil
+		}
+	}
+}
+
+func Test_Manager_Reconnects(t *testing.T) {
+	// The node drops us after every handshake, like a node that restarts.
+	address := startFakeNode(t, 1, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := &config.Config{
+		BTCNodeAddress:      address,
+		TargetOutboundPeers: 1,
+		ReconnectMinDelay:   10 * time.Millisecond,
+		ReconnectMaxDelay:   time.Second,
+	}
+	m := New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	_, err := m.Start()
+	require.NoError(t, err)
+
+	waitForEvent(t, m, EventConnected)
+	events := waitForEvent(t, m, EventRetryScheduled)
+	retry := events[len(events)-1]
+	assert.Equal(t, 1, retry.Attempt, "the handshake reset the attempts")
+	assert.InDelta(t, 10*time.Millisecond, retry.Delay, float64(time.Millisecond))
+	assert.Equal(t, address, retry.Address)
+
+	events = waitForEvent(t, m, EventConnected)
+	assert.Equal(t, EventConnecting, events[0].Type)
+	assert.NotEqual(t, retry.Peer, events[len(events)-1].Peer)
+}
+
+func Test_Manager_CircuitBreaker(t *testing.T) {
+	// Grab a free port and close it, so dials get refused.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := &config.Config{
+		BTCNodeAddress:         address,
+		TargetOutboundPeers:    1,
+		ReconnectMinDelay:      10 * time.Millisecond,
+		ReconnectMaxDelay:      time.Second,
+		ReconnectMaxAttempts:   3,
+		CircuitBreakerCooldown: 50 * time.Millisecond,
+	}
+	m := New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	_, err = m.Start()
+	require.NoError(t, err)
+
+	events := waitForEvent(t, m, EventCircuitOpen)
+	var attempts []int
+	var delays []time.Duration
+	for _, event := range events {
+		if event.Type == EventRetryScheduled || event.Type == EventCircuitOpen {
+			attempts = append(attempts, event.Attempt)
+			delays = append(delays, event.Delay)
+			assert.Error(t, event.Err)
+		}
+	}
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond}, delays)
+
+	// After the cooldown a single attempt fails and opens the circuit again.
+	events = waitForEvent(t, m, EventCircuitOpen)
+	assert.Equal(t, EventCircuitHalfOpen, events[0].Type)
+	assert.Equal(t, EventConnecting, events[1].Type)
+	assert.Equal(t, 4, events[len(events)-1].Attempt)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/client"
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+// PeerHandler consumes the messages of an inbound peer. The channel delivers
+// messages once the handshake is complete and is closed when the peer
+// disconnects.
+type PeerHandler func(peer *client.BTCClient, messageC <-chan encoding.Message)
+
+// Server accepts inbound peers and runs the responder side of the handshake
+// for each of them.
+type Server struct {
+	log      *slog.Logger
+	cfg      *config.Config
+	network  encoding.Network
+	address  string
+	handler  PeerHandler
+	listener net.Listener
+
+	// PeerSetup, if set, is called for every new client before it accepts
+	// the connection.
+	PeerSetup func(peer *client.BTCClient)
+
+	mu       sync.Mutex
+	peers    int
+	maxPeers int
+}
+
+func New(log *slog.Logger, cfg *config.Config, network encoding.Network, handler PeerHandler) *Server {
+	return &Server{
+		log:      log,
+		cfg:      cfg,
+		network:  network,
+		address:  cfg.BTCListenAddress,
+		handler:  handler,
+		maxPeers: cfg.MaxInboundPeers,
+	}
+}
+
+// Listen binds the listening socket. A listen address without a port uses the
+// default port of the network.
+func (s *Server) Listen() error {
+	address, err := client.AddressWithPort(s.address, s.network)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen for peers")
+	}
+	s.listener = listener
+	s.log.Info("listening for bitcoin peers", "address", listener.Addr().String(), "network", s.network.String())
+	return nil
+}
+
+// Addr returns the address we listen on, useful when listening on port 0.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve accepts peers until the context is canceled. Every peer gets its own
+// client bound to the context, so canceling it disconnects all of them.
+func (s *Server) Serve(ctx context.Context) error {
+	if s.listener == nil {
+		return errors.New("server is not listening")
+	}
+	go func() {
+		<-ctx.Done()
+		s.listener.Close()
+	}()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return context.Canceled
+			}
+			return errors.Wrap(err, "failed accepting peer")
+		}
+		if !s.reservePeer() {
+			s.log.Info("too many inbound peers, dropping connection", "address", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+		s.accept(ctx, conn)
+	}
+}
+
+func (s *Server) accept(ctx context.Context, conn net.Conn) {
+	log := s.log.With("peer", conn.RemoteAddr().String())
+	peer := client.New(ctx, log, s.cfg, s.network)
+	if s.PeerSetup != nil {
+		s.PeerSetup(peer)
+	}
+	messageC, err := peer.Accept(conn)
+	if err != nil {
+		log.Error("failed accepting peer", "error", err)
+		s.releasePeer()
+		return
+	}
+	go func() {
+		defer s.releasePeer()
+		s.handler(peer, messageC)
+		// Drain whatever the handler left, so the peer can shut down.
+		for range messageC {
+		}
+	}()
+}
+
+// A zero limit allows any number of peers.
+func (s *Server) reservePeer() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxPeers > 0 && s.peers >= s.maxPeers {
+		return false
+	}
+	s.peers++
+	return true
+}
+
+func (s *Server) releasePeer() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peers--
+}
+
+// Peers returns the number of connected inbound peers.
+func (s *Server) Peers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peers
+}
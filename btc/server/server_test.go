@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"deshev.com/bitcoin-handshake/btc/client"
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/config"
+)
+
+func startServer(t *testing.T, cfg *config.Config, handler PeerHandler) *Server {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New(slog.Default(), cfg, encoding.NetworkRegtest, handler)
+	require.NoError(t, s.Listen())
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.ErrorIs(t, <-served, context.Canceled)
+	})
+	return s
+}
+
+func Test_Server_Handshake(t *testing.T) {
+	received := make(chan encoding.Message, 10)
+	s := startServer(t, &config.Config{BTCListenAddress: "127.0.0.1:0"},
+		func(peer *client.BTCClient, messageC <-chan encoding.Message) {
+			assert.True(t, peer.Inbound())
+			for msg := range messageC {
+				received <- msg
+			}
+		})
+
+	// A remote node dials in and opens the handshake.
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	addr, err := encoding.NewIP4Address(encoding.ServicesNone, "0.0.0.0:0")
+	require.NoError(t, err)
+	version, err := encoding.NewVersionMsg(time.Now(), encoding.ServicesNone, addr, addr, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, encoding.SendMessage(encoding.NetworkRegtest, version, conn))
+
+	var commands []encoding.Command
+	for range 4 {
+		_, msg, err := encoding.ReceiveMessage(encoding.NetworkRegtest, conn)
+		require.NoError(t, err)
+		commands = append(commands, msg.GetCommand())
+	}
+	assert.Equal(t, []encoding.Command{
+		encoding.VersionCommand, encoding.WTxIDRelayCommand, encoding.SendAddrV2Command, encoding.VerackCommand,
+	}, commands)
+	require.NoError(t, encoding.SendMessage(encoding.NetworkRegtest, &encoding.MsgVerack{}, conn))
+	require.NoError(t, encoding.SendMessage(encoding.NetworkRegtest, &encoding.MsgGetAddr{}, conn))
+
+	// We don't ask inbound peers for addresses, but get their getaddr.
+	select {
+	case msg := <-received:
+		assert.Equal(t, encoding.GetAddrCommand, msg.GetCommand())
+	case <-time.After(time.Second):
+		t.Fatal("server did not complete the handshake")
+	}
+	assert.Equal(t, 1, s.Peers())
+
+	conn.Close()
+	assert.Eventually(t, func() bool { return s.Peers() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func Test_Server_SelfConnection(t *testing.T) {
+	inbound := make(chan *client.BTCClient, 1)
+	s := startServer(t, &config.Config{BTCListenAddress: "127.0.0.1:0"},
+		func(peer *client.BTCClient, messageC <-chan encoding.Message) {
+			for range messageC {
+			}
+			inbound <- peer
+		})
+
+	// Our own client dials in, both sides share the process nonces.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := &config.Config{BTCNodeAddress: s.Addr().String()}
+	c := client.New(ctx, slog.Default(), cfg, encoding.NetworkRegtest)
+	messageC, err := c.Connect()
+	require.NoError(t, err)
+	for range messageC {
+	}
+
+	select {
+	case peer := <-inbound:
+		assert.ErrorIs(t, peer.Err(), client.ErrSelfConnection)
+	case <-time.After(time.Second):
+		t.Fatal("server kept the self-connection")
+	}
+	assert.NotEqual(t, client.StateEstablished, c.State())
+}
+
+func Test_Server_MaxInboundPeers(t *testing.T) {
+	cfg := &config.Config{BTCListenAddress: "127.0.0.1:0", MaxInboundPeers: 1}
+	s := startServer(t, cfg, func(_ *client.BTCClient, messageC <-chan encoding.Message) {
+		for range messageC {
+		}
+	})
+
+	first, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	assert.Eventually(t, func() bool { return s.Peers() == 1 }, time.Second, 10*time.Millisecond)
+
+	second, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	require.NoError(t, second.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = second.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 1, s.Peers())
+}
+
+func Test_Server_DefaultPort(t *testing.T) {
+	s := New(slog.Default(), &config.Config{BTCListenAddress: "127.0.0.1"}, encoding.NetworkRegtest, nil)
+	err := s.Listen()
+	if err != nil {
+		// The regtest port may be taken by a local node.
+		t.Skip(err)
+	}
+	defer s.listener.Close()
+	assert.Equal(t, "127.0.0.1:18444", s.Addr().String())
+}
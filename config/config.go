@@ -2,15 +2,93 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	BTCNodeAddress string
+	BTCNetwork     string
+	PingInterval   time.Duration
+	PingTimeout    time.Duration
+	MaxPayloadSize uint32
+	MaxSoftErrors  int
+	SyncHeaders    bool
+	CompactBlocks  bool
+	Mempool        bool
+	MempoolSize    int
+	// How often our transactions are announced again, zero disables it.
+	RebroadcastInterval time.Duration
+	// How long we broadcast a transaction that is neither confirmed nor
+	// rejected, zero means until it is.
+	BroadcastTimeout time.Duration
+
+	// What we announce in our version message.
+	Services          uint64
+	UserAgentComments []string
+	StartHeight       uint32
+	Relay             bool
+
+	// Zero disables the timeout.
+	DialTimeout      time.Duration
+	HandshakeTimeout time.Duration
+	IdleTimeout      time.Duration
+	WriteTimeout     time.Duration
+	RequestTimeout   time.Duration
+
+	BTCListenAddress string
+	MaxInboundPeers  int
+
+	// Outbound peers the peer manager picks from. Falls back to BTCNodeAddress.
+	BTCNodeAddresses    []string
+	TargetOutboundPeers int
+
+	ReconnectMinDelay      time.Duration
+	ReconnectMaxDelay      time.Duration
+	ReconnectJitter        float64
+	ReconnectMaxAttempts   int
+	CircuitBreakerCooldown time.Duration
 }
 
 func New() *Config {
 	return &Config{
-		BTCNodeAddress: getEnv("BTC_NODE_ADDRESS", "localhost:18444"),
+		BTCNodeAddress: getEnv("BTC_NODE_ADDRESS", "localhost"),
+		BTCNetwork:     getEnv("BTC_NETWORK", "regtest"),
+		PingInterval:   getDurationEnv("BTC_PING_INTERVAL", 2*time.Minute),
+		PingTimeout:    getDurationEnv("BTC_PING_TIMEOUT", 20*time.Minute),
+		MaxPayloadSize: getUint32Env("BTC_MAX_PAYLOAD_SIZE", 32*1024*1024),
+		MaxSoftErrors:  getIntEnv("BTC_MAX_SOFT_ERRORS", 10),
+		SyncHeaders:    getBoolEnv("BTC_SYNC_HEADERS", false),
+		CompactBlocks:  getBoolEnv("BTC_COMPACT_BLOCKS", false),
+		Mempool:        getBoolEnv("BTC_MEMPOOL", false),
+		MempoolSize:    getIntEnv("BTC_MEMPOOL_SIZE", 50000),
+
+		RebroadcastInterval: getDurationEnv("BTC_REBROADCAST_INTERVAL", 10*time.Minute),
+		BroadcastTimeout:    getDurationEnv("BTC_BROADCAST_TIMEOUT", 24*time.Hour),
+
+		Services:          getUint64Env("BTC_SERVICES", 0),
+		UserAgentComments: getListEnv("BTC_USER_AGENT_COMMENTS"),
+		StartHeight:       getUint32Env("BTC_START_HEIGHT", 0),
+		Relay:             getBoolEnv("BTC_RELAY", false),
+
+		DialTimeout:      getDurationEnv("BTC_DIAL_TIMEOUT", 10*time.Second),
+		HandshakeTimeout: getDurationEnv("BTC_HANDSHAKE_TIMEOUT", time.Minute),
+		IdleTimeout:      getDurationEnv("BTC_IDLE_TIMEOUT", 20*time.Minute),
+		WriteTimeout:     getDurationEnv("BTC_WRITE_TIMEOUT", 20*time.Second),
+		RequestTimeout:   getDurationEnv("BTC_REQUEST_TIMEOUT", time.Minute),
+
+		BTCListenAddress: getEnv("BTC_LISTEN_ADDRESS", ""),
+		MaxInboundPeers:  getIntEnv("BTC_MAX_INBOUND_PEERS", 125),
+
+		BTCNodeAddresses:    getListEnv("BTC_NODE_ADDRESSES"),
+		TargetOutboundPeers: getIntEnv("BTC_TARGET_OUTBOUND_PEERS", 8),
+
+		ReconnectMinDelay:      getDurationEnv("BTC_RECONNECT_MIN_DELAY", time.Second),
+		ReconnectMaxDelay:      getDurationEnv("BTC_RECONNECT_MAX_DELAY", 2*time.Minute),
+		ReconnectJitter:        getFloatEnv("BTC_RECONNECT_JITTER", 0.2),
+		ReconnectMaxAttempts:   getIntEnv("BTC_RECONNECT_MAX_ATTEMPTS", 10),
+		CircuitBreakerCooldown: getDurationEnv("BTC_CIRCUIT_BREAKER_COOLDOWN", 5*time.Minute),
 	}
 }
 
@@ -21,3 +99,64 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getUint32Env(key string, defaultValue uint32) uint32 {
+	value, err := strconv.ParseUint(os.Getenv(key), 10, 32)
+	if err != nil {
+		return defaultValue
+	}
+	return uint32(value)
+}
+
+// Accepts hex values, handy for service bits.
+func getUint64Env(key string, defaultValue uint64) uint64 {
+	value, err := strconv.ParseUint(os.Getenv(key), 0, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// Reads a comma separated list, skipping empty entries.
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
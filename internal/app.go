@@ -8,49 +8,277 @@ import (
 
 	"github.com/pkg/errors"
 
+	"deshev.com/bitcoin-handshake/btc/broadcast"
+	"deshev.com/bitcoin-handshake/btc/chain"
 	"deshev.com/bitcoin-handshake/btc/client"
+	"deshev.com/bitcoin-handshake/btc/compact"
 	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/btc/mempool"
+	"deshev.com/bitcoin-handshake/btc/peers"
+	"deshev.com/bitcoin-handshake/btc/server"
 	"deshev.com/bitcoin-handshake/config"
 )
 
-type RemoteClient interface {
-	Connect() (<-chan encoding.Message, error)
-}
-
 type Application struct {
 	log    *slog.Logger
 	config *config.Config
 	ctx    context.Context
-	client RemoteClient
+	peers  *peers.Manager
+	server *server.Server
+	// Nil unless BTC_MEMPOOL is set.
+	mempool     *mempool.Watcher
+	broadcaster *broadcast.Broadcaster
+	blocks      *blockTracker
+	queues      *peerQueues
 }
 
-func NewApplication(ctx context.Context, log *slog.Logger) *Application {
+func NewApplication(ctx context.Context, log *slog.Logger) (*Application, error) {
 	cfg := config.New()
+	network, err := encoding.ParseNetwork(cfg.BTCNetwork)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid BTC_NETWORK")
+	}
+
+	options := client.OptionsFromConfig(cfg)
+	_, err = options.UserAgent()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid BTC_USER_AGENT_COMMENTS")
+	}
 
-	return &Application{
+	manager := peers.New(ctx, log, cfg, network)
+	a := &Application{
 		ctx:    ctx,
 		log:    log,
 		config: cfg,
-		client: client.New(ctx, log, cfg),
+		peers:  manager,
+		blocks: newBlockTracker(),
+	}
+	a.queues = newPeerQueues(a.handleMessage)
+	a.broadcaster = broadcast.New(log, a.connectedPeers, cfg.RebroadcastInterval, cfg.BroadcastTimeout)
+
+	var headers *chain.HeaderChain
+	if cfg.SyncHeaders {
+		params, err := chain.ParamsFor(network)
+		if err != nil {
+			return nil, errors.Wrap(err, "header sync not supported")
+		}
+		// All peers sync into the same chain.
+		headers = chain.NewHeaderChain(params)
+	}
+	if cfg.Mempool {
+		// Peers don't announce transactions to us without it.
+		if !cfg.Relay {
+			return nil, errors.New("BTC_MEMPOOL needs BTC_RELAY=true")
+		}
+		a.mempool = mempool.NewWatcher(log, mempool.NewPool(cfg.MempoolSize), cfg.RequestTimeout)
+	}
+	// Inbound and outbound peers share the high bandwidth compact block slots.
+	var slots *client.HighBandwidthSlots
+	if cfg.CompactBlocks {
+		slots = client.NewHighBandwidthSlots(client.MaxHighBandwidthPeers)
+	}
+	manager.PeerSetup = func(peer *client.BTCClient) {
+		if headers != nil {
+			peer.SyncHeaders(headers)
+		}
+		if slots != nil {
+			peer.ShareHighBandwidthSlots(slots)
+		}
+		if a.mempool != nil {
+			go a.requestMempool(peer)
+		}
+	}
+	if cfg.BTCListenAddress != "" {
+		a.server = server.New(log, cfg, network, a.handleInboundPeer)
+		a.server.PeerSetup = func(peer *client.BTCClient) {
+			if slots != nil {
+				peer.ShareHighBandwidthSlots(slots)
+			}
+		}
 	}
+	return a, nil
 }
 
 func (a *Application) StartConnection() error {
-	messageC, err := a.client.Connect()
+	messageC, err := a.peers.Start()
 	if err != nil {
-		return errors.Wrap(err, "client connect error")
+		return errors.Wrap(err, "peer manager start error")
 	}
+	go a.logPeerEvents(a.peers.Events())
+	go a.broadcaster.Run(a.ctx)
+
 	for {
 		select {
 		case <-a.ctx.Done():
 			return context.Canceled
 		case msg, ok := <-messageC:
 			if !ok {
-				return errors.New("client connection closed")
+				// The manager only stops with our context.
+				return context.Canceled
+			}
+			a.log.Info("app received message", "command", msg.Message.GetCommand(), "peer_id", msg.Peer)
+			peer := a.peers.Peer(msg.Peer)
+			if peer == nil {
+				continue
 			}
-			a.log.Info("app received message", "command", msg.GetCommand())
+			err := a.queues.push(msg.Peer, peer.Done(), msg.Message)
+			switch {
+			case errors.Is(err, errQueueFull):
+				a.log.Warn("dropping message", "command", msg.Message.GetCommand(), "peer_id", msg.Peer, "error", err)
+			case err != nil:
+				a.log.Debug("dropping message", "command", msg.Message.GetCommand(), "peer_id", msg.Peer, "error", err)
+			}
+		}
+	}
+}
+
+// Runs in the peer's queue goroutine, the handlers send to the peer.
+func (a *Application) handleMessage(id peers.PeerID, msg encoding.Message) {
+	peer := a.peers.Peer(id)
+	if peer == nil {
+		return
+	}
+	switch m := msg.(type) {
+	case *encoding.MsgCmpctBlock:
+		if a.blocks.claim(m.Header.Hash()) {
+			go a.reconstructBlock(peer, m)
 		}
+	case *encoding.MsgInv, *encoding.MsgHeaders:
+		a.fetchAnnouncedBlocks(peer, m)
 	}
+	a.broadcaster.HandleMessage(a.ctx, peer, msg)
+	if a.mempool != nil {
+		err := a.mempool.HandleMessage(a.ctx, peer, msg)
+		if err != nil {
+			a.log.Warn("mempool watcher error", "peer", peer.Address(), "error", err)
+		}
+	}
+}
+
+// Compact blocks are our low latency block notifications. Without a mempool
+// the peer sends us all the transactions. Every block is reconstructed once,
+// from the first peer that sends it, and released for the others on failure.
+func (a *Application) reconstructBlock(peer *client.BTCClient, cmpct *encoding.MsgCmpctBlock) {
+	hash := cmpct.Header.Hash()
+	var pool compact.TxPool
+	if a.mempool != nil {
+		pool = a.mempool.Pool()
+	}
+	block, err := compact.Reconstruct(a.ctx, peer, cmpct, pool)
+	if err != nil {
+		a.log.Error("failed reconstructing compact block", "hash", hash.String(), "peer", peer.Address(), "error", err)
+		a.blocks.release(hash)
+		return
+	}
+	a.log.Info("received new block", "hash", hash.String(), "txs", len(block.Transactions), "peer", peer.Address())
+	a.handleBlock(block)
+}
+
+// Bitcoin Core announces at most this many new blocks in a headers message.
+// Longer ones answer our header sync.
+const maxBlockAnnouncement = 8
+
+// Downloads the blocks a peer announces with inv or headers, when the mempool
+// or our pending transactions need them. Peers in high bandwidth mode send
+// compact blocks instead.
+func (a *Application) fetchAnnouncedBlocks(peer *client.BTCClient, msg encoding.Message) {
+	if a.mempool == nil && len(a.broadcaster.Pending()) == 0 {
+		return
+	}
+	var hashes []encoding.Hash
+	switch msg := msg.(type) {
+	case *encoding.MsgInv:
+		for _, vect := range msg.Inventory {
+			if vect.Type&^encoding.InvWitnessFlag == encoding.InvTypeBlock {
+				hashes = append(hashes, vect.Hash)
+			}
+		}
+	case *encoding.MsgHeaders:
+		if len(msg.Headers) > maxBlockAnnouncement {
+			return
+		}
+		for i := range msg.Headers {
+			hashes = append(hashes, msg.Headers[i].Hash())
+		}
+	}
+	for _, hash := range hashes {
+		if a.blocks.claim(hash) {
+			go a.fetchBlock(peer, hash)
+		}
+	}
+}
+
+func (a *Application) fetchBlock(peer *client.BTCClient, hash encoding.Hash) {
+	block, err := compact.FetchBlock(a.ctx, peer, hash)
+	if err != nil {
+		a.log.Error("failed fetching block", "hash", hash.String(), "peer", peer.Address(), "error", err)
+		a.blocks.release(hash)
+		return
+	}
+	a.log.Info("received new block", "hash", hash.String(), "txs", len(block.Transactions), "peer", peer.Address())
+	a.handleBlock(block)
+}
+
+// Confirms our pending transactions and drops the block's transactions from
+// the pool.
+func (a *Application) handleBlock(block *encoding.MsgBlock) {
+	a.broadcaster.HandleBlock(block)
+	if a.mempool != nil {
+		a.mempool.RemoveBlock(block)
+	}
+}
+
+// Broadcaster sends our transactions through the connected peers.
+func (a *Application) Broadcaster() *broadcast.Broadcaster {
+	return a.broadcaster
+}
+
+func (a *Application) connectedPeers() []broadcast.Peer {
+	var connected []broadcast.Peer
+	for _, id := range a.peers.Peers() {
+		if peer := a.peers.Peer(id); peer != nil && peer.State() == client.StateEstablished {
+			connected = append(connected, peer)
+		}
+	}
+	return connected
+}
+
+// Asks the peer for its mempool once the handshake is complete.
+func (a *Application) requestMempool(peer *client.BTCClient) {
+	select {
+	case <-peer.Established():
+	case <-peer.Done():
+		return
+	}
+	err := a.mempool.RequestMempool(a.ctx, peer, peer.Peer().RemoteVersion().Services)
+	if err != nil {
+		a.log.Info("not requesting peer mempool", "peer", peer.Address(), "error", err)
+	}
+}
+
+func (a *Application) logPeerEvents(events <-chan peers.Event) {
+	for event := range events {
+		a.log.Debug("peer event", "type", event.Type.String(), "peer", event.Address,
+			"peer_id", event.Peer, "attempt", event.Attempt, "delay", event.Delay, "error", event.Err)
+	}
+}
+
+// StartServer accepts inbound peers when BTC_LISTEN_ADDRESS is set.
+func (a *Application) StartServer() error {
+	if a.server == nil {
+		return nil
+	}
+	err := a.server.Listen()
+	if err != nil {
+		return errors.Wrap(err, "server listen error")
+	}
+	return a.server.Serve(a.ctx)
+}
+
+// Inbound peers join the outbound ones in the manager, so their messages
+// reach the same handlers.
+func (a *Application) handleInboundPeer(peer *client.BTCClient, messageC <-chan encoding.Message) {
+	a.peers.RunInbound(peer, messageC)
 }
 
 func (a *Application) StartSignalMonitor() error {
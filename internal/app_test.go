@@ -13,8 +13,16 @@ func Test_NewApplication(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	a := NewApplication(ctx, log)
+	a, err := NewApplication(ctx, log)
+	assert.NoError(t, err)
 
 	assert.NotNil(t, a.config)
 	assert.NotNil(t, a.log)
 }
+
+func Test_NewApplication_InvalidNetwork(t *testing.T) {
+	t.Setenv("BTC_NETWORK", "litecoin")
+
+	_, err := NewApplication(context.Background(), slog.Default())
+	assert.ErrorContains(t, err, "invalid BTC_NETWORK")
+}
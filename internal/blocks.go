@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"sync"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+// How many processed blocks we remember. Peers announce new blocks, so the
+// most recent ones are enough.
+const recentBlocks = 100
+
+// blockTracker makes sure a block announced by several peers is only
+// downloaded and processed once.
+type blockTracker struct {
+	mu    sync.Mutex
+	known map[encoding.Hash]struct{}
+	order []encoding.Hash
+}
+
+func newBlockTracker() *blockTracker {
+	return &blockTracker{known: map[encoding.Hash]struct{}{}}
+}
+
+// Reports whether the block is new. The caller then owns it until it is done
+// or released.
+func (t *blockTracker) claim(hash encoding.Hash) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.known[hash]; ok {
+		return false
+	}
+	t.known[hash] = struct{}{}
+	t.order = append(t.order, hash)
+	if len(t.order) > recentBlocks {
+		delete(t.known, t.order[0])
+		t.order = t.order[1:]
+	}
+	return true
+}
+
+// Gives up a block we failed to get, so the next announcement can try again.
+func (t *blockTracker) release(hash encoding.Hash) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.known, hash)
+	for i, known := range t.order {
+		if known == hash {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+}
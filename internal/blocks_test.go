@@ -0,0 +1,25 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+)
+
+func Test_BlockTracker(t *testing.T) {
+	tracker := newBlockTracker()
+
+	assert.True(t, tracker.claim(encoding.Hash{1}))
+	assert.False(t, tracker.claim(encoding.Hash{1}), "already in flight")
+
+	tracker.release(encoding.Hash{1})
+	assert.True(t, tracker.claim(encoding.Hash{1}), "released blocks can be claimed again")
+
+	for i := range recentBlocks {
+		assert.True(t, tracker.claim(encoding.Hash{2, byte(i)}))
+	}
+	assert.True(t, tracker.claim(encoding.Hash{1}), "the oldest block is forgotten")
+	assert.False(t, tracker.claim(encoding.Hash{2, recentBlocks - 1}))
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/btc/peers"
+)
+
+// How many messages of one peer can wait for their handler.
+const peerQueueSize = 100
+
+var (
+	errQueueFull = errors.New("peer message queue full")
+	errPeerGone  = errors.New("peer disconnected")
+)
+
+// peerQueues hands the messages of every peer to its own goroutine, in the
+// order the peer sent them. Handlers answer the peer and wait for its socket,
+// so a slow peer only holds up its own messages.
+type peerQueues struct {
+	handle func(id peers.PeerID, msg encoding.Message)
+
+	mu     sync.Mutex
+	queues map[peers.PeerID]chan encoding.Message
+}
+
+func newPeerQueues(handle func(id peers.PeerID, msg encoding.Message)) *peerQueues {
+	return &peerQueues{handle: handle, queues: map[peers.PeerID]chan encoding.Message{}}
+}
+
+// Queues the message, starting the peer's goroutine on its first one. The
+// goroutine stops once done is closed, messages that arrive after that are
+// refused with errPeerGone.
+func (q *peerQueues) push(id peers.PeerID, done <-chan struct{}, msg encoding.Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-done:
+		return errPeerGone
+	default:
+	}
+	queue, ok := q.queues[id]
+	if !ok {
+		queue = make(chan encoding.Message, peerQueueSize)
+		q.queues[id] = queue
+		go q.run(id, done, queue)
+	}
+
+	select {
+	case queue <- msg:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+func (q *peerQueues) run(id peers.PeerID, done <-chan struct{}, queue <-chan encoding.Message) {
+	for {
+		select {
+		case <-done:
+			// push checks done under the same lock, so no message can be
+			// queued once we are out of the map. Queued ones are dropped
+			// with the peer.
+			q.mu.Lock()
+			delete(q.queues, id)
+			q.mu.Unlock()
+			return
+		case msg := <-queue:
+			q.handle(id, msg)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"deshev.com/bitcoin-handshake/btc/encoding"
+	"deshev.com/bitcoin-handshake/btc/peers"
+)
+
+func Test_PeerQueues(t *testing.T) {
+	handled := make(chan encoding.Message, 2*peerQueueSize)
+	started := make(chan struct{}, 2*peerQueueSize)
+	blocked := make(chan struct{})
+	queues := newPeerQueues(func(id peers.PeerID, msg encoding.Message) {
+		if id == 1 {
+			started <- struct{}{}
+			<-blocked
+		}
+		handled <- msg
+	})
+	slowDone := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+
+	// Peer 1 is stuck in its handler, peer 2 still gets its messages handled.
+	assert.NoError(t, queues.push(1, slowDone, &encoding.MsgPing{Nonce: 1}))
+	<-started
+	assert.NoError(t, queues.push(2, done, &encoding.MsgPing{Nonce: 2}))
+	assert.NoError(t, queues.push(2, done, &encoding.MsgPing{Nonce: 3}))
+	assert.Equal(t, &encoding.MsgPing{Nonce: 2}, receive(t, handled))
+	assert.Equal(t, &encoding.MsgPing{Nonce: 3}, receive(t, handled))
+
+	for i := range peerQueueSize {
+		assert.NoError(t, queues.push(1, slowDone, &encoding.MsgPing{Nonce: encoding.UInt64(i)}))
+	}
+	assert.ErrorIs(t, queues.push(1, slowDone, &encoding.MsgPing{}), errQueueFull)
+
+	close(slowDone)
+	assert.ErrorIs(t, queues.push(1, slowDone, &encoding.MsgPing{}), errPeerGone)
+	close(blocked)
+	assert.Equal(t, &encoding.MsgPing{Nonce: 1}, receive(t, handled))
+	assert.Eventually(t, func() bool {
+		queues.mu.Lock()
+		defer queues.mu.Unlock()
+		_, ok := queues.queues[1]
+		return !ok
+	}, time.Second, time.Millisecond, "the queue goes away with its peer")
+
+	// A late first message doesn't leave a queue behind.
+	assert.ErrorIs(t, queues.push(3, slowDone, &encoding.MsgPing{}), errPeerGone)
+	assert.NotContains(t, queues.queues, peers.PeerID(3))
+}
+
+func receive(t *testing.T, c <-chan encoding.Message) encoding.Message {
+	t.Helper()
+	select {
+	case msg := <-c:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("message not handled")
+		return nil
+	}
+}
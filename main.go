@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"os"
 
 	"golang.org/x/sync/errgroup"
 
@@ -14,13 +15,18 @@ func main() {
 	log := slog.Default()
 	ops, ctx := errgroup.WithContext(context.Background())
 
-	app := internal.NewApplication(ctx, log)
+	app, err := internal.NewApplication(ctx, log)
+	if err != nil {
+		log.Error("failed to start bitcoin-handshake", "error", err)
+		os.Exit(1)
+	}
 	log.Info("starting bitcoin-handshake")
 
 	ops.Go(app.StartConnection)
+	ops.Go(app.StartServer)
 	ops.Go(app.StartSignalMonitor)
 
-	err := ops.Wait()
+	err = ops.Wait()
 	if !errors.Is(err, context.Canceled) {
 		log.Error("server terminated abnormally", "error", err)
 	}